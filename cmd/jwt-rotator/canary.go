@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator"
+	versionstage2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/versionstage"
+)
+
+func runCanary(ctx context.Context, args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("canary", flag.ContinueOnError)
+	secretID := flags.String("secret-id", "", "ID or ARN of the secret to provision a canary token for (required)")
+	stage := flags.String("stage", string(versionstage2.JWTCanary), "Staging label of the canary token")
+
+	var (
+		provider providerFlags
+		testers  testerFlags
+	)
+
+	provider.register(flags)
+	testers.register(flags)
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *secretID == "" {
+		flags.Usage()
+		return fmt.Errorf("%w: -secret-id is required", errUsage)
+	}
+
+	secretsManager := newSecretsManager()
+
+	tokenProvider, err := provider.tokenProvider(secretsManager)
+	if err != nil {
+		flags.Usage()
+		return err
+	}
+
+	jwtRotator := jwtrotator.JWTRotator{
+		SecretsManager: secretsManager,
+		TokenProvider:  tokenProvider,
+		CanaryStage:    versionstage2.VersionStage(*stage),
+	}
+	testers.apply(&jwtRotator)
+
+	staged, err := jwtRotator.StageCanary(ctx, *secretID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "Stored the canary token of %s as version %s labelled %s\n", *secretID, staged, *stage)
+
+	return nil
+}
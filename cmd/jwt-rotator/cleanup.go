@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator"
+)
+
+func runCleanupPending(ctx context.Context, args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("cleanup-pending", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "Only report the stale labels, without removing them")
+
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: jwt-rotator cleanup-pending [-dry-run] <secret-id>...\n")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return fmt.Errorf("%w: at least one secret ID is required", errUsage)
+	}
+
+	jwtRotator := jwtrotator.JWTRotator{
+		SecretsManager: newSecretsManager(),
+	}
+
+	found, err := jwtRotator.CleanupStalePending(ctx, flags.Args(), *dryRun)
+
+	for _, stale := range found {
+		action := "Removed"
+		if !stale.Removed {
+			action = "Found"
+		}
+
+		fmt.Fprintf(stdout, "%s stale AWSPENDING on %s version %s: %s\n", action, stale.SecretID, stale.VersionID, stale.Reason)
+	}
+
+	if err == nil && len(found) == 0 {
+		fmt.Fprintln(stdout, "No stale AWSPENDING labels found")
+	}
+
+	return err
+}
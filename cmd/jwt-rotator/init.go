@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator"
+)
+
+func runInit(ctx context.Context, args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("init", flag.ContinueOnError)
+	secretID := flags.String("secret-id", "", "ID or ARN of the secret to initialize (required)")
+
+	var provider providerFlags
+	provider.register(flags)
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *secretID == "" {
+		flags.Usage()
+		return fmt.Errorf("%w: -secret-id is required", errUsage)
+	}
+
+	secretsManager := newSecretsManager()
+
+	tokenProvider, err := provider.tokenProvider(secretsManager)
+	if err != nil {
+		flags.Usage()
+		return err
+	}
+
+	jwtRotator := jwtrotator.JWTRotator{
+		SecretsManager: secretsManager,
+		TokenProvider:  tokenProvider,
+	}
+
+	initialized, err := jwtRotator.InitializeSecret(ctx, *secretID)
+	if err != nil {
+		return err
+	}
+
+	if initialized {
+		fmt.Fprintf(stdout, "Stored the first token of %s as version %s\n", *secretID, jwtrotator.BootstrapVersionID)
+	} else {
+		fmt.Fprintf(stdout, "%s already has a current token, nothing to do\n", *secretID)
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator"
+)
+
+const fingerprintLength = 12
+
+func runInspect(ctx context.Context, args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("inspect", flag.ContinueOnError)
+	secretID := flags.String("secret-id", "", "ID or ARN of the secret to inspect (required)")
+	output := flags.String("output", "table", "Output format, table or json")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *secretID == "" {
+		flags.Usage()
+		return fmt.Errorf("%w: -secret-id is required", errUsage)
+	}
+
+	jwtRotator := jwtrotator.JWTRotator{
+		SecretsManager: newSecretsManager(),
+	}
+
+	report, err := jwtRotator.Inspect(ctx, *secretID)
+	if err != nil {
+		return err
+	}
+
+	switch *output {
+	case "json":
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+
+		return encoder.Encode(report)
+	case "table":
+		return writeReportTable(stdout, report)
+	}
+
+	flags.Usage()
+
+	return fmt.Errorf("%w: unknown output format '%s'", errUsage, *output)
+}
+
+func writeReportTable(stdout io.Writer, report jwtrotator.SecretReport) error {
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0) //nolint:gomnd
+
+	fmt.Fprintln(w, "VERSION\tSTAGES\tEXPIRES IN\tFINGERPRINT\tHEADER\tCLAIMS")
+
+	for _, v := range report.Versions {
+		expiresIn, fingerprint, header, claims := "-", "-", "-", v.Error
+
+		if v.TimeToExpiry != nil {
+			expiresIn = v.TimeToExpiry.String()
+		}
+
+		if len(v.Fingerprint) >= fingerprintLength {
+			fingerprint = v.Fingerprint[:fingerprintLength]
+		}
+
+		if v.Token != nil {
+			encodedHeader, err := json.Marshal(v.Token.Header)
+			if err != nil {
+				return fmt.Errorf("failed to marshal header: %w", err)
+			}
+
+			encodedClaims, err := json.Marshal(v.Token.Claims)
+			if err != nil {
+				return fmt.Errorf("failed to marshal claims: %w", err)
+			}
+
+			header, claims = string(encodedHeader), string(encodedClaims)
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", v.VersionID, strings.Join(v.Stages, ","), expiresIn, fingerprint, header, claims)
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(report.Problems) == 0 {
+		return nil
+	}
+
+	fmt.Fprintln(stdout, "\nProblems:")
+
+	for _, problem := range report.Problems {
+		if problem.VersionID != "" {
+			fmt.Fprintf(stdout, "  [%s] %s: %s\n", problem.Kind, problem.VersionID, problem.Message)
+		} else {
+			fmt.Fprintf(stdout, "  [%s] %s\n", problem.Kind, problem.Message)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+// Command jwt-rotator is a companion CLI for operating on secrets rotated by
+// the JWT rotator lambda.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+)
+
+var errUsage = errors.New("invalid usage")
+
+type command struct {
+	name    string
+	summary string
+	run     func(ctx context.Context, args []string, stdout io.Writer) error
+}
+
+var commands = []command{
+	{name: "inspect", summary: "List the versions of a secret and decode their tokens", run: runInspect},
+	{name: "init", summary: "Provision the first token of a secret that has none", run: runInit},
+	{name: "rollback", summary: "Restore the previous token of a secret as the current one", run: runRollback},
+	{name: "canary", summary: "Provision a canary token for a secret without promoting it", run: runCanary},
+	{name: "promote", summary: "Promote the canary token of a secret to the current one", run: runPromote},
+	{name: "revoke", summary: "Revoke a leaked current token and rotate the secret", run: runRevoke},
+	{name: "cleanup-pending", summary: "Remove AWSPENDING labels left by abandoned rotations", run: runCleanupPending},
+}
+
+func main() {
+	if err := run(context.Background(), os.Args[1:], os.Stdout); err != nil {
+		if !errors.Is(err, errUsage) && !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintf(os.Stderr, "jwt-rotator: %s\n", err)
+		}
+
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		usage(os.Stderr)
+		return errUsage
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd.run(ctx, args[1:], stdout)
+		}
+	}
+
+	usage(os.Stderr)
+
+	return fmt.Errorf("%w: unknown command '%s'", errUsage, args[0])
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: jwt-rotator <command> [flags]\n\nCommands:\n")
+
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-16s %s\n", cmd.name, cmd.summary)
+	}
+}
+
+func newSecretsManager() *secretsmanager.SecretsManager {
+	sess := session.Must(session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+	}))
+
+	return secretsmanager.New(sess)
+}
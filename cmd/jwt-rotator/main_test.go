@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun_NoCommand(t *testing.T) {
+	// When
+	err := run(context.Background(), nil, &bytes.Buffer{})
+
+	// Then
+	require.ErrorIs(t, err, errUsage)
+}
+
+func TestRun_UnknownCommand(t *testing.T) {
+	// When
+	err := run(context.Background(), []string{"rotate"}, &bytes.Buffer{})
+
+	// Then
+	require.ErrorIs(t, err, errUsage)
+	assert.Contains(t, err.Error(), "unknown command 'rotate'")
+}
+
+func TestRun_Dispatch(t *testing.T) {
+	for name, test := range map[string]struct {
+		args        []string
+		expectedErr error
+		message     string
+	}{
+		"inspect without secret":  {args: []string{"inspect"}, expectedErr: errUsage, message: "-secret-id is required"},
+		"rollback without reason": {args: []string{"rollback", "-secret-id", "secret"}, expectedErr: errUsage, message: "-secret-id and -reason are required"},
+		"revoke without flags":    {args: []string{"revoke"}, expectedErr: errUsage, message: "-secret-id, -reason and -revocation-url are required"},
+		"revoke help":             {args: []string{"revoke", "-h"}, expectedErr: flag.ErrHelp},
+	} {
+		test := test
+
+		t.Run(name, func(t *testing.T) {
+			// When
+			err := run(context.Background(), test.args, &bytes.Buffer{})
+
+			// Then
+			require.ErrorIs(t, err, test.expectedErr)
+			assert.Contains(t, err.Error(), test.message)
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator"
+	versionstage2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/versionstage"
+)
+
+func runPromote(ctx context.Context, args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("promote", flag.ContinueOnError)
+	secretID := flags.String("secret-id", "", "ID or ARN of the secret whose canary to promote (required)")
+	stage := flags.String("stage", string(versionstage2.JWTCanary), "Staging label of the canary token")
+
+	var testers testerFlags
+	testers.register(flags)
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *secretID == "" {
+		flags.Usage()
+		return fmt.Errorf("%w: -secret-id is required", errUsage)
+	}
+
+	jwtRotator := jwtrotator.JWTRotator{
+		SecretsManager: newSecretsManager(),
+		CanaryStage:    versionstage2.VersionStage(*stage),
+	}
+	testers.apply(&jwtRotator)
+
+	promoted, err := jwtRotator.PromoteCanary(ctx, *secretID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "Promoted %s version %s to the current token of %s\n", *stage, promoted, *secretID)
+
+	return nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/SKF/go-rest-utility/client/auth"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+)
+
+// providerFlags configures the token provider used by commands which mint
+// new tokens.
+type providerFlags struct {
+	credentialsSecretID string
+	tokenType           string
+}
+
+func (f *providerFlags) register(flags *flag.FlagSet) {
+	flags.StringVar(&f.credentialsSecretID, "credentials-secret", "", "ID or ARN of the secret holding the credentials to sign in with (required)")
+	flags.StringVar(&f.tokenType, "token-type", auth.DefaultTokenType, "Type of token to request when signing in")
+}
+
+func (f *providerFlags) tokenProvider(client *secretsmanager.SecretsManager) (auth.TokenProvider, error) {
+	if f.credentialsSecretID == "" {
+		return nil, fmt.Errorf("%w: -credentials-secret is required", errUsage)
+	}
+
+	return &auth.SecretCredentialsTokenProvider{
+		SecretID:      f.credentialsSecretID,
+		SecretsClient: auth.SecretsManagerV1Client{SecretsManager: client},
+		TokenType:     f.tokenType,
+	}, nil
+}
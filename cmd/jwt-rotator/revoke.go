@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator"
+)
+
+func runRevoke(ctx context.Context, args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("revoke", flag.ContinueOnError)
+	secretID := flags.String("secret-id", "", "ID or ARN of the secret whose current token leaked (required)")
+	reason := flags.String("reason", "", "Why the token is revoked, it is recorded in the audit trail (required)")
+	revocationURL := flags.String("revocation-url", "", "OAuth 2.0 token revocation endpoint, RFC 7009 (required)")
+	clientID := flags.String("client-id", "", "Client ID to authenticate at the revocation endpoint")
+	clientSecretID := flags.String("client-secret-id", "", "ID or ARN of the secret holding the client secret, defaults to the "+envClientSecret+" environment variable")
+	yes := flags.Bool("yes", false, "Skip the confirmation prompt")
+
+	var provider providerFlags
+	provider.register(flags)
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *secretID == "" || *reason == "" || *revocationURL == "" {
+		flags.Usage()
+		return fmt.Errorf("%w: -secret-id, -reason and -revocation-url are required", errUsage)
+	}
+
+	secretsManager := newSecretsManager()
+
+	tokenProvider, err := provider.tokenProvider(secretsManager)
+	if err != nil {
+		flags.Usage()
+		return err
+	}
+
+	clientSecret, err := revocationClientSecret(ctx, secretsManager, *clientSecretID, os.Getenv)
+	if err != nil {
+		return err
+	}
+
+	if !*yes {
+		confirmed, confirmErr := confirm(stdout, os.Stdin, *secretID)
+		if confirmErr != nil {
+			return confirmErr
+		}
+
+		if !confirmed {
+			return fmt.Errorf("aborted, nothing was changed")
+		}
+	}
+
+	jwtRotator := jwtrotator.JWTRotator{
+		SecretsManager: secretsManager,
+		TokenProvider:  tokenProvider,
+		Revocation: jwtrotator.Revocation{
+			Revoker: jwtrotator.OAuthRevoker{
+				URL:          *revocationURL,
+				ClientID:     *clientID,
+				ClientSecret: clientSecret,
+			},
+		},
+	}
+
+	result, err := jwtRotator.EmergencyRotate(ctx, *secretID, *reason)
+
+	encoder := json.NewEncoder(stdout)
+	for _, entry := range result.Audit {
+		if encodeErr := encoder.Encode(entry); encodeErr != nil {
+			return encodeErr
+		}
+	}
+
+	return err
+}
+
+// envClientSecret holds the client secret of the revocation endpoint, it is
+// not a flag so it does not end up in the shell history or the process list.
+const envClientSecret = "JWT_ROTATOR_REVOCATION_CLIENT_SECRET"
+
+type secretValueGetter interface {
+	GetSecretValueWithContext(ctx aws.Context, input *secretsmanager.GetSecretValueInput, opts ...request.Option) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+// revocationClientSecret reads the client secret of the revocation endpoint
+// from the secret secretID, or from the environment if secretID is empty.
+func revocationClientSecret(ctx context.Context, client secretValueGetter, secretID string, getenv func(string) string) (string, error) {
+	if secretID == "" {
+		return getenv(envClientSecret), nil
+	}
+
+	output, err := client.GetSecretValueWithContext(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(secretID),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get client secret: %w", err)
+	}
+
+	if output.SecretString != nil {
+		return *output.SecretString, nil
+	}
+
+	return string(output.SecretBinary), nil
+}
+
+// confirm asks to type the secret ID before its current token is revoked.
+func confirm(stdout io.Writer, in io.Reader, secretID string) (bool, error) {
+	fmt.Fprintf(stdout, "This revokes the current token of %s, marks it compromised and rotates the secret.\nType the secret ID to confirm: ", secretID)
+
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && err != io.EOF { //nolint:errorlint // io.EOF is returned unwrapped
+		return false, fmt.Errorf("failed to read confirmation: %w", err)
+	}
+
+	return strings.TrimSpace(answer) == secretID, nil
+}
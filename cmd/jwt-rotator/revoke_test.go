@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	inmemorysecretsmanager2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/testutils/inmemorysecretsmanager"
+)
+
+func TestConfirm(t *testing.T) {
+	for name, test := range map[string]struct {
+		input     string
+		confirmed bool
+	}{
+		"match":              {input: "services/my-service/jwt\n", confirmed: true},
+		"match without EOL":  {input: "services/my-service/jwt", confirmed: true},
+		"mismatch":           {input: "services/other-service/jwt\n"},
+		"empty input at EOF": {input: ""},
+	} {
+		test := test
+
+		t.Run(name, func(t *testing.T) {
+			// Given
+			var stdout bytes.Buffer
+
+			// When
+			confirmed, err := confirm(&stdout, strings.NewReader(test.input), "services/my-service/jwt")
+
+			// Then
+			require.NoError(t, err)
+			assert.Equal(t, test.confirmed, confirmed)
+			assert.Contains(t, stdout.String(), "Type the secret ID to confirm")
+		})
+	}
+}
+
+func TestRevocationClientSecret_FromEnvironment(t *testing.T) {
+	// Given
+	getenv := func(name string) string {
+		return map[string]string{envClientSecret: "from-env"}[name]
+	}
+
+	// When
+	clientSecret, err := revocationClientSecret(context.Background(), inmemorysecretsmanager2.New(), "", getenv)
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, "from-env", clientSecret)
+}
+
+func TestRevocationClientSecret_FromSecret(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	secretsManager := inmemorysecretsmanager2.New()
+
+	_, err := secretsManager.PutSecretValueWithContext(ctx, &secretsmanager.PutSecretValueInput{
+		SecretId:           aws.String("revocation/client-secret"),
+		ClientRequestToken: aws.String("00000000-0000-4000-8000-000000000000"),
+		SecretString:       aws.String("from-secret"),
+	})
+	require.NoError(t, err)
+
+	getenv := func(string) string { return "from-env" }
+
+	// When
+	clientSecret, err := revocationClientSecret(ctx, secretsManager, "revocation/client-secret", getenv)
+	_, missingErr := revocationClientSecret(ctx, secretsManager, "revocation/missing", getenv)
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, "from-secret", clientSecret)
+	require.Error(t, missingErr)
+	assert.Contains(t, missingErr.Error(), "failed to get client secret")
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator"
+)
+
+func runRollback(ctx context.Context, args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("rollback", flag.ContinueOnError)
+	secretID := flags.String("secret-id", "", "ID or ARN of the secret to roll back (required)")
+	reason := flags.String("reason", "", "Why the current token is rolled back, it is logged with the rollback (required)")
+
+	var testers testerFlags
+	testers.register(flags)
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *secretID == "" || *reason == "" {
+		flags.Usage()
+		return fmt.Errorf("%w: -secret-id and -reason are required", errUsage)
+	}
+
+	jwtRotator := jwtrotator.JWTRotator{
+		SecretsManager: newSecretsManager(),
+	}
+	testers.apply(&jwtRotator)
+
+	restored, err := jwtRotator.Rollback(ctx, *secretID, *reason)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "Restored version %s as the current token of %s\n", restored, *secretID)
+
+	return nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"time"
+
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator"
+)
+
+// testerFlags configures the checks a token must pass before commands move it
+// to AWSCURRENT.
+type testerFlags struct {
+	audience    string
+	probeURL    string
+	minLifetime time.Duration
+}
+
+func (f *testerFlags) register(flags *flag.FlagSet) {
+	flags.StringVar(&f.audience, "audience", "", "Audience the token must be issued for")
+	flags.StringVar(&f.probeURL, "probe-url", "", "URL which must accept the token as a bearer token")
+	flags.DurationVar(&f.minLifetime, "min-lifetime", 0, "Shortest remaining lifetime the token must have")
+}
+
+func (f *testerFlags) apply(jwtRotator *jwtrotator.JWTRotator) {
+	jwtRotator.MinLifetime = f.minLifetime
+
+	if f.audience != "" {
+		jwtRotator.Testers = append(jwtRotator.Testers, jwtrotator.AudienceTester{Audience: f.audience})
+	}
+
+	if f.probeURL != "" {
+		jwtRotator.Testers = append(jwtRotator.Testers, jwtrotator.HTTPProbeTester{URL: f.probeURL})
+	}
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator"
+)
+
+const (
+	envConfigFile         = "JWT_ROTATOR_CONFIG_FILE"
+	envProviderType       = "JWT_ROTATOR_PROVIDER_TYPE"
+	envCredentialsSecret  = "JWT_ROTATOR_CREDENTIALS_SECRET"
+	envUsername           = "JWT_ROTATOR_USERNAME"
+	envPassword           = "JWT_ROTATOR_PASSWORD" //nolint:gosec // name of the variable, not a credential
+	envEndpoint           = "JWT_ROTATOR_SIGN_IN_URL"
+	envTokenType          = "JWT_ROTATOR_TOKEN_TYPE"
+	envAudience           = "JWT_ROTATOR_AUDIENCE"
+	envProbeURL           = "JWT_ROTATOR_PROBE_URL"
+	envCurrentProbeURL    = "JWT_ROTATOR_CURRENT_TOKEN_PROBE_URL"
+	envFailOnRevoked      = "JWT_ROTATOR_CURRENT_TOKEN_FAIL_ON_REVOKED"
+	envMinLifetime        = "JWT_ROTATOR_MIN_LIFETIME"
+	envBootstrap          = "JWT_ROTATOR_BOOTSTRAP"
+	envRemoveStalePending = "JWT_ROTATOR_REMOVE_STALE_PENDING"
+	envRevocationURL      = "JWT_ROTATOR_REVOCATION_URL"
+	envGracePeriod        = "JWT_ROTATOR_REVOCATION_GRACE_PERIOD"
+	envRevocationSecrets  = "JWT_ROTATOR_REVOCATION_SECRET_IDS"
+	envRetryMaxAttempts   = "JWT_ROTATOR_RETRY_MAX_ATTEMPTS"
+	envRetryBackoff       = "JWT_ROTATOR_RETRY_BACKOFF"
+	envServiceName        = "JWT_ROTATOR_SERVICE_NAME"
+	envDatadog            = "JWT_ROTATOR_DATADOG"
+)
+
+const (
+	providerCredentials = "credentials"
+
+	testerAudience      = "audience"
+	testerHTTPProbe     = "http-probe"
+	testerIntrospection = "introspection"
+)
+
+const (
+	defaultRetryMaxAttempts = 3
+	defaultRetryBackoff     = time.Second
+)
+
+type Config struct {
+	Provider           ProviderConfig          `json:"provider" yaml:"provider"`
+	Testers            []TesterConfig          `json:"testers" yaml:"testers"`
+	MinLifetime        Duration                `json:"minLifetime" yaml:"minLifetime"`
+	CurrentTokenCheck  CurrentTokenCheckConfig `json:"currentTokenCheck" yaml:"currentTokenCheck"`
+	Bootstrap          bool                    `json:"bootstrap" yaml:"bootstrap"`
+	RemoveStalePending bool                    `json:"removeStalePending" yaml:"removeStalePending"`
+	Revocation         RevocationConfig        `json:"revocation" yaml:"revocation"`
+	Retry              RetryConfig             `json:"retry" yaml:"retry"`
+	Logging            LoggingConfig           `json:"logging" yaml:"logging"`
+	Tracing            TracingConfig           `json:"tracing" yaml:"tracing"`
+}
+
+type ProviderConfig struct {
+	// Type is either secret-credentials or credentials.
+	Type string `json:"type" yaml:"type"`
+
+	// CredentialsSecret is the secret holding the credentials of the
+	// secret-credentials provider.
+	CredentialsSecret string `json:"credentialsSecret" yaml:"credentialsSecret"`
+
+	// Username, Password and Endpoint are used by the credentials provider.
+	Username string `json:"username" yaml:"username"`
+	Password string `json:"password" yaml:"password"`
+	Endpoint string `json:"signInUrl" yaml:"signInUrl"`
+
+	TokenType string `json:"tokenType" yaml:"tokenType"`
+}
+
+type TesterConfig struct {
+	// Type is either audience, http-probe or introspection.
+	Type string `json:"type" yaml:"type"`
+
+	Audience string `json:"audience" yaml:"audience"`
+
+	// URL is used by the http-probe and introspection testers.
+	URL            string `json:"url" yaml:"url"`
+	Method         string `json:"method" yaml:"method"`
+	ExpectedStatus int    `json:"expectedStatus" yaml:"expectedStatus"`
+
+	// ClientID and ClientSecret authenticate the introspection tester.
+	ClientID     string `json:"clientId" yaml:"clientId"`
+	ClientSecret string `json:"clientSecret" yaml:"clientSecret"`
+}
+
+// CurrentTokenCheckConfig runs Testers against the AWSCURRENT token once the
+// new token is minted, to detect providers which revoke earlier tokens.
+type CurrentTokenCheckConfig struct {
+	Testers       []TesterConfig `json:"testers" yaml:"testers"`
+	FailOnRevoked bool           `json:"failOnRevoked" yaml:"failOnRevoked"`
+}
+
+// RetryConfig controls how often provisioning a token is attempted before
+// the rotation step fails. The backoff doubles between attempts.
+type RetryConfig struct {
+	MaxAttempts int      `json:"maxAttempts" yaml:"maxAttempts"`
+	Backoff     Duration `json:"backoff" yaml:"backoff"`
+}
+
+// RevocationConfig revokes the AWSPREVIOUS token of SecretIDs at an OAuth 2.0
+// revocation endpoint, once GracePeriod has passed since it was replaced.
+// Revocations are run when the lambda receives a scheduled event.
+type RevocationConfig struct {
+	URL           string   `json:"url" yaml:"url"`
+	ClientID      string   `json:"clientId" yaml:"clientId"`
+	ClientSecret  string   `json:"clientSecret" yaml:"clientSecret"`
+	TokenTypeHint string   `json:"tokenTypeHint" yaml:"tokenTypeHint"`
+	GracePeriod   Duration `json:"gracePeriod" yaml:"gracePeriod"`
+	SecretIDs     []string `json:"secretIds" yaml:"secretIds"`
+}
+
+type LoggingConfig struct {
+	// Service is added as the service field of every log entry. The log level
+	// is controlled with the LOG_LEVEL environment variable.
+	Service string `json:"service" yaml:"service"`
+}
+
+type TracingConfig struct {
+	// Datadog wraps the handler with the Datadog lambda library.
+	Datadog bool `json:"datadog" yaml:"datadog"`
+}
+
+// Duration is a time.Duration read from its string form, e.g. "1h30m".
+type Duration time.Duration
+
+func (d Duration) Duration() time.Duration {
+	return time.Duration(d)
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("duration must be a string such as \"1h30m\": %w", err)
+	}
+
+	return d.parse(value)
+}
+
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	return d.parse(node.Value)
+}
+
+func (d *Duration) parse(value string) error {
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(parsed)
+
+	return nil
+}
+
+// ConfigError lists every problem found in a configuration.
+type ConfigError struct {
+	Problems []string
+}
+
+func (e ConfigError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// LoadConfig reads the configuration file named by JWT_ROTATOR_CONFIG_FILE,
+// if any, and applies the environment variables on top of it.
+func LoadConfig(getenv func(string) string, readFile func(string) ([]byte, error)) (Config, error) {
+	config := Config{
+		Retry: RetryConfig{
+			MaxAttempts: defaultRetryMaxAttempts,
+			Backoff:     Duration(defaultRetryBackoff),
+		},
+	}
+
+	if path := getenv(envConfigFile); path != "" {
+		data, err := readFile(path)
+		if err != nil {
+			return Config{}, fmt.Errorf("failed to read configuration file: %w", err)
+		}
+
+		if err = unmarshalConfig(path, data, &config); err != nil {
+			return Config{}, fmt.Errorf("failed to parse configuration file '%s': %w", path, err)
+		}
+	}
+
+	var problems []string
+
+	applyEnv(getenv, &config, &problems)
+
+	problems = append(problems, config.Validate()...)
+	if len(problems) > 0 {
+		return Config{}, ConfigError{Problems: problems}
+	}
+
+	return config, nil
+}
+
+func unmarshalConfig(path string, data []byte, config *Config) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		decoder := json.NewDecoder(strings.NewReader(string(data)))
+		decoder.DisallowUnknownFields()
+
+		return decoder.Decode(config)
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(strings.NewReader(string(data)))
+		decoder.KnownFields(true)
+
+		return decoder.Decode(config)
+	}
+
+	return fmt.Errorf("unsupported file extension '%s', expected .json, .yaml or .yml", filepath.Ext(path))
+}
+
+func applyEnv(getenv func(string) string, config *Config, problems *[]string) {
+	setString := func(name string, target *string) {
+		if value := getenv(name); value != "" {
+			*target = value
+		}
+	}
+
+	setString(envProviderType, &config.Provider.Type)
+	setString(envCredentialsSecret, &config.Provider.CredentialsSecret)
+	setString(envUsername, &config.Provider.Username)
+	setString(envPassword, &config.Provider.Password)
+	setString(envEndpoint, &config.Provider.Endpoint)
+	setString(envTokenType, &config.Provider.TokenType)
+	setString(envServiceName, &config.Logging.Service)
+	setString(envRevocationURL, &config.Revocation.URL)
+
+	if value := getenv(envRevocationSecrets); value != "" {
+		config.Revocation.SecretIDs = strings.Split(value, ",")
+	}
+
+	if value := getenv(envAudience); value != "" {
+		config.Testers = append(config.Testers, TesterConfig{Type: testerAudience, Audience: value})
+	}
+
+	if value := getenv(envProbeURL); value != "" {
+		config.Testers = append(config.Testers, TesterConfig{Type: testerHTTPProbe, URL: value})
+	}
+
+	if value := getenv(envCurrentProbeURL); value != "" {
+		config.CurrentTokenCheck.Testers = append(config.CurrentTokenCheck.Testers, TesterConfig{Type: testerHTTPProbe, URL: value})
+	}
+
+	setDuration := func(name string, target *Duration) {
+		if value := getenv(name); value != "" {
+			if err := target.parse(value); err != nil {
+				*problems = append(*problems, fmt.Sprintf("%s: '%s' is not a valid duration", name, value))
+			}
+		}
+	}
+
+	setDuration(envMinLifetime, &config.MinLifetime)
+	setDuration(envRetryBackoff, &config.Retry.Backoff)
+	setDuration(envGracePeriod, &config.Revocation.GracePeriod)
+
+	setBool := func(name string, target *bool) {
+		if value := getenv(name); value != "" {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				*problems = append(*problems, fmt.Sprintf("%s: '%s' is not a boolean", name, value))
+				return
+			}
+
+			*target = parsed
+		}
+	}
+
+	setBool(envBootstrap, &config.Bootstrap)
+	setBool(envRemoveStalePending, &config.RemoveStalePending)
+	setBool(envFailOnRevoked, &config.CurrentTokenCheck.FailOnRevoked)
+	setBool(envDatadog, &config.Tracing.Datadog)
+
+	if value := getenv(envRetryMaxAttempts); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			*problems = append(*problems, fmt.Sprintf("%s: '%s' is not an integer", envRetryMaxAttempts, value))
+			return
+		}
+
+		config.Retry.MaxAttempts = parsed
+	}
+}
+
+// Validate returns every problem found in the configuration.
+func (c Config) Validate() []string {
+	var problems []string
+
+	switch c.Provider.Type {
+	case jwtrotator.ProviderSecretCredentials:
+		if c.Provider.CredentialsSecret == "" {
+			problems = append(problems, "provider.credentialsSecret: required by the secret-credentials provider")
+		}
+	case providerCredentials:
+		if c.Provider.Username == "" {
+			problems = append(problems, "provider.username: required by the credentials provider")
+		}
+
+		if c.Provider.Password == "" {
+			problems = append(problems, "provider.password: required by the credentials provider")
+		}
+
+		problems = append(problems, validateURL("provider.signInUrl", c.Provider.Endpoint)...)
+	case "":
+		problems = append(problems, "provider.type: required")
+	default:
+		problems = append(problems, fmt.Sprintf("provider.type: unknown provider '%s', expected %s or %s", c.Provider.Type, jwtrotator.ProviderSecretCredentials, providerCredentials))
+	}
+
+	problems = append(problems, validateTesters("testers", c.Testers)...)
+	problems = append(problems, validateTesters("currentTokenCheck.testers", c.CurrentTokenCheck.Testers)...)
+
+	if c.MinLifetime < 0 {
+		problems = append(problems, "minLifetime: must not be negative")
+	}
+
+	if c.Revocation.URL != "" || len(c.Revocation.SecretIDs) > 0 {
+		problems = append(problems, validateURL("revocation.url", c.Revocation.URL)...)
+
+		if len(c.Revocation.SecretIDs) == 0 {
+			problems = append(problems, "revocation.secretIds: required to revoke tokens")
+		}
+
+		if c.Revocation.GracePeriod < 0 {
+			problems = append(problems, "revocation.gracePeriod: must not be negative")
+		}
+	}
+
+	if c.Retry.MaxAttempts < 1 {
+		problems = append(problems, "retry.maxAttempts: must be at least 1")
+	}
+
+	if c.Retry.Backoff < 0 {
+		problems = append(problems, "retry.backoff: must not be negative")
+	}
+
+	return problems
+}
+
+func validateTesters(field string, testers []TesterConfig) []string {
+	var problems []string
+
+	for i, tester := range testers {
+		testerField := fmt.Sprintf("%s[%d]", field, i)
+
+		switch tester.Type {
+		case testerAudience:
+			if tester.Audience == "" {
+				problems = append(problems, testerField+".audience: required by the audience tester")
+			}
+		case testerHTTPProbe, testerIntrospection:
+			problems = append(problems, validateURL(testerField+".url", tester.URL)...)
+		default:
+			problems = append(problems, fmt.Sprintf("%s.type: unknown tester '%s', expected %s, %s or %s", testerField, tester.Type, testerAudience, testerHTTPProbe, testerIntrospection))
+		}
+	}
+
+	return problems
+}
+
+func validateURL(field, value string) []string {
+	if value == "" {
+		return []string{field + ": required"}
+	}
+
+	if parsed, err := url.Parse(value); err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return []string{fmt.Sprintf("%s: '%s' is not an absolute URL", field, value)}
+	}
+
+	return nil
+}
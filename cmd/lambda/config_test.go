@@ -0,0 +1,222 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const yamlConfig = `
+provider:
+  type: secret-credentials
+  credentialsSecret: credentials/service-user
+testers:
+  - type: audience
+    audience: api
+  - type: http-probe
+    url: https://api.example.com/me
+minLifetime: 12h
+retry:
+  maxAttempts: 5
+  backoff: 500ms
+tracing:
+  datadog: true
+`
+
+func TestLoadConfig_File(t *testing.T) {
+	// Given
+	env := map[string]string{
+		envConfigFile:   "/etc/jwt-rotator.yaml",
+		envServiceName:  "jwt-rotator",
+		envRetryBackoff: "2s",
+	}
+
+	// When
+	config, err := LoadConfig(getenv(env), readFile("/etc/jwt-rotator.yaml", yamlConfig))
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, Config{
+		Provider: ProviderConfig{
+			Type:              "secret-credentials",
+			CredentialsSecret: "credentials/service-user",
+		},
+		Testers: []TesterConfig{
+			{Type: testerAudience, Audience: "api"},
+			{Type: testerHTTPProbe, URL: "https://api.example.com/me"},
+		},
+		MinLifetime: Duration(12 * time.Hour),
+		Retry:       RetryConfig{MaxAttempts: 5, Backoff: Duration(2 * time.Second)},
+		Logging:     LoggingConfig{Service: "jwt-rotator"},
+		Tracing:     TracingConfig{Datadog: true},
+	}, config)
+}
+
+func TestLoadConfig_JSONFile(t *testing.T) {
+	// Given
+	env := map[string]string{envConfigFile: "config.json"}
+	file := `{"provider": {"type": "credentials", "username": "user", "password": "secret", "signInUrl": "https://sso.example.com/sign-in"}}`
+
+	// When
+	config, err := LoadConfig(getenv(env), readFile("config.json", file))
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, "credentials", config.Provider.Type)
+	assert.Equal(t, defaultRetryMaxAttempts, config.Retry.MaxAttempts)
+}
+
+func TestLoadConfig_Env(t *testing.T) {
+	// Given
+	env := map[string]string{
+		envProviderType:       "secret-credentials",
+		envCredentialsSecret:  "credentials/service-user",
+		envAudience:           "api",
+		envBootstrap:          "true",
+		envRemoveStalePending: "true",
+		envCurrentProbeURL:    "https://api.example.com/me",
+		envFailOnRevoked:      "true",
+	}
+
+	// When
+	config, err := LoadConfig(getenv(env), readFile("", ""))
+
+	// Then
+	require.NoError(t, err)
+	assert.True(t, config.Bootstrap)
+	assert.True(t, config.RemoveStalePending)
+	assert.Equal(t, []TesterConfig{{Type: testerAudience, Audience: "api"}}, config.Testers)
+	assert.Equal(t, CurrentTokenCheckConfig{
+		Testers:       []TesterConfig{{Type: testerHTTPProbe, URL: "https://api.example.com/me"}},
+		FailOnRevoked: true,
+	}, config.CurrentTokenCheck)
+}
+
+func TestLoadConfig_Invalid(t *testing.T) {
+	// Given
+	env := map[string]string{
+		envProviderType:     "credentials",
+		envEndpoint:         "sso.example.com",
+		envMinLifetime:      "a day",
+		envRetryMaxAttempts: "0",
+		envDatadog:          "maybe",
+	}
+
+	// When
+	_, err := LoadConfig(getenv(env), readFile("", ""))
+
+	// Then
+	var configErr ConfigError
+	require.True(t, errors.As(err, &configErr))
+	assert.ElementsMatch(t, []string{
+		"JWT_ROTATOR_MIN_LIFETIME: 'a day' is not a valid duration",
+		"JWT_ROTATOR_DATADOG: 'maybe' is not a boolean",
+		"provider.username: required by the credentials provider",
+		"provider.password: required by the credentials provider",
+		"provider.signInUrl: 'sso.example.com' is not an absolute URL",
+		"retry.maxAttempts: must be at least 1",
+	}, configErr.Problems)
+}
+
+func TestLoadConfig_CurrentTokenCheck(t *testing.T) {
+	// Given
+	env := map[string]string{envConfigFile: "config.yml"}
+	file := `
+provider:
+  type: secret-credentials
+  credentialsSecret: credentials/service-user
+currentTokenCheck:
+  testers:
+    - type: introspection
+      url: https://sso.example.com/introspect
+      clientId: rotator
+    - type: introspection
+    - type: userinfo
+`
+
+	// When
+	_, err := LoadConfig(getenv(env), readFile("config.yml", file))
+
+	// Then
+	var configErr ConfigError
+	require.True(t, errors.As(err, &configErr))
+	assert.ElementsMatch(t, []string{
+		"currentTokenCheck.testers[1].url: required",
+		"currentTokenCheck.testers[2].type: unknown tester 'userinfo', expected audience, http-probe or introspection",
+	}, configErr.Problems)
+}
+
+func TestLoadConfig_Revocation(t *testing.T) {
+	// Given
+	env := map[string]string{
+		envProviderType:      "secret-credentials",
+		envCredentialsSecret: "credentials/service-user",
+		envRevocationURL:     "https://sso.example.com/oauth2/revoke",
+		envGracePeriod:       "6h",
+		envRevocationSecrets: "service-a/token,service-b/token",
+	}
+
+	// When
+	config, err := LoadConfig(getenv(env), readFile("", ""))
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, RevocationConfig{
+		URL:         "https://sso.example.com/oauth2/revoke",
+		GracePeriod: Duration(6 * time.Hour),
+		SecretIDs:   []string{"service-a/token", "service-b/token"},
+	}, config.Revocation)
+}
+
+func TestLoadConfig_RevocationInvalid(t *testing.T) {
+	// Given
+	env := map[string]string{
+		envProviderType:      "secret-credentials",
+		envCredentialsSecret: "credentials/service-user",
+		envGracePeriod:       "-1h",
+		envRevocationURL:     "sso.example.com",
+	}
+
+	// When
+	_, err := LoadConfig(getenv(env), readFile("", ""))
+
+	// Then
+	var configErr ConfigError
+	require.True(t, errors.As(err, &configErr))
+	assert.ElementsMatch(t, []string{
+		"revocation.url: 'sso.example.com' is not an absolute URL",
+		"revocation.secretIds: required to revoke tokens",
+		"revocation.gracePeriod: must not be negative",
+	}, configErr.Problems)
+}
+
+func TestLoadConfig_UnknownField(t *testing.T) {
+	// Given
+	env := map[string]string{envConfigFile: "config.yml"}
+
+	// When
+	_, err := LoadConfig(getenv(env), readFile("config.yml", "provider:\n  typo: secret-credentials\n"))
+
+	// Then
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "field typo not found")
+}
+
+func getenv(env map[string]string) func(string) string {
+	return func(name string) string {
+		return env[name]
+	}
+}
+
+func readFile(path, content string) func(string) ([]byte, error) {
+	return func(name string) ([]byte, error) {
+		if name != path {
+			return nil, errors.New("file not found")
+		}
+
+		return []byte(content), nil
+	}
+}
@@ -0,0 +1,152 @@
+// Command lambda is the supported JWT rotator lambda. It is configured with a
+// JSON or YAML file and/or environment variables, see Config.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	ddlambda "github.com/DataDog/datadog-lambda-go"
+	"github.com/SKF/go-rest-utility/client/auth"
+	"github.com/SKF/go-utility/v2/log"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator"
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator/scheduler"
+)
+
+func main() {
+	config, err := LoadConfig(os.Getenv, os.ReadFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if config.Logging.Service != "" {
+		log.SetDefaultService(config.Logging.Service)
+	}
+
+	sess := session.Must(session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+	}))
+
+	handle := newHandler(newRotator(config, secretsmanager.New(sess)), config.Revocation.SecretIDs)
+
+	var handler interface{} = handle
+	if config.Tracing.Datadog {
+		handler = ddlambda.WrapFunction(handle, &ddlambda.Config{
+			DDTraceEnabled: true,
+			// ShouldUseLogForwarder flushes traces and metrics to CloudWatch
+			ShouldUseLogForwarder: true,
+		})
+	}
+
+	lambda.Start(handler)
+}
+
+// scheduledEvent is the detail-type of the events EventBridge sends on a
+// schedule.
+const scheduledEvent = "Scheduled Event"
+
+// Event is either a rotation step sent by Secrets Manager or a scheduled event,
+// which revokes the outgoing tokens whose grace period has passed.
+type Event struct {
+	jwtrotator.SecretManagerEvent
+	DetailType string `json:"detail-type"`
+}
+
+func newHandler(jwtRotator jwtrotator.JWTRotator, revocationSecretIDs []string) func(context.Context, Event) error {
+	revocations := scheduler.Scheduler{
+		Revoker:   jwtRotator,
+		SecretIDs: revocationSecretIDs,
+	}
+
+	return func(ctx context.Context, event Event) error {
+		if event.DetailType != scheduledEvent {
+			return jwtRotator.Rotate(ctx, event.SecretManagerEvent)
+		}
+
+		if jwtRotator.Revocation.Revoker == nil {
+			return fmt.Errorf("received a scheduled event but revocation is not configured")
+		}
+
+		return revocations.RevokeAll(ctx)
+	}
+}
+
+func newRotator(config Config, client *secretsmanager.SecretsManager) jwtrotator.JWTRotator {
+	return jwtrotator.JWTRotator{
+		SecretsManager:     client,
+		TokenProvider:      newRetryingTokenProvider(newTokenProvider(config.Provider, client), config.Retry),
+		Testers:            newTesters(config.Testers),
+		MinLifetime:        config.MinLifetime.Duration(),
+		Bootstrap:          config.Bootstrap,
+		RemoveStalePending: config.RemoveStalePending,
+		CurrentTokenCheck: jwtrotator.CurrentTokenCheck{
+			Testers:       newTesters(config.CurrentTokenCheck.Testers),
+			FailOnRevoked: config.CurrentTokenCheck.FailOnRevoked,
+		},
+		Revocation: newRevocation(config.Revocation),
+	}
+}
+
+func newRevocation(config RevocationConfig) jwtrotator.Revocation {
+	if config.URL == "" {
+		return jwtrotator.Revocation{}
+	}
+
+	return jwtrotator.Revocation{
+		Revoker: jwtrotator.OAuthRevoker{
+			URL:           config.URL,
+			ClientID:      config.ClientID,
+			ClientSecret:  config.ClientSecret,
+			TokenTypeHint: config.TokenTypeHint,
+		},
+		GracePeriod: config.GracePeriod.Duration(),
+	}
+}
+
+func newTokenProvider(config ProviderConfig, client *secretsmanager.SecretsManager) auth.TokenProvider {
+	if config.Type == providerCredentials {
+		return &auth.CredentialsTokenProvider{
+			Username:  config.Username,
+			Password:  config.Password,
+			Endpoint:  config.Endpoint,
+			TokenType: config.TokenType,
+		}
+	}
+
+	return &auth.SecretCredentialsTokenProvider{
+		SecretID:      config.CredentialsSecret,
+		SecretsClient: auth.SecretsManagerV1Client{SecretsManager: client},
+		TokenType:     config.TokenType,
+	}
+}
+
+func newTesters(configs []TesterConfig) []jwtrotator.Tester {
+	testers := make([]jwtrotator.Tester, 0, len(configs))
+
+	for _, config := range configs {
+		switch config.Type {
+		case testerAudience:
+			testers = append(testers, jwtrotator.AudienceTester{Audience: config.Audience})
+		case testerHTTPProbe:
+			testers = append(testers, jwtrotator.HTTPProbeTester{
+				URL:            config.URL,
+				Method:         config.Method,
+				ExpectedStatus: config.ExpectedStatus,
+			})
+		case testerIntrospection:
+			testers = append(testers, jwtrotator.IntrospectionTester{
+				URL:          config.URL,
+				ClientID:     config.ClientID,
+				ClientSecret: config.ClientSecret,
+			})
+		}
+	}
+
+	return testers
+}
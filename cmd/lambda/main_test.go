@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/SKF/go-rest-utility/client/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator"
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator/filestore"
+	step2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/step"
+)
+
+func TestEvent_Unmarshal(t *testing.T) {
+	// Given
+	rotation := `{"Step": "createSecret", "SecretId": "secret", "ClientRequestToken": "version"}`
+	scheduled := `{"version": "0", "detail-type": "Scheduled Event", "source": "aws.events", "detail": {}}`
+
+	// When
+	var rotationEvent, scheduledEvent Event
+	require.NoError(t, json.Unmarshal([]byte(rotation), &rotationEvent))
+	require.NoError(t, json.Unmarshal([]byte(scheduled), &scheduledEvent))
+
+	// Then
+	assert.Equal(t, step2.CreateSecret, rotationEvent.Step)
+	assert.Equal(t, "secret", rotationEvent.SecretID)
+	assert.Empty(t, rotationEvent.DetailType)
+	assert.Equal(t, "Scheduled Event", scheduledEvent.DetailType)
+}
+
+func TestHandler_ScheduledEvent(t *testing.T) {
+	// Given
+	store := filestore.Store{Dir: t.TempDir()}
+	revoker := jwtrotator.RevokerFunc(func(context.Context, auth.RawToken) error { return nil })
+
+	withRevocation := newHandler(jwtrotator.JWTRotator{Store: store, Revocation: jwtrotator.Revocation{Revoker: revoker}}, []string{"missing"})
+	withoutRevocation := newHandler(jwtrotator.JWTRotator{Store: store}, nil)
+
+	// When
+	revokeErr := withRevocation(context.Background(), Event{DetailType: scheduledEvent})
+	unconfiguredErr := withoutRevocation(context.Background(), Event{DetailType: scheduledEvent})
+
+	// Then
+	require.Error(t, revokeErr)
+	assert.Contains(t, revokeErr.Error(), "failed to revoke 1 of 1 secrets: missing")
+	require.Error(t, unconfiguredErr)
+	assert.Contains(t, unconfiguredErr.Error(), "revocation is not configured")
+}
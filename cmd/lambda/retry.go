@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/SKF/go-rest-utility/client/auth"
+	"github.com/SKF/go-utility/v2/log"
+
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator"
+)
+
+// retryingTokenProvider retries transient failures of the wrapped provider
+// according to the configured retry policy.
+type retryingTokenProvider struct {
+	auth.TokenProvider
+	retry RetryConfig
+}
+
+// retryingRefresher is a retryingTokenProvider which also retries the
+// refreshes of a wrapped jwtrotator.Refresher.
+type retryingRefresher struct {
+	*retryingTokenProvider
+	refresher jwtrotator.Refresher
+}
+
+// newRetryingTokenProvider wraps tokenProvider with retries, the result is a
+// jwtrotator.Refresher only when tokenProvider is one.
+func newRetryingTokenProvider(tokenProvider auth.TokenProvider, retry RetryConfig) auth.TokenProvider {
+	provider := &retryingTokenProvider{TokenProvider: tokenProvider, retry: retry}
+
+	if refresher, ok := tokenProvider.(jwtrotator.Refresher); ok {
+		return &retryingRefresher{retryingTokenProvider: provider, refresher: refresher}
+	}
+
+	return provider
+}
+
+func (p *retryingTokenProvider) GetRawToken(ctx context.Context) (auth.RawToken, error) {
+	return p.withRetry(ctx, p.TokenProvider.GetRawToken)
+}
+
+func (p *retryingRefresher) RefreshRawToken(ctx context.Context) (auth.RawToken, error) {
+	return p.withRetry(ctx, p.refresher.RefreshRawToken)
+}
+
+func (p *retryingTokenProvider) withRetry(ctx context.Context, getRawToken func(context.Context) (auth.RawToken, error)) (auth.RawToken, error) {
+	backoff := p.retry.Backoff.Duration()
+
+	for attempt := 1; ; attempt++ {
+		token, err := getRawToken(ctx)
+		if err == nil || attempt >= p.retry.MaxAttempts || isPermanent(err) {
+			return token, err
+		}
+
+		log.WithTracing(ctx).WithError(err).Warnf("Failed to get token on attempt %d of %d, retrying in %s", attempt, p.retry.MaxAttempts, backoff)
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+	}
+}
+
+// isPermanent reports whether retrying err is pointless.
+func isPermanent(err error) bool {
+	return errors.Is(err, auth.ErrIncorrectCredentials) ||
+		errors.Is(err, auth.ErrChallenged) ||
+		errors.Is(err, auth.ErrInactivated) ||
+		errors.Is(err, auth.ErrUnknownTokenType)
+}
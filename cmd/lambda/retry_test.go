@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/SKF/go-rest-utility/client/auth"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator"
+)
+
+type flakyTokenProvider struct {
+	errs  []error
+	calls int
+}
+
+func (p *flakyTokenProvider) GetRawToken(context.Context) (auth.RawToken, error) {
+	p.calls++
+
+	if len(p.errs) > 0 {
+		err := p.errs[0]
+		p.errs = p.errs[1:]
+
+		return "", err
+	}
+
+	return "token", nil
+}
+
+func TestRetryingTokenProvider(t *testing.T) {
+	testCases := []struct {
+		name          string
+		errs          []error
+		expectedCalls int
+		expectedErr   error
+	}{
+		{name: "succeeds after transient errors", errs: []error{auth.ErrTooManyRequests, errors.New("timeout")}, expectedCalls: 3},
+		{name: "gives up after max attempts", errs: []error{auth.ErrTooManyRequests, auth.ErrTooManyRequests, auth.ErrTooManyRequests}, expectedCalls: 3, expectedErr: auth.ErrTooManyRequests},
+		{name: "does not retry permanent errors", errs: []error{auth.ErrIncorrectCredentials}, expectedCalls: 1, expectedErr: auth.ErrIncorrectCredentials},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			flaky := &flakyTokenProvider{errs: tc.errs}
+			provider := retryingTokenProvider{TokenProvider: flaky, retry: RetryConfig{MaxAttempts: 3}}
+
+			_, err := provider.GetRawToken(context.Background())
+
+			assert.Equal(t, tc.expectedCalls, flaky.calls)
+
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+type refreshingTokenProvider struct {
+	flakyTokenProvider
+	refreshes int
+}
+
+func (p *refreshingTokenProvider) RefreshRawToken(context.Context) (auth.RawToken, error) {
+	p.refreshes++
+
+	return "refreshed", nil
+}
+
+func TestRetryingTokenProvider_Refresh(t *testing.T) {
+	refreshing := &refreshingTokenProvider{}
+	flaky := &flakyTokenProvider{errs: []error{auth.ErrTooManyRequests}}
+
+	refresher, isRefresher := newRetryingTokenProvider(refreshing, RetryConfig{MaxAttempts: 3}).(jwtrotator.Refresher)
+	assert.True(t, isRefresher)
+
+	refreshed, err := refresher.RefreshRawToken(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, auth.RawToken("refreshed"), refreshed)
+	assert.Equal(t, 1, refreshing.refreshes)
+	assert.Equal(t, 0, refreshing.calls)
+
+	signingIn := newRetryingTokenProvider(flaky, RetryConfig{MaxAttempts: 3})
+	_, isRefresher = signingIn.(jwtrotator.Refresher)
+	assert.False(t, isRefresher, "providers without a cache must not be refreshed")
+
+	signedIn, err := signingIn.GetRawToken(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, auth.RawToken("token"), signedIn)
+	assert.Equal(t, 2, flaky.calls)
+}
@@ -36,6 +36,7 @@ data "aws_iam_policy_document" "jwt-rotator" {
       "secretsmanager:DescribeSecret",
       "secretsmanager:GetSecretValue",
       "secretsmanager:PutSecretValue",
+      "secretsmanager:TagResource",
       "secretsmanager:UpdateSecretVersionStage"
     ]
 
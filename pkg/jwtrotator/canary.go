@@ -0,0 +1,109 @@
+package jwtrotator
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/SKF/go-utility/v2/log"
+	"github.com/google/uuid"
+
+	versionstage2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/versionstage"
+)
+
+func (h JWTRotator) canaryStage() (versionstage2.VersionStage, error) {
+	if h.CanaryStage == "" {
+		return versionstage2.JWTCanary, nil
+	}
+
+	return versionstage2.Custom(string(h.CanaryStage))
+}
+
+// StageCanary provisions a new token and labels its version with the canary
+// stage, so it can be rolled out to some consumers first. AWSCURRENT and any
+// rotation in progress are left untouched until the canary is promoted with
+// PromoteCanary. The token must pass the same checks as in the testSecret
+// step, a rejected token is not stored. It returns the ID of the new version.
+func (h JWTRotator) StageCanary(ctx context.Context, secretID string) (string, error) {
+	stage, err := h.canaryStage()
+	if err != nil {
+		return "", fmt.Errorf("invalid canary stage: %w", err)
+	}
+
+	version := secretVersion{
+		SecretID:           secretID,
+		ClientRequestToken: uuid.New().String(),
+	}
+
+	storedToken, err := h.newToken(ctx, version)
+	if err != nil {
+		return "", fmt.Errorf("failed to provision canary token: %w", err)
+	}
+
+	if err = h.validateToken(ctx, storedToken, string(stage)); err != nil {
+		return "", fmt.Errorf("refusing to stage canary token: %w", err)
+	}
+
+	if err = h.checkCurrentToken(ctx, version, storedToken); err != nil {
+		return "", err
+	}
+
+	if err = h.storeToken(ctx, version, storedToken, stage); err != nil {
+		return "", err
+	}
+
+	log.WithTracing(ctx).Infof("Labelled versionID: %s of secret %s %s, it becomes %s once promoted", version.ClientRequestToken, secretID, stage, versionstage2.AwsCurrent)
+
+	return version.ClientRequestToken, nil
+}
+
+// PromoteCanary promotes the version labelled with the canary stage to
+// AWSCURRENT and removes the canary label. The canary token must pass the
+// same checks as in the testSecret step, the demoted version becomes
+// AWSPREVIOUS. It returns the ID of the promoted version.
+func (h JWTRotator) PromoteCanary(ctx context.Context, secretID string) (string, error) {
+	stage, err := h.canaryStage()
+	if err != nil {
+		return "", fmt.Errorf("invalid canary stage: %w", err)
+	}
+
+	metadata, err := h.store().DescribeSecret(ctx, secretID)
+	if err != nil {
+		return "", fmt.Errorf("failed to describe secret with id '%s': %w", secretID, err)
+	}
+
+	canaryVersion, ok := metadata.VersionWithStage(stage)
+	if !ok {
+		return "", fmt.Errorf("failed to promote canary: %w: no secret with stage %s found", ErrResourceNotFound, stage)
+	}
+
+	currentVersion, ok := metadata.VersionWithStage(versionstage2.AwsCurrent)
+	if !ok {
+		return "", fmt.Errorf("failed to promote canary: %w: no secret with stage %s found", ErrResourceNotFound, versionstage2.AwsCurrent)
+	}
+
+	if canaryVersion != currentVersion {
+		var storedToken StoredToken
+
+		if storedToken, err = h.getSecret(ctx, secretID, canaryVersion, stage); err != nil {
+			return "", fmt.Errorf("failed to get canary secret: %w", err)
+		}
+
+		if err = h.validateToken(ctx, storedToken, string(stage)); err != nil {
+			return "", fmt.Errorf("refusing to promote canary version %s: %w", canaryVersion, err)
+		}
+
+		if err = h.store().MoveStage(ctx, secretID, versionstage2.AwsCurrent, canaryVersion, currentVersion); err != nil {
+			return "", fmt.Errorf("failed to update secret from %s to CURRENT: %w", stage, err)
+		}
+
+		h.recordPromotion(ctx, secretID, canaryVersion)
+	}
+
+	if err = h.store().MoveStage(ctx, secretID, stage, "", canaryVersion); err != nil {
+		return "", fmt.Errorf("failed to remove %s from the promoted version: %w", stage, err)
+	}
+
+	log.WithTracing(ctx).Infof("Promoted %s versionID: %s of secret %s to %s", stage, canaryVersion, secretID, versionstage2.AwsCurrent)
+
+	return canaryVersion, nil
+}
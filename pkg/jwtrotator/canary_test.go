@@ -0,0 +1,194 @@
+package jwtrotator_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/SKF/go-rest-utility/client/auth"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator"
+	inmemorysecretsmanager2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/testutils/inmemorysecretsmanager"
+	versionstage2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/versionstage"
+)
+
+func TestStageCanary(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store jwtrotator.SecretStore) {
+		// Given
+		ctx := context.Background()
+		initialToken := jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(time.Hour))}
+		initializeStore(t, store, initialToken)
+
+		tokenProvider := &JWTProviderStub{t: t}
+		jwtRotator := jwtrotator.JWTRotator{
+			Store:         store,
+			TokenProvider: tokenProvider,
+		}
+
+		// When
+		first, err := jwtRotator.StageCanary(ctx, secretToRotate)
+		require.NoError(t, err)
+
+		second, err := jwtRotator.StageCanary(ctx, secretToRotate)
+		require.NoError(t, err)
+
+		// Then
+		assert.Equal(t, initialToken, getCurrentToken(t, store))
+		assert.Equal(t, tokenProvider.issued[1], getTokenByStage(t, store, versionstage2.JWTCanary).RawToken)
+
+		metadata, err := store.DescribeSecret(ctx, secretToRotate)
+		require.NoError(t, err)
+		assert.Equal(t, []versionstage2.VersionStage{versionstage2.JWTCanary}, metadata.Versions[second])
+		assert.Empty(t, metadata.Versions[first])
+	})
+}
+
+func TestStageCanary_RejectedByTester(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	store := storeFactories["SecretsManagerV1"](t)
+	initializeStore(t, store, jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(time.Hour))})
+
+	jwtRotator := jwtrotator.JWTRotator{
+		Store:         store,
+		TokenProvider: &JWTProviderStub{t: t},
+		Testers: []jwtrotator.Tester{
+			jwtrotator.TesterFunc(func(context.Context, auth.RawToken) error {
+				return fmt.Errorf("rejected by API")
+			}),
+		},
+	}
+
+	// When
+	_, err := jwtRotator.StageCanary(ctx, secretToRotate)
+
+	// Then
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "rejected by API")
+
+	metadata, err := store.DescribeSecret(ctx, secretToRotate)
+	require.NoError(t, err)
+	assert.Len(t, metadata.Versions, 1)
+}
+
+func TestStageCanary_RotateSecret(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	secretsManager := inmemorysecretsmanager2.New()
+	store := jwtrotator.SecretsManagerStore{Client: secretsManager}
+	initializeStore(t, store, jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(time.Hour))})
+
+	jwtRotator := jwtrotator.JWTRotator{
+		SecretsManager: secretsManager,
+		TokenProvider:  &JWTProviderStub{t: t},
+		CanaryStage:    "BLUE",
+	}
+	secretsManager.RegisterRotationFunction(rotationLambdaARN, jwtRotator.Rotate)
+
+	canaryVersion, err := jwtRotator.StageCanary(ctx, secretToRotate)
+	require.NoError(t, err)
+
+	// When
+	output, err := secretsManager.RotateSecretWithContext(ctx, &secretsmanager.RotateSecretInput{
+		SecretId:          aws.String(secretToRotate),
+		RotationLambdaARN: aws.String(rotationLambdaARN),
+	})
+
+	// Then
+	require.NoError(t, err)
+
+	metadata, err := store.DescribeSecret(ctx, secretToRotate)
+	require.NoError(t, err)
+	assert.Equal(t, []versionstage2.VersionStage{versionstage2.AwsCurrent}, metadata.Versions[aws.StringValue(output.VersionId)])
+	assert.Equal(t, []versionstage2.VersionStage{"BLUE"}, metadata.Versions[canaryVersion])
+}
+
+func TestPromoteCanary(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store jwtrotator.SecretStore) {
+		// Given
+		ctx := context.Background()
+		initializeStore(t, store, jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(time.Hour))})
+
+		canaryToken := newJWT(t, time.Now().Add(time.Hour))
+		putToken(t, store, version0, jwtrotator.StoredToken{RawToken: canaryToken}, versionstage2.JWTCanary)
+
+		jwtRotator := jwtrotator.JWTRotator{Store: store}
+
+		// When
+		promoted, err := jwtRotator.PromoteCanary(ctx, secretToRotate)
+
+		// Then
+		require.NoError(t, err)
+		assert.Equal(t, version0, promoted)
+		assert.Equal(t, canaryToken, getCurrentToken(t, store).RawToken)
+
+		metadata, err := store.DescribeSecret(ctx, secretToRotate)
+		require.NoError(t, err)
+		assert.Equal(t, []versionstage2.VersionStage{versionstage2.AwsCurrent}, metadata.Versions[version0])
+		assert.Equal(t, []versionstage2.VersionStage{versionstage2.AWSPrevious}, metadata.Versions[initialVersion])
+	})
+}
+
+func TestPromoteCanary_CustomStage(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	store := storeFactories["SecretsManagerV1"](t)
+	initializeStore(t, store, jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(time.Hour))})
+	putToken(t, store, version0, jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(time.Hour))}, "BLUE")
+
+	// When
+	promoted, err := jwtrotator.JWTRotator{Store: store, CanaryStage: "BLUE"}.PromoteCanary(ctx, secretToRotate)
+	_, reservedErr := jwtrotator.JWTRotator{Store: store, CanaryStage: versionstage2.AwsCurrent}.PromoteCanary(ctx, secretToRotate)
+	_, testedErr := jwtrotator.JWTRotator{Store: store, CanaryStage: versionstage2.JWTTested}.StageCanary(ctx, secretToRotate)
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, version0, promoted)
+	require.Error(t, reservedErr)
+	assert.Contains(t, reservedErr.Error(), "reserved")
+	require.Error(t, testedErr)
+	assert.Contains(t, testedErr.Error(), "reserved by the rotator")
+}
+
+func TestPromoteCanary_RejectedByTester(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	store := storeFactories["SecretsManagerV1"](t)
+	initialToken := jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(time.Hour))}
+	initializeStore(t, store, initialToken)
+	putToken(t, store, version0, jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(time.Hour))}, versionstage2.JWTCanary)
+
+	jwtRotator := jwtrotator.JWTRotator{
+		Store: store,
+		Testers: []jwtrotator.Tester{
+			jwtrotator.TesterFunc(func(context.Context, auth.RawToken) error {
+				return fmt.Errorf("rejected by API")
+			}),
+		},
+	}
+
+	// When
+	_, err := jwtRotator.PromoteCanary(ctx, secretToRotate)
+
+	// Then
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "rejected by API")
+	assert.Equal(t, initialToken, getCurrentToken(t, store))
+}
+
+func TestPromoteCanary_NoCanary(t *testing.T) {
+	// Given
+	store := storeFactories["SecretsManagerV1"](t)
+	initializeStore(t, store, jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(time.Hour))})
+
+	// When
+	_, err := jwtrotator.JWTRotator{Store: store}.PromoteCanary(context.Background(), secretToRotate)
+
+	// Then
+	assert.ErrorIs(t, err, jwtrotator.ErrResourceNotFound)
+}
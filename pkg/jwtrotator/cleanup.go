@@ -0,0 +1,80 @@
+package jwtrotator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/SKF/go-utility/v2/log"
+
+	versionstage2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/versionstage"
+)
+
+// StalePending is an AWSPENDING label found on a version of an abandoned
+// rotation.
+type StalePending struct {
+	SecretID  string `json:"secretId"`
+	VersionID string `json:"versionId"`
+	Reason    string `json:"reason"`
+	Removed   bool   `json:"removed"`
+}
+
+// CleanupStalePending removes the AWSPENDING labels Inspect reports as stale,
+// left on a version which expired or was never promoted within a day, from
+// each of the secrets. With dryRun set the labels are only reported.
+//
+// A failing secret does not stop the remaining secrets from being cleaned up,
+// all failures are returned together with the labels found.
+func (h JWTRotator) CleanupStalePending(ctx context.Context, secretIDs []string, dryRun bool) ([]StalePending, error) {
+	var (
+		found    []StalePending
+		failures []string
+	)
+
+	for _, secretID := range secretIDs {
+		stale, err := h.cleanupStalePending(ctx, secretID, dryRun)
+		found = append(found, stale...)
+
+		if err != nil {
+			log.WithTracing(ctx).WithError(err).Errorf("Failed to clean up stale %s of secret %s", versionstage2.AWSPending, secretID)
+			failures = append(failures, fmt.Sprintf("%s: %s", secretID, err))
+		}
+	}
+
+	if len(failures) > 0 {
+		return found, fmt.Errorf("failed to clean up %d of %d secrets: %s", len(failures), len(secretIDs), strings.Join(failures, "; "))
+	}
+
+	return found, nil
+}
+
+func (h JWTRotator) cleanupStalePending(ctx context.Context, secretID string, dryRun bool) ([]StalePending, error) {
+	report, err := h.Inspect(ctx, secretID)
+	if err != nil {
+		return nil, err
+	}
+
+	var found []StalePending
+
+	for _, problem := range report.Problems {
+		if problem.Kind != ProblemStalePending {
+			continue
+		}
+
+		stale := StalePending{SecretID: secretID, VersionID: problem.VersionID, Reason: problem.Message}
+
+		if !dryRun {
+			if err = h.store().MoveStage(ctx, secretID, versionstage2.AWSPending, "", problem.VersionID); err != nil {
+				return found, fmt.Errorf("failed to remove %s from version %s: %w", versionstage2.AWSPending, problem.VersionID, err)
+			}
+
+			stale.Removed = true
+
+			log.WithTracing(ctx).Infof("Removed stale %s from versionID: %s of secret %s: %s", versionstage2.AWSPending, problem.VersionID, secretID, problem.Message)
+		}
+
+		found = append(found, stale)
+	}
+
+	return found, nil
+}
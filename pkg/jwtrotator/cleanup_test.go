@@ -0,0 +1,126 @@
+package jwtrotator_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/SKF/go-rest-utility/client/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator"
+	step2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/step"
+	versionstage2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/versionstage"
+)
+
+const otherSecret = "secret/without/pending"
+
+func TestRotate_CreateSecret_RemoveStalePending(t *testing.T) {
+	for name, remove := range map[string]bool{"Keep": false, "Remove": true} {
+		remove := remove
+
+		t.Run(name, func(t *testing.T) {
+			forEachStore(t, func(t *testing.T, store jwtrotator.SecretStore) {
+				// Given
+				ctx := context.Background()
+				initializeStore(t, store, jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(time.Hour))})
+				putToken(t, store, version1, jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(time.Hour))}, versionstage2.AWSPending)
+
+				jwtRotator := jwtrotator.JWTRotator{
+					Store: store,
+					TokenProvider: tokenProviderFunc(func(context.Context) (auth.RawToken, error) {
+						return "", errors.New("provider unavailable")
+					}),
+					RemoveStalePending: remove,
+				}
+
+				// When
+				err := rotateStep(ctx, jwtRotator, step2.CreateSecret, version0)
+
+				// Then
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "provider unavailable")
+
+				metadata, err := store.DescribeSecret(ctx, secretToRotate)
+				require.NoError(t, err)
+
+				pendingVersion, ok := metadata.VersionWithStage(versionstage2.AWSPending)
+				if remove {
+					assert.False(t, ok, "expected no %s, found version %s", versionstage2.AWSPending, pendingVersion)
+				} else {
+					assert.Equal(t, version1, pendingVersion)
+				}
+			})
+		})
+	}
+}
+
+func TestCleanupStalePending(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store jwtrotator.SecretStore) {
+		// Given
+		ctx := context.Background()
+		initializeStore(t, store, jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(time.Hour))})
+		putToken(t, store, version0, jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(-time.Minute))}, versionstage2.AWSPending)
+
+		value, err := json.Marshal(jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(time.Hour))})
+		require.NoError(t, err)
+		require.NoError(t, store.PutSecretValue(ctx, otherSecret, initialVersion, value, []versionstage2.VersionStage{versionstage2.AwsCurrent}))
+
+		jwtRotator := jwtrotator.JWTRotator{Store: store}
+		secretIDs := []string{secretToRotate, otherSecret}
+
+		// When
+		dryRun, dryRunErr := jwtRotator.CleanupStalePending(ctx, secretIDs, true)
+		dryRunMetadata, err := store.DescribeSecret(ctx, secretToRotate)
+		require.NoError(t, err)
+
+		removed, removeErr := jwtRotator.CleanupStalePending(ctx, secretIDs, false)
+
+		// Then
+		require.NoError(t, dryRunErr)
+		require.Len(t, dryRun, 1)
+		assert.Equal(t, version0, dryRun[0].VersionID)
+		assert.False(t, dryRun[0].Removed)
+
+		pendingVersion, _ := dryRunMetadata.VersionWithStage(versionstage2.AWSPending)
+		assert.Equal(t, version0, pendingVersion)
+
+		require.NoError(t, removeErr)
+		require.Len(t, removed, 1)
+		assert.Equal(t, jwtrotator.StalePending{
+			SecretID:  secretToRotate,
+			VersionID: version0,
+			Reason:    dryRun[0].Reason,
+			Removed:   true,
+		}, removed[0])
+
+		metadata, err := store.DescribeSecret(ctx, secretToRotate)
+		require.NoError(t, err)
+
+		_, ok := metadata.VersionWithStage(versionstage2.AWSPending)
+		assert.False(t, ok)
+	})
+}
+
+func TestCleanupStalePending_ContinuesAfterFailure(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	store := storeFactories["SecretsManagerV1"](t)
+	initializeStore(t, store, jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(time.Hour))})
+	putToken(t, store, version0, jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(-time.Minute))}, versionstage2.AWSPending)
+
+	jwtRotator := jwtrotator.JWTRotator{Store: store}
+
+	// When
+	removed, err := jwtRotator.CleanupStalePending(ctx, []string{"secret/unknown", secretToRotate}, false)
+
+	// Then
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to clean up 1 of 2 secrets")
+	assert.Contains(t, err.Error(), "secret/unknown")
+	require.Len(t, removed, 1)
+	assert.True(t, removed[0].Removed)
+}
@@ -0,0 +1,64 @@
+package jwtrotator
+
+import (
+	"fmt"
+
+	"github.com/SKF/go-rest-utility/client/auth"
+)
+
+// CredentialSet is one of the credentials a JWTRotator alternates between.
+type CredentialSet struct {
+	// Name identifies the set, it is recorded in every StoredToken the set
+	// issues.
+	Name          string
+	TokenProvider auth.TokenProvider
+}
+
+// tokenProvider returns the provider, and the name of its credential set, for
+// the token after currentToken. Without CredentialSets it is TokenProvider.
+// Otherwise it is the set after the one which issued currentToken, so that
+// signing in again does not revoke the token consumers still use.
+func (h JWTRotator) tokenProvider(currentToken StoredToken) (string, auth.TokenProvider, error) {
+	if len(h.CredentialSets) == 0 {
+		return "", h.TokenProvider, nil
+	}
+
+	if err := validateCredentialSets(h.CredentialSets); err != nil {
+		return "", nil, err
+	}
+
+	next := 0
+
+	for i, set := range h.CredentialSets {
+		if set.Name == currentToken.CredentialSet {
+			next = (i + 1) % len(h.CredentialSets)
+			break
+		}
+	}
+
+	set := h.CredentialSets[next]
+
+	return set.Name, set.TokenProvider, nil
+}
+
+func validateCredentialSets(sets []CredentialSet) error {
+	names := make(map[string]bool, len(sets))
+
+	for i, set := range sets {
+		if set.Name == "" {
+			return fmt.Errorf("credential set %d has no name", i)
+		}
+
+		if names[set.Name] {
+			return fmt.Errorf("credential set name '%s' is used more than once", set.Name)
+		}
+
+		if set.TokenProvider == nil {
+			return fmt.Errorf("credential set '%s' has no token provider", set.Name)
+		}
+
+		names[set.Name] = true
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package jwtrotator_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator"
+)
+
+func TestRotate_CredentialSets(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store jwtrotator.SecretStore) {
+		// Given
+		ctx := context.Background()
+		initializeStore(t, store, jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(time.Hour))})
+
+		blue, green := &JWTProviderStub{t: t, name: "blue-"}, &JWTProviderStub{t: t, name: "green-"}
+		jwtRotator := jwtrotator.JWTRotator{
+			Store: store,
+			CredentialSets: []jwtrotator.CredentialSet{
+				{Name: "blue", TokenProvider: blue},
+				{Name: "green", TokenProvider: green},
+			},
+		}
+
+		var issuedBy []string
+
+		// When
+		for i := 0; i < 3; i++ {
+			_, err := jwtRotator.RotateNow(ctx, secretToRotate)
+			require.NoError(t, err)
+
+			issuedBy = append(issuedBy, getCurrentToken(t, store).CredentialSet)
+		}
+
+		// Then
+		assert.Equal(t, []string{"blue", "green", "blue"}, issuedBy)
+		assert.Len(t, blue.issued, 2)
+		assert.Len(t, green.issued, 1)
+		assert.Equal(t, jwtrotator.StoredToken{RawToken: green.issued[0], CredentialSet: "green"}, getTokenByStage(t, store, "AWSPREVIOUS"))
+	})
+}
+
+func TestRotate_CredentialSets_UnknownCurrent(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	store := storeFactories["SecretsManagerV1"](t)
+	initializeStore(t, store, jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(time.Hour)), CredentialSet: "removed"})
+
+	jwtRotator := jwtrotator.JWTRotator{
+		Store: store,
+		CredentialSets: []jwtrotator.CredentialSet{
+			{Name: "blue", TokenProvider: &JWTProviderStub{t: t}},
+			{Name: "green", TokenProvider: &JWTProviderStub{t: t}},
+		},
+	}
+
+	// When
+	_, err := jwtRotator.RotateNow(ctx, secretToRotate)
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, "blue", getCurrentToken(t, store).CredentialSet)
+}
+
+func TestRotate_CredentialSets_Invalid(t *testing.T) {
+	for name, sets := range map[string][]jwtrotator.CredentialSet{
+		"no name":        {{TokenProvider: &JWTProviderStub{t: t}}},
+		"duplicate name": {{Name: "blue", TokenProvider: &JWTProviderStub{t: t}}, {Name: "blue", TokenProvider: &JWTProviderStub{t: t}}},
+		"no provider":    {{Name: "blue"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			// Given
+			store := storeFactories["SecretsManagerV1"](t)
+			initializeStore(t, store, jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(time.Hour))})
+
+			// When
+			_, err := jwtrotator.JWTRotator{Store: store, CredentialSets: sets}.RotateNow(context.Background(), secretToRotate)
+
+			// Then
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "failed to select credential set")
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package jwtrotator
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/SKF/go-utility/v2/log"
+)
+
+// CurrentTokenCheck detects identity providers which invalidate the previous
+// token when a new one is issued. Consumers keep using the AWSCURRENT token
+// until the rotation finishes, so such a provider breaks them in between.
+type CurrentTokenCheck struct {
+	// Testers are run against the AWSCURRENT token, e.g. an HTTPProbeTester
+	// or an IntrospectionTester. The check is disabled without testers.
+	Testers []Tester
+
+	// FailOnRevoked fails the testSecret step when a tester rejects the
+	// AWSCURRENT token, otherwise a warning is logged.
+	FailOnRevoked bool
+}
+
+// checkCurrentToken runs the CurrentTokenCheck testers against the AWSCURRENT
+// token, once the PENDING token of the rotation has been minted. An expired
+// current token is not reported, it has not been revoked by the rotation.
+func (h JWTRotator) checkCurrentToken(ctx context.Context, version secretVersion, pendingToken StoredToken) error {
+	if len(h.CurrentTokenCheck.Testers) == 0 {
+		return nil
+	}
+
+	currentToken, err := h.getCurrentSecret(ctx, version.SecretID)
+	if err != nil {
+		return fmt.Errorf("failed to get current secret: %w", err)
+	}
+
+	if currentToken.RawToken == pendingToken.RawToken {
+		return nil
+	}
+
+	if expiry, parseErr := currentToken.RawToken.ParseExpires(); parseErr == nil && time.Now().After(expiry) {
+		return nil
+	}
+
+	for _, tester := range h.CurrentTokenCheck.Testers {
+		if err = tester.Test(ctx, currentToken.RawToken); err == nil {
+			continue
+		}
+
+		err = fmt.Errorf("%w after minting versionID: %s: %s", ErrCurrentTokenRevoked, version.ClientRequestToken, err)
+		if h.CurrentTokenCheck.FailOnRevoked {
+			return err
+		}
+
+		log.WithTracing(ctx).Warnf("Secret %s: %s, the provider invalidates earlier tokens and consumers fail until the rotation finishes", version.SecretID, err)
+
+		return nil
+	}
+
+	return nil
+}
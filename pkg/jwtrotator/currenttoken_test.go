@@ -0,0 +1,102 @@
+package jwtrotator_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/SKF/go-rest-utility/client/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator"
+	step2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/step"
+)
+
+func TestRotate_CurrentTokenCheck(t *testing.T) {
+	for name, test := range map[string]struct {
+		revoked       bool
+		failOnRevoked bool
+		expectedErr   error
+	}{
+		"accepted":          {},
+		"revoked, warn":     {revoked: true},
+		"revoked, fail":     {revoked: true, failOnRevoked: true, expectedErr: jwtrotator.ErrCurrentTokenRevoked},
+		"accepted, fail on": {failOnRevoked: true},
+	} {
+		test := test
+
+		t.Run(name, func(t *testing.T) {
+			// Given
+			ctx := context.Background()
+			store := storeFactories["SecretsManagerV1"](t)
+			initialToken := jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(time.Hour))}
+			initializeStore(t, store, initialToken)
+
+			var tested []auth.RawToken
+
+			jwtRotator := jwtrotator.JWTRotator{
+				Store:         store,
+				TokenProvider: &JWTProviderStub{t: t},
+				CurrentTokenCheck: jwtrotator.CurrentTokenCheck{
+					Testers: []jwtrotator.Tester{
+						jwtrotator.TesterFunc(func(_ context.Context, token auth.RawToken) error {
+							tested = append(tested, token)
+
+							if test.revoked {
+								return fmt.Errorf("token revoked")
+							}
+
+							return nil
+						}),
+					},
+					FailOnRevoked: test.failOnRevoked,
+				},
+			}
+
+			require.NoError(t, rotateStep(ctx, jwtRotator, step2.CreateSecret, version0))
+
+			// When
+			err := rotateStep(ctx, jwtRotator, step2.TestSecret, version0)
+
+			// Then
+			if test.expectedErr != nil {
+				assert.ErrorIs(t, err, test.expectedErr)
+				assert.Contains(t, err.Error(), "token revoked")
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.Equal(t, []auth.RawToken{initialToken.RawToken}, tested)
+		})
+	}
+}
+
+func TestRotate_CurrentTokenCheck_ExpiredCurrent(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	store := storeFactories["SecretsManagerV1"](t)
+	initializeStore(t, store, jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(-time.Hour))})
+
+	jwtRotator := jwtrotator.JWTRotator{
+		Store:         store,
+		TokenProvider: &JWTProviderStub{t: t},
+		CurrentTokenCheck: jwtrotator.CurrentTokenCheck{
+			Testers: []jwtrotator.Tester{
+				jwtrotator.TesterFunc(func(context.Context, auth.RawToken) error {
+					return fmt.Errorf("token expired")
+				}),
+			},
+			FailOnRevoked: true,
+		},
+	}
+
+	require.NoError(t, rotateStep(ctx, jwtRotator, step2.CreateSecret, version0))
+
+	// When
+	err := rotateStep(ctx, jwtRotator, step2.TestSecret, version0)
+
+	// Then
+	assert.NoError(t, err)
+}
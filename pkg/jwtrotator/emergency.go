@@ -0,0 +1,143 @@
+package jwtrotator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/SKF/go-utility/v2/log"
+
+	versionstage2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/versionstage"
+)
+
+type AuditAction string
+
+const (
+	AuditRevoke          AuditAction = "revoke"
+	AuditMarkCompromised AuditAction = "mark-compromised"
+	AuditRotate          AuditAction = "rotate"
+)
+
+// AuditEntry records one action taken by EmergencyRotate.
+type AuditEntry struct {
+	Time        time.Time   `json:"time"`
+	Action      AuditAction `json:"action"`
+	SecretID    string      `json:"secretId"`
+	VersionID   string      `json:"versionId,omitempty"`
+	Fingerprint string      `json:"fingerprint,omitempty"`
+	Reason      string      `json:"reason"`
+	Error       string      `json:"error,omitempty"`
+}
+
+// EmergencyRotation is the outcome of EmergencyRotate, Audit lists every
+// action in the order it was taken.
+type EmergencyRotation struct {
+	SecretID           string       `json:"secretId"`
+	CompromisedVersion string       `json:"compromisedVersion"`
+	NewVersion         string       `json:"newVersion,omitempty"`
+	Audit              []AuditEntry `json:"audit"`
+}
+
+// EmergencyRotate replaces a leaked AWSCURRENT token. It revokes the token
+// with the Revoker of the Revocation, labels its version
+// JWTCOMPROMISED-<version ID> so it is never restored, and rotates the secret
+// straight to a new AWSCURRENT token, bypassing the CurrentTokenCheck.
+//
+// A failed action does not stop the remaining ones, all failures are returned
+// together. Every action is logged as an audit entry with the reason.
+func (h JWTRotator) EmergencyRotate(ctx context.Context, secretID, reason string) (EmergencyRotation, error) {
+	if h.Revocation.Revoker == nil {
+		return EmergencyRotation{}, fmt.Errorf("failed to rotate secret in emergency: no revoker configured")
+	}
+
+	if reason == "" {
+		return EmergencyRotation{}, fmt.Errorf("failed to rotate secret in emergency: a reason is required")
+	}
+
+	metadata, err := h.store().DescribeSecret(ctx, secretID)
+	if err != nil {
+		return EmergencyRotation{}, fmt.Errorf("failed to describe secret with id '%s': %w", secretID, err)
+	}
+
+	currentVersion, ok := metadata.VersionWithStage(versionstage2.AwsCurrent)
+	if !ok {
+		return EmergencyRotation{}, fmt.Errorf("failed to rotate secret in emergency: %w: no secret with stage %s found", ErrResourceNotFound, versionstage2.AwsCurrent)
+	}
+
+	currentToken, err := h.getSecret(ctx, secretID, currentVersion, versionstage2.AwsCurrent)
+	if err != nil {
+		return EmergencyRotation{}, fmt.Errorf("failed to get current secret: %w", err)
+	}
+
+	result := EmergencyRotation{SecretID: secretID, CompromisedVersion: currentVersion}
+
+	var failures []string
+
+	audit := func(action AuditAction, versionID, fingerprint string, err error) {
+		entry := AuditEntry{
+			Time:        time.Now().UTC(),
+			Action:      action,
+			SecretID:    secretID,
+			VersionID:   versionID,
+			Fingerprint: fingerprint,
+			Reason:      reason,
+		}
+
+		logger := log.WithTracing(ctx)
+
+		if err != nil {
+			entry.Error = err.Error()
+			failures = append(failures, fmt.Sprintf("%s: %s", action, err))
+			logger = logger.WithError(err)
+		}
+
+		logger.WithField("audit", entry).Warnf("Emergency rotation of secret %s: %s versionID: %s", secretID, action, versionID)
+
+		result.Audit = append(result.Audit, entry)
+	}
+
+	audit(AuditRevoke, currentVersion, currentToken.Fingerprint(), h.revokeCompromised(ctx, secretID, currentVersion, metadata, currentToken))
+
+	compromised := versionstage2.Compromised(currentVersion)
+	if err = h.store().MoveStage(ctx, secretID, compromised, currentVersion, ""); err != nil {
+		err = fmt.Errorf("failed to label version %s: %w", compromised, err)
+	}
+
+	audit(AuditMarkCompromised, currentVersion, currentToken.Fingerprint(), err)
+
+	rotator := h
+	rotator.CurrentTokenCheck = CurrentTokenCheck{}
+
+	var newFingerprint string
+
+	if result.NewVersion, err = rotator.RotateNow(ctx, secretID); err == nil {
+		if newToken, getErr := h.getCurrentSecret(ctx, secretID); getErr == nil {
+			newFingerprint = newToken.Fingerprint()
+		}
+	}
+
+	audit(AuditRotate, result.NewVersion, newFingerprint, err)
+
+	if len(failures) > 0 {
+		return result, fmt.Errorf("emergency rotation of secret %s failed %d of %d actions: %s", secretID, len(failures), len(result.Audit), strings.Join(failures, "; "))
+	}
+
+	return result, nil
+}
+
+// revokeCompromised revokes the token of the compromised version and labels
+// it JWTREVOKED, so RevokePrevious does not revoke it again once it becomes
+// AWSPREVIOUS.
+func (h JWTRotator) revokeCompromised(ctx context.Context, secretID, versionID string, metadata SecretDescription, storedToken StoredToken) error {
+	if err := h.Revocation.Revoker.Revoke(ctx, storedToken.RawToken); err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+
+	revokedVersion, _ := metadata.VersionWithStage(versionstage2.JWTRevoked)
+	if err := h.store().MoveStage(ctx, secretID, versionstage2.JWTRevoked, versionID, revokedVersion); err != nil {
+		return fmt.Errorf("revoked token but failed to label it %s: %w", versionstage2.JWTRevoked, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,169 @@
+package jwtrotator_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/SKF/go-rest-utility/client/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator"
+	versionstage2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/versionstage"
+)
+
+func TestEmergencyRotate(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store jwtrotator.SecretStore) {
+		// Given
+		ctx := context.Background()
+		leakedToken := jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(time.Hour))}
+		initializeStore(t, store, leakedToken)
+
+		tokenProvider := &JWTProviderStub{t: t}
+		revoker := &revokerStub{}
+		jwtRotator := jwtrotator.JWTRotator{
+			Store:         store,
+			TokenProvider: tokenProvider,
+			Revocation:    jwtrotator.Revocation{Revoker: revoker},
+			// It may not hold back the emergency rotation.
+			CurrentTokenCheck: jwtrotator.CurrentTokenCheck{
+				Testers: []jwtrotator.Tester{
+					jwtrotator.TesterFunc(func(context.Context, auth.RawToken) error {
+						return fmt.Errorf("token revoked")
+					}),
+				},
+				FailOnRevoked: true,
+			},
+		}
+
+		// When
+		result, err := jwtRotator.EmergencyRotate(ctx, secretToRotate, "token leaked in build log")
+
+		// Then
+		require.NoError(t, err)
+		assert.Equal(t, initialVersion, result.CompromisedVersion)
+		assert.NotEmpty(t, result.NewVersion)
+		assert.Equal(t, []auth.RawToken{leakedToken.RawToken}, revoker.revoked)
+		assert.Equal(t, tokenProvider.issued[0], getCurrentToken(t, store).RawToken)
+
+		metadata, err := store.DescribeSecret(ctx, secretToRotate)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []versionstage2.VersionStage{versionstage2.AWSPrevious, versionstage2.Compromised(initialVersion), versionstage2.JWTRevoked}, metadata.Versions[initialVersion])
+
+		var actions []jwtrotator.AuditAction
+		for _, entry := range result.Audit {
+			actions = append(actions, entry.Action)
+			assert.Equal(t, "token leaked in build log", entry.Reason)
+			assert.Empty(t, entry.Error)
+		}
+
+		assert.Equal(t, []jwtrotator.AuditAction{jwtrotator.AuditRevoke, jwtrotator.AuditMarkCompromised, jwtrotator.AuditRotate}, actions)
+		assert.Equal(t, leakedToken.Fingerprint(), result.Audit[0].Fingerprint)
+		assert.Equal(t, result.NewVersion, result.Audit[2].VersionID)
+	})
+}
+
+func TestEmergencyRotate_NoFallback(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	store := storeFactories["SecretsManagerV1"](t)
+	initializeStore(t, store, jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(time.Hour))})
+
+	revoker := &revokerStub{}
+	jwtRotator := jwtrotator.JWTRotator{
+		Store:         store,
+		TokenProvider: &JWTProviderStub{t: t},
+		Revocation:    jwtrotator.Revocation{Revoker: revoker},
+	}
+
+	_, err := jwtRotator.EmergencyRotate(ctx, secretToRotate, "leaked")
+	require.NoError(t, err)
+
+	// When
+	_, rollbackErr := jwtRotator.Rollback(ctx, secretToRotate, "bad deploy")
+	revoked, revokeErr := jwtRotator.RevokePrevious(ctx, secretToRotate)
+
+	// Then
+	require.Error(t, rollbackErr)
+	assert.Contains(t, rollbackErr.Error(), "its token was compromised")
+	require.NoError(t, revokeErr)
+	assert.Empty(t, revoked)
+	assert.Len(t, revoker.revoked, 1)
+}
+
+func TestEmergencyRotate_Repeated(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store jwtrotator.SecretStore) {
+		// Given
+		ctx := context.Background()
+		initializeStore(t, store, jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(time.Hour))})
+
+		jwtRotator := jwtrotator.JWTRotator{
+			Store:         store,
+			TokenProvider: &JWTProviderStub{t: t},
+			Revocation:    jwtrotator.Revocation{Revoker: &revokerStub{}},
+		}
+
+		first, err := jwtRotator.EmergencyRotate(ctx, secretToRotate, "leaked")
+		require.NoError(t, err)
+
+		// When
+		second, err := jwtRotator.EmergencyRotate(ctx, secretToRotate, "leaked again")
+
+		// Then
+		require.NoError(t, err)
+		assert.Equal(t, first.NewVersion, second.CompromisedVersion)
+
+		metadata, err := store.DescribeSecret(ctx, secretToRotate)
+		require.NoError(t, err)
+		assert.Contains(t, metadata.Versions[first.CompromisedVersion], versionstage2.Compromised(first.CompromisedVersion))
+		assert.Contains(t, metadata.Versions[second.CompromisedVersion], versionstage2.Compromised(second.CompromisedVersion))
+	})
+}
+
+func TestEmergencyRotate_RevokeFails(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	store := storeFactories["SecretsManagerV1"](t)
+	initializeStore(t, store, jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(time.Hour))})
+
+	tokenProvider := &JWTProviderStub{t: t}
+	jwtRotator := jwtrotator.JWTRotator{
+		Store:         store,
+		TokenProvider: tokenProvider,
+		Revocation: jwtrotator.Revocation{
+			Revoker: jwtrotator.RevokerFunc(func(context.Context, auth.RawToken) error {
+				return fmt.Errorf("provider unavailable")
+			}),
+		},
+	}
+
+	// When
+	result, err := jwtRotator.EmergencyRotate(ctx, secretToRotate, "leaked")
+
+	// Then
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed 1 of 3 actions: revoke: failed to revoke token: provider unavailable")
+	assert.Contains(t, result.Audit[0].Error, "provider unavailable")
+	assert.Equal(t, tokenProvider.issued[0], getCurrentToken(t, store).RawToken)
+
+	metadata, err := store.DescribeSecret(ctx, secretToRotate)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []versionstage2.VersionStage{versionstage2.AWSPrevious, versionstage2.Compromised(initialVersion)}, metadata.Versions[initialVersion])
+}
+
+func TestEmergencyRotate_NoRevoker(t *testing.T) {
+	// Given
+	store := storeFactories["SecretsManagerV1"](t)
+	initialToken := jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(time.Hour))}
+	initializeStore(t, store, initialToken)
+
+	// When
+	_, err := jwtrotator.JWTRotator{Store: store, TokenProvider: &JWTProviderStub{t: t}}.EmergencyRotate(context.Background(), secretToRotate, "leaked")
+
+	// Then
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no revoker configured")
+	assert.Equal(t, initialToken, getCurrentToken(t, store))
+}
@@ -5,10 +5,35 @@ import (
 
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/secretsmanager"
+
+	versionstage2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/versionstage"
 )
 
 var (
 	ErrResourceNotFound = fmt.Errorf("resource not found")
+	ErrResourceExists   = fmt.Errorf("resource already exists")
+
+	// ErrTaggingNotSupported is returned by SecretsManagerStore.TagSecret when
+	// its client is not a SecretsManagerTagger.
+	ErrTaggingNotSupported = fmt.Errorf("secrets manager client can not tag secrets")
+
+	// ErrNotPending is returned by the finishSecret step when the version to
+	// promote does not hold AWSPENDING.
+	ErrNotPending = fmt.Errorf("version is not %s", versionstage2.AWSPending)
+
+	// ErrNotTested is returned by the finishSecret step when the version to
+	// promote did not pass the testSecret step.
+	ErrNotTested = fmt.Errorf("version did not pass the testSecret step")
+
+	// ErrCurrentTokenRevoked is returned by the testSecret step when the
+	// CurrentTokenCheck finds that minting the PENDING token invalidated the
+	// AWSCURRENT one, and FailOnRevoked is set.
+	ErrCurrentTokenRevoked = fmt.Errorf("%s token is no longer accepted", versionstage2.AwsCurrent)
+
+	// ErrTokenNotRenewed is returned by the createSecret step when the token
+	// provider returns the AWSCURRENT token, or a token expiring before it,
+	// e.g. from a cache.
+	ErrTokenNotRenewed = fmt.Errorf("token provider did not issue a new token")
 )
 
 func parseAWSError(err error) error {
@@ -16,6 +41,8 @@ func parseAWSError(err error) error {
 		switch aerr.Code() {
 		case secretsmanager.ErrCodeResourceNotFoundException:
 			return fmt.Errorf("%w: %s", ErrResourceNotFound, err.Error())
+		case secretsmanager.ErrCodeResourceExistsException:
+			return fmt.Errorf("%w: %s", ErrResourceExists, err.Error())
 		}
 	}
 
@@ -0,0 +1,381 @@
+// Package filestore keeps rotated secrets on the local filesystem, for
+// development and for installations without a secrets service.
+//
+// Every secret is a directory below Store.Dir holding one file per version and
+// an index.json file recording the staging labels and tags of the secret:
+//
+//	<dir>/<secret id>/index.json
+//	<dir>/<secret id>/versions/<version id>
+//	<dir>/<secret id>/.lock
+//
+// Secret and version IDs are path escaped. Files are replaced atomically by
+// renaming a temporary file over them, and every operation holds a lock on the
+// .lock file of the secret, so concurrent rotations from several processes are
+// safe.
+package filestore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator"
+	versionstage2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/versionstage"
+)
+
+const (
+	indexFile   = "index.json"
+	lockName    = ".lock"
+	versionsDir = "versions"
+
+	dirPerm  = 0o700
+	filePerm = 0o600
+)
+
+var ErrInvalidID = errors.New("invalid secret or version id")
+
+// rename replaces files, it is swapped in tests to simulate failing writes.
+var rename = os.Rename
+
+// lockMode is how withLock locks a secret.
+type lockMode int
+
+const (
+	// readLock shares the lock of an existing secret.
+	readLock lockMode = iota
+	// writeLock holds the lock of an existing secret exclusively.
+	writeLock
+	// createLock holds the lock exclusively and creates the secret if it
+	// does not exist yet.
+	createLock
+)
+
+// Store is a jwtrotator.SecretStore keeping every secret in a directory below
+// Dir.
+type Store struct {
+	Dir string
+}
+
+type index struct {
+	Versions map[string]indexVersion `json:"versions"`
+
+	// Tags are exposed as the tags of the secret, the store only writes the
+	// tags passed to TagSecret.
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+type indexVersion struct {
+	Stages      []versionstage2.VersionStage `json:"stages"`
+	CreatedDate time.Time                    `json:"createdDate"`
+}
+
+func (i index) versionWithStage(stage versionstage2.VersionStage) (string, bool) {
+	for versionID, version := range i.Versions {
+		for _, s := range version.Stages {
+			if s == stage {
+				return versionID, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+func (i *index) setStage(stage versionstage2.VersionStage, versionID string) {
+	for id, version := range i.Versions {
+		stages := version.Stages[:0:0]
+
+		for _, s := range version.Stages {
+			if s != stage {
+				stages = append(stages, s)
+			}
+		}
+
+		version.Stages = stages
+		i.Versions[id] = version
+	}
+
+	if version, ok := i.Versions[versionID]; ok {
+		version.Stages = append(version.Stages, stage)
+		i.Versions[versionID] = version
+	}
+}
+
+func (s Store) GetSecretValue(ctx context.Context, secretID, versionID string, stage versionstage2.VersionStage) (jwtrotator.SecretValue, error) {
+	var value jwtrotator.SecretValue
+
+	err := s.withLock(ctx, secretID, readLock, func(dir string, idx *index) error {
+		if versionID == "" && stage == "" {
+			stage = versionstage2.AwsCurrent
+		}
+
+		if stage != "" {
+			holder, ok := idx.versionWithStage(stage)
+			if !ok || (versionID != "" && holder != versionID) {
+				return fmt.Errorf("%w: no version of '%s' matches version '%s' and stage '%s'", jwtrotator.ErrResourceNotFound, secretID, versionID, stage)
+			}
+
+			versionID = holder
+		}
+
+		version, ok := idx.Versions[versionID]
+		if !ok {
+			return fmt.Errorf("%w: version '%s' of '%s'", jwtrotator.ErrResourceNotFound, versionID, secretID)
+		}
+
+		data, err := os.ReadFile(versionPath(dir, versionID))
+		if err != nil {
+			return fmt.Errorf("failed to read version '%s': %w", versionID, err)
+		}
+
+		value = jwtrotator.SecretValue{
+			VersionID:   versionID,
+			Stages:      version.Stages,
+			Value:       data,
+			CreatedDate: version.CreatedDate,
+		}
+
+		return nil
+	})
+
+	return value, err
+}
+
+func (s Store) PutSecretValue(ctx context.Context, secretID, versionID string, value []byte, stages []versionstage2.VersionStage) error {
+	if err := validateID(versionID); err != nil {
+		return err
+	}
+
+	return s.withLock(ctx, secretID, createLock, func(dir string, idx *index) error {
+		if _, ok := idx.Versions[versionID]; ok {
+			existing, err := os.ReadFile(versionPath(dir, versionID))
+			if err != nil {
+				return fmt.Errorf("failed to read version '%s': %w", versionID, err)
+			}
+
+			if string(existing) != string(value) {
+				return fmt.Errorf("%w: version '%s' of '%s' already exists with a different value", jwtrotator.ErrResourceExists, versionID, secretID)
+			}
+
+			return nil
+		}
+
+		if err := writeFileAtomic(versionPath(dir, versionID), value); err != nil {
+			return fmt.Errorf("failed to write version '%s': %w", versionID, err)
+		}
+
+		idx.Versions[versionID] = indexVersion{CreatedDate: time.Now().UTC()}
+
+		if len(stages) == 0 {
+			stages = []versionstage2.VersionStage{versionstage2.AwsCurrent}
+		}
+
+		for _, stage := range stages {
+			moveStage(idx, stage, versionID)
+		}
+
+		if err := writeIndex(dir, *idx); err != nil {
+			// Without an index entry the version file would be orphaned and
+			// make a retry of the put fail.
+			_ = os.Remove(versionPath(dir, versionID))
+
+			return err
+		}
+
+		return nil
+	})
+}
+
+func (s Store) MoveStage(ctx context.Context, secretID string, stage versionstage2.VersionStage, toVersionID, fromVersionID string) error {
+	return s.withLock(ctx, secretID, writeLock, func(dir string, idx *index) error {
+		if len(idx.Versions) == 0 {
+			return fmt.Errorf("%w: secret '%s'", jwtrotator.ErrResourceNotFound, secretID)
+		}
+
+		if holder, ok := idx.versionWithStage(stage); ok && holder != toVersionID && holder != fromVersionID {
+			return fmt.Errorf("stage %s of '%s' is attached to version '%s', not '%s'", stage, secretID, holder, fromVersionID)
+		}
+
+		if _, ok := idx.Versions[toVersionID]; toVersionID != "" && !ok {
+			return fmt.Errorf("%w: version '%s' of '%s'", jwtrotator.ErrResourceNotFound, toVersionID, secretID)
+		}
+
+		moveStage(idx, stage, toVersionID)
+
+		return writeIndex(dir, *idx)
+	})
+}
+
+func (s Store) DescribeSecret(ctx context.Context, secretID string) (jwtrotator.SecretDescription, error) {
+	description := jwtrotator.SecretDescription{
+		Versions: make(map[string][]versionstage2.VersionStage),
+		Tags:     make(map[string]string),
+	}
+
+	err := s.withLock(ctx, secretID, readLock, func(_ string, idx *index) error {
+		if len(idx.Versions) == 0 && len(idx.Tags) == 0 {
+			return fmt.Errorf("%w: secret '%s'", jwtrotator.ErrResourceNotFound, secretID)
+		}
+
+		for versionID, version := range idx.Versions {
+			if len(version.Stages) > 0 {
+				description.Versions[versionID] = version.Stages
+			}
+		}
+
+		for key, value := range idx.Tags {
+			description.Tags[key] = value
+		}
+
+		return nil
+	})
+
+	return description, err
+}
+
+func (s Store) TagSecret(ctx context.Context, secretID string, tags map[string]string) error {
+	return s.withLock(ctx, secretID, writeLock, func(dir string, idx *index) error {
+		if idx.Tags == nil {
+			idx.Tags = make(map[string]string, len(tags))
+		}
+
+		for key, value := range tags {
+			idx.Tags[key] = value
+		}
+
+		return writeIndex(dir, *idx)
+	})
+}
+
+// moveStage attaches stage to versionID, when AWSCURRENT moves the version
+// losing it becomes AWSPREVIOUS.
+func moveStage(idx *index, stage versionstage2.VersionStage, versionID string) {
+	if previous, ok := idx.versionWithStage(stage); ok && stage == versionstage2.AwsCurrent && previous != versionID && versionID != "" {
+		idx.setStage(versionstage2.AWSPrevious, previous)
+	}
+
+	idx.setStage(stage, versionID)
+}
+
+// withLock runs fn with the directory and index of a secret while holding the
+// lock of the secret in the given mode. Only createLock creates the directory
+// of a missing secret, the others report it as not found.
+func (s Store) withLock(ctx context.Context, secretID string, mode lockMode, fn func(dir string, idx *index) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := validateID(secretID); err != nil {
+		return err
+	}
+
+	dir := filepath.Join(s.Dir, url.PathEscape(secretID))
+
+	if mode == createLock {
+		if err := os.MkdirAll(filepath.Join(dir, versionsDir), dirPerm); err != nil {
+			return fmt.Errorf("failed to create secret directory: %w", err)
+		}
+	} else if _, err := os.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: secret '%s'", jwtrotator.ErrResourceNotFound, secretID)
+	}
+
+	lock, err := os.OpenFile(filepath.Join(dir, lockName), os.O_CREATE|os.O_RDWR, filePerm)
+	if err != nil {
+		return fmt.Errorf("failed to open lock file: %w", err)
+	}
+	defer lock.Close()
+
+	if err = lockFile(lock, mode != readLock); err != nil {
+		return fmt.Errorf("failed to lock secret '%s': %w", secretID, err)
+	}
+	defer unlockFile(lock) //nolint:errcheck // closing the file releases the lock as well
+
+	idx, err := readIndex(dir)
+	if err != nil {
+		return err
+	}
+
+	return fn(dir, &idx)
+}
+
+func readIndex(dir string) (index, error) {
+	idx := index{Versions: make(map[string]indexVersion)}
+
+	data, err := os.ReadFile(filepath.Join(dir, indexFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return idx, nil
+	} else if err != nil {
+		return index{}, fmt.Errorf("failed to read index: %w", err)
+	}
+
+	if err = json.Unmarshal(data, &idx); err != nil {
+		return index{}, fmt.Errorf("failed to parse index: %w", err)
+	}
+
+	if idx.Versions == nil {
+		idx.Versions = make(map[string]indexVersion)
+	}
+
+	return idx, nil
+}
+
+func writeIndex(dir string, idx index) error {
+	data, err := json.MarshalIndent(idx, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal index: %w", err)
+	}
+
+	if err = writeFileAtomic(filepath.Join(dir, indexFile), data); err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+
+	return nil
+}
+
+// writeFileAtomic replaces path with data, readers see either the old or the
+// new content but never a partially written file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name()) //nolint:errcheck // the file is gone after a successful rename
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	return rename(tmp.Name(), path)
+}
+
+// validateID rejects IDs which would escape their directory once escaped.
+func validateID(id string) error {
+	if id == "" || id == "." || id == ".." {
+		return fmt.Errorf("%w: '%s'", ErrInvalidID, id)
+	}
+
+	return nil
+}
+
+func versionPath(dir, versionID string) string {
+	return filepath.Join(dir, versionsDir, url.PathEscape(versionID))
+}
+
+var _ jwtrotator.SecretStore = Store{}
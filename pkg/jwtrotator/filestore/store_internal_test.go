@@ -0,0 +1,40 @@
+package filestore
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_PutSecretValue_IndexWriteFails(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	store := Store{Dir: t.TempDir()}
+	errWrite := errors.New("disk full")
+
+	rename = func(oldpath, newpath string) error {
+		if filepath.Base(newpath) == indexFile {
+			return errWrite
+		}
+
+		return os.Rename(oldpath, newpath)
+	}
+	defer func() { rename = os.Rename }()
+
+	// When
+	err := store.PutSecretValue(ctx, "my-secret", "version-0", []byte("token"), nil)
+
+	// Then
+	require.ErrorIs(t, err, errWrite)
+
+	_, err = os.Stat(versionPath(filepath.Join(store.Dir, "my-secret"), "version-0"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	rename = os.Rename
+	assert.NoError(t, store.PutSecretValue(ctx, "my-secret", "version-0", []byte("token"), nil))
+}
@@ -0,0 +1,125 @@
+package filestore_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator"
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator/filestore"
+	versionstage2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/versionstage"
+)
+
+const secretID = "services/my-service/jwt"
+
+func TestStore_ConcurrentPuts(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	const writers = 20
+
+	var wg sync.WaitGroup
+
+	// When
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			store := filestore.Store{Dir: dir}
+			versionID := fmt.Sprintf("version-%d", i)
+
+			assert.NoError(t, store.PutSecretValue(ctx, secretID, versionID, []byte(versionID), []versionstage2.VersionStage{versionstage2.AwsCurrent}))
+		}(i)
+	}
+
+	wg.Wait()
+
+	// Then
+	store := filestore.Store{Dir: dir}
+
+	description, err := store.DescribeSecret(ctx, secretID)
+	require.NoError(t, err)
+
+	currentVersion, ok := description.VersionWithStage(versionstage2.AwsCurrent)
+	require.True(t, ok)
+
+	for i := 0; i < writers; i++ {
+		versionID := fmt.Sprintf("version-%d", i)
+
+		value, err := store.GetSecretValue(ctx, secretID, versionID, "")
+		require.NoError(t, err)
+		assert.Equal(t, versionID, string(value.Value))
+	}
+
+	current, err := store.GetSecretValue(ctx, secretID, "", versionstage2.AwsCurrent)
+	require.NoError(t, err)
+	assert.Equal(t, currentVersion, string(current.Value))
+}
+
+func TestStore_Tags(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	store := filestore.Store{Dir: t.TempDir()}
+
+	require.NoError(t, store.PutSecretValue(ctx, secretID, "version-0", []byte("token"), nil))
+
+	indexPath := filepath.Join(store.Dir, "services%2Fmy-service%2Fjwt", "index.json")
+	index, err := os.ReadFile(indexPath)
+	require.NoError(t, err)
+
+	index = append(index[:len(index)-1], []byte(`, "tags": {"jwt-rotator:provider": "secret-credentials"}}`)...)
+	require.NoError(t, os.WriteFile(indexPath, index, 0o600))
+
+	// When
+	description, err := store.DescribeSecret(ctx, secretID)
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"jwt-rotator:provider": "secret-credentials"}, description.Tags)
+	assert.Equal(t, []versionstage2.VersionStage{versionstage2.AwsCurrent}, description.Versions["version-0"])
+}
+
+func TestStore_InvalidID(t *testing.T) {
+	// Given
+	store := filestore.Store{Dir: t.TempDir()}
+
+	// When
+	err := store.PutSecretValue(context.Background(), "..", "version-0", []byte("token"), nil)
+
+	// Then
+	assert.ErrorIs(t, err, filestore.ErrInvalidID)
+}
+
+func TestStore_NotFound(t *testing.T) {
+	// Given
+	store := filestore.Store{Dir: t.TempDir()}
+
+	// When
+	_, err := store.GetSecretValue(context.Background(), secretID, "", versionstage2.AwsCurrent)
+
+	// Then
+	assert.ErrorIs(t, err, jwtrotator.ErrResourceNotFound)
+}
+
+func TestStore_MoveStage_NotFound(t *testing.T) {
+	// Given
+	store := filestore.Store{Dir: t.TempDir()}
+
+	// When
+	err := store.MoveStage(context.Background(), secretID, versionstage2.AwsCurrent, "version-0", "")
+
+	// Then
+	assert.ErrorIs(t, err, jwtrotator.ErrResourceNotFound)
+
+	_, err = os.Stat(filepath.Join(store.Dir, "services%2Fmy-service%2Fjwt"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
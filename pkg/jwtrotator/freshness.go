@@ -0,0 +1,78 @@
+package jwtrotator
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/SKF/go-rest-utility/client/auth"
+	"github.com/SKF/go-utility/v2/log"
+)
+
+// Refresher is implemented by token providers which cache tokens.
+// RefreshRawToken bypasses the cache and issues a new token, it is called
+// when GetRawToken returns a token which does not renew AWSCURRENT.
+type Refresher interface {
+	RefreshRawToken(ctx context.Context) (auth.RawToken, error)
+}
+
+// getNewToken gets a token from tokenProvider which renews currentToken, a
+// zero currentToken accepts any token. A token which does not renew it is
+// refreshed once when tokenProvider is a Refresher.
+func getNewToken(ctx context.Context, tokenProvider auth.TokenProvider, currentToken StoredToken) (auth.RawToken, error) {
+	rawToken, err := tokenProvider.GetRawToken(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to provision new token: %w", err)
+	}
+
+	if currentToken.RawToken == "" {
+		return rawToken, nil
+	}
+
+	reason := notRenewedReason(currentToken, rawToken)
+	if reason == "" {
+		return rawToken, nil
+	}
+
+	refresher, ok := tokenProvider.(Refresher)
+	if !ok {
+		return "", fmt.Errorf("%w: new token %s", ErrTokenNotRenewed, reason)
+	}
+
+	log.WithTracing(ctx).Infof("New token %s, refreshing it", reason)
+
+	if rawToken, err = refresher.RefreshRawToken(ctx); err != nil {
+		return "", fmt.Errorf("failed to refresh token: %w", err)
+	}
+
+	if reason = notRenewedReason(currentToken, rawToken); reason != "" {
+		return "", fmt.Errorf("%w: refreshed token %s", ErrTokenNotRenewed, reason)
+	}
+
+	return rawToken, nil
+}
+
+// notRenewedReason returns why rawToken does not renew currentToken, or an
+// empty string when it does. A token renews AWSCURRENT when it is a different
+// token which does not expire before it.
+func notRenewedReason(currentToken StoredToken, rawToken auth.RawToken) string {
+	if (StoredToken{RawToken: rawToken}).Fingerprint() == currentToken.Fingerprint() {
+		return "is the AWSCURRENT token"
+	}
+
+	currentExpiry, err := currentToken.RawToken.ParseExpires()
+	if err != nil {
+		return ""
+	}
+
+	expiry, err := rawToken.ParseExpires()
+	if err != nil {
+		return ""
+	}
+
+	if expiry.Before(currentExpiry) {
+		return fmt.Sprintf("expires at %s, before the AWSCURRENT token", expiry.UTC().Format(time.RFC3339))
+	}
+
+	return ""
+}
@@ -0,0 +1,113 @@
+package jwtrotator_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/SKF/go-rest-utility/client/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator"
+	step2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/step"
+)
+
+func TestRotate_CreateSecret_NotRenewed(t *testing.T) {
+	currentToken := newJWT(t, time.Now().Add(time.Hour))
+
+	for name, rawToken := range map[string]auth.RawToken{
+		"same token":     currentToken,
+		"expires before": newJWT(t, time.Now().Add(time.Minute)),
+	} {
+		rawToken := rawToken
+
+		t.Run(name, func(t *testing.T) {
+			// Given
+			ctx := context.Background()
+			store := storeFactories["SecretsManagerV1"](t)
+			initializeStore(t, store, jwtrotator.StoredToken{RawToken: currentToken})
+
+			jwtRotator := jwtrotator.JWTRotator{
+				Store: store,
+				TokenProvider: tokenProviderFunc(func(context.Context) (auth.RawToken, error) {
+					return rawToken, nil
+				}),
+			}
+
+			// When
+			err := rotateStep(ctx, jwtRotator, step2.CreateSecret, version0)
+
+			// Then
+			assert.ErrorIs(t, err, jwtrotator.ErrTokenNotRenewed)
+
+			metadata, err := store.DescribeSecret(ctx, secretToRotate)
+			require.NoError(t, err)
+			assert.NotContains(t, metadata.Versions, version0)
+		})
+	}
+}
+
+func TestRotate_CreateSecret_Refresh(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store jwtrotator.SecretStore) {
+		// Given
+		ctx := context.Background()
+		currentToken := newJWT(t, time.Now().Add(time.Hour))
+		initializeStore(t, store, jwtrotator.StoredToken{RawToken: currentToken})
+
+		tokenProvider := &cachingProviderStub{
+			cached:    currentToken,
+			refreshed: newJWTWithClaims(t, map[string]interface{}{"jti": "refreshed", "exp": time.Now().Add(2 * time.Hour).Unix()}),
+		}
+		jwtRotator := jwtrotator.JWTRotator{
+			Store:         store,
+			TokenProvider: tokenProvider,
+		}
+
+		// When
+		err := rotateStep(ctx, jwtRotator, step2.CreateSecret, version0)
+
+		// Then
+		require.NoError(t, err)
+		assert.Equal(t, 1, tokenProvider.refreshes)
+		assert.Equal(t, tokenProvider.refreshed, getPendingToken(t, store).RawToken)
+	})
+}
+
+func TestRotate_CreateSecret_RefreshNotRenewed(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	store := storeFactories["SecretsManagerV1"](t)
+	currentToken := newJWT(t, time.Now().Add(time.Hour))
+	initializeStore(t, store, jwtrotator.StoredToken{RawToken: currentToken})
+
+	tokenProvider := &cachingProviderStub{cached: currentToken, refreshed: currentToken}
+
+	// When
+	err := rotateStep(ctx, jwtrotator.JWTRotator{Store: store, TokenProvider: tokenProvider}, step2.CreateSecret, version0)
+
+	// Then
+	assert.ErrorIs(t, err, jwtrotator.ErrTokenNotRenewed)
+	assert.Contains(t, err.Error(), "refreshed token is the AWSCURRENT token")
+	assert.Equal(t, 1, tokenProvider.refreshes)
+}
+
+// cachingProviderStub returns cached until it is refreshed.
+type cachingProviderStub struct {
+	cached    auth.RawToken
+	refreshed auth.RawToken
+	refreshes int
+}
+
+func (p *cachingProviderStub) GetRawToken(context.Context) (auth.RawToken, error) {
+	return p.cached, nil
+}
+
+func (p *cachingProviderStub) RefreshRawToken(context.Context) (auth.RawToken, error) {
+	p.refreshes++
+	p.cached = p.refreshed
+
+	return p.cached, nil
+}
+
+var _ jwtrotator.Refresher = &cachingProviderStub{}
@@ -0,0 +1,218 @@
+package jwtrotator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	versionstage2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/versionstage"
+)
+
+// stalePendingAge is how long a PENDING version, not yet promoted to
+// CURRENT, is allowed to exist before it is considered abandoned.
+const stalePendingAge = 24 * time.Hour
+
+type ProblemKind string
+
+const (
+	ProblemMissingCurrent ProblemKind = "missing-current"
+	ProblemExpiredCurrent ProblemKind = "expired-current"
+	ProblemStalePending   ProblemKind = "stale-pending"
+	ProblemUndecodable    ProblemKind = "undecodable"
+)
+
+type Problem struct {
+	Kind      ProblemKind `json:"kind"`
+	VersionID string      `json:"versionId,omitempty"`
+	Message   string      `json:"message"`
+}
+
+type VersionReport struct {
+	VersionID     string        `json:"versionId"`
+	Stages        []string      `json:"stages"`
+	CreatedDate   *time.Time    `json:"createdDate,omitempty"`
+	Token         *DecodedToken `json:"token,omitempty"`
+	TimeToExpiry  *Duration     `json:"timeToExpiry,omitempty"`
+	Fingerprint   string        `json:"fingerprint,omitempty"`
+	CredentialSet string        `json:"credentialSet,omitempty"`
+	Error         string        `json:"error,omitempty"`
+}
+
+func (v VersionReport) hasStage(stage versionstage2.VersionStage) bool {
+	for _, s := range v.Stages {
+		if s == string(stage) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type SecretReport struct {
+	SecretID string          `json:"secretId"`
+	Versions []VersionReport `json:"versions"`
+	Problems []Problem       `json:"problems"`
+}
+
+// Duration is a time.Duration which is marshalled in its human readable form.
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).Round(time.Second).String()
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// Inspect lists every version of a secret together with its staging labels and
+// decoded token, and flags problems that would break or have broken a rotation.
+func (h JWTRotator) Inspect(ctx context.Context, secretID string) (SecretReport, error) {
+	metadata, err := h.store().DescribeSecret(ctx, secretID)
+	if err != nil {
+		return SecretReport{}, fmt.Errorf("failed to describe secret with id '%s': %w", secretID, err)
+	}
+
+	report := SecretReport{
+		SecretID: secretID,
+		Versions: make([]VersionReport, 0, len(metadata.Versions)),
+		Problems: []Problem{},
+	}
+
+	now := time.Now()
+
+	for versionID, stages := range metadata.Versions {
+		versionReport, err := h.inspectVersion(ctx, secretID, versionID, stages, now)
+		if err != nil {
+			return SecretReport{}, err
+		}
+
+		report.Versions = append(report.Versions, versionReport)
+	}
+
+	sort.Slice(report.Versions, func(i, j int) bool {
+		iRank, jRank := stageRank(report.Versions[i]), stageRank(report.Versions[j])
+		if iRank != jRank {
+			return iRank < jRank
+		}
+
+		return report.Versions[i].VersionID < report.Versions[j].VersionID
+	})
+
+	report.Problems = findProblems(report.Versions, now)
+
+	return report, nil
+}
+
+func (h JWTRotator) inspectVersion(ctx context.Context, secretID, versionID string, stages []versionstage2.VersionStage, now time.Time) (VersionReport, error) {
+	versionReport := VersionReport{
+		VersionID: versionID,
+		Stages:    make([]string, 0, len(stages)),
+	}
+
+	for _, stage := range stages {
+		versionReport.Stages = append(versionReport.Stages, string(stage))
+	}
+
+	sort.Strings(versionReport.Stages)
+
+	secretValue, err := h.store().GetSecretValue(ctx, secretID, versionID, "")
+	if err != nil {
+		return VersionReport{}, fmt.Errorf("failed to get secret value of version '%s': %w", versionID, err)
+	}
+
+	if !secretValue.CreatedDate.IsZero() {
+		versionReport.CreatedDate = &secretValue.CreatedDate
+	}
+
+	var storedToken StoredToken
+	if err = json.Unmarshal(secretValue.Value, &storedToken); err != nil {
+		versionReport.Error = fmt.Sprintf("failed to unmarshal secret: %s", err)
+		return versionReport, nil
+	}
+
+	versionReport.Fingerprint = storedToken.Fingerprint()
+	versionReport.CredentialSet = storedToken.CredentialSet
+
+	decoded, err := DecodeToken(storedToken.RawToken)
+	if err != nil {
+		versionReport.Error = fmt.Sprintf("failed to decode token: %s", err)
+		return versionReport, nil
+	}
+
+	versionReport.Token = &decoded
+
+	if decoded.ExpiresAt != nil {
+		timeToExpiry := Duration(decoded.ExpiresAt.Sub(now))
+		versionReport.TimeToExpiry = &timeToExpiry
+	}
+
+	return versionReport, nil
+}
+
+func findProblems(versions []VersionReport, now time.Time) []Problem {
+	problems := []Problem{}
+	hasCurrent := false
+
+	for _, v := range versions {
+		isCurrent := v.hasStage(versionstage2.AwsCurrent)
+		hasCurrent = hasCurrent || isCurrent
+
+		if v.Error != "" {
+			problems = append(problems, Problem{Kind: ProblemUndecodable, VersionID: v.VersionID, Message: v.Error})
+			continue
+		}
+
+		expired := v.TimeToExpiry != nil && *v.TimeToExpiry <= 0
+
+		if isCurrent && expired {
+			problems = append(problems, Problem{
+				Kind:      ProblemExpiredCurrent,
+				VersionID: v.VersionID,
+				Message:   fmt.Sprintf("%s token expired at %s", versionstage2.AwsCurrent, v.Token.ExpiresAt.Format(time.RFC3339)),
+			})
+		}
+
+		if !v.hasStage(versionstage2.AWSPending) || isCurrent {
+			continue
+		}
+
+		if expired {
+			problems = append(problems, Problem{
+				Kind:      ProblemStalePending,
+				VersionID: v.VersionID,
+				Message:   fmt.Sprintf("%s token expired at %s", versionstage2.AWSPending, v.Token.ExpiresAt.Format(time.RFC3339)),
+			})
+		} else if v.CreatedDate != nil && now.Sub(*v.CreatedDate) > stalePendingAge {
+			problems = append(problems, Problem{
+				Kind:      ProblemStalePending,
+				VersionID: v.VersionID,
+				Message:   fmt.Sprintf("%s version created at %s was never promoted", versionstage2.AWSPending, v.CreatedDate.Format(time.RFC3339)),
+			})
+		}
+	}
+
+	if !hasCurrent {
+		problems = append(problems, Problem{
+			Kind:    ProblemMissingCurrent,
+			Message: fmt.Sprintf("no version with stage %s found", versionstage2.AwsCurrent),
+		})
+	}
+
+	return problems
+}
+
+func stageRank(v VersionReport) int {
+	switch {
+	case v.hasStage(versionstage2.AwsCurrent):
+		return 0
+	case v.hasStage(versionstage2.AWSPending):
+		return 1
+	case v.hasStage(versionstage2.AWSPrevious):
+		return 2 //nolint:gomnd
+	}
+
+	return 3 //nolint:gomnd
+}
@@ -0,0 +1,89 @@
+package jwtrotator_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator"
+	versionstage2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/versionstage"
+)
+
+func TestInspect(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store jwtrotator.SecretStore) {
+		// Given
+		currentToken := jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(time.Hour))}
+		putToken(t, store, version0, jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(-time.Hour))}, versionstage2.AWSPrevious)
+		putToken(t, store, version1, currentToken, versionstage2.AwsCurrent)
+
+		jwtRotator := jwtrotator.JWTRotator{Store: store}
+
+		// When
+		report, err := jwtRotator.Inspect(context.Background(), secretToRotate)
+
+		// Then
+		require.NoError(t, err)
+		assert.Empty(t, report.Problems)
+		require.Len(t, report.Versions, 2)
+
+		current := report.Versions[0]
+		assert.Equal(t, version1, current.VersionID)
+		assert.Equal(t, []string{string(versionstage2.AwsCurrent)}, current.Stages)
+		assert.Equal(t, currentToken.Fingerprint(), current.Fingerprint)
+		require.NotNil(t, current.Token)
+		assert.Equal(t, "service-user", current.Token.Claims["sub"])
+		assert.Equal(t, "RS256", current.Token.Header["alg"])
+		require.NotNil(t, current.TimeToExpiry)
+		assert.InDelta(t, time.Hour, time.Duration(*current.TimeToExpiry), float64(time.Minute))
+
+		assert.Equal(t, version0, report.Versions[1].VersionID)
+	})
+}
+
+func TestInspect_Problems(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store jwtrotator.SecretStore) {
+		// Given
+		putToken(t, store, version0, jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(-time.Hour))}, versionstage2.AwsCurrent)
+		putToken(t, store, version1, jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(-time.Minute))}, versionstage2.AWSPending)
+		putToken(t, store, version2, jwtrotator.StoredToken{RawToken: "not-a-jwt"}, versionstage2.AWSPrevious)
+
+		jwtRotator := jwtrotator.JWTRotator{Store: store}
+
+		// When
+		report, err := jwtRotator.Inspect(context.Background(), secretToRotate)
+
+		// Then
+		require.NoError(t, err)
+
+		kinds := map[string]jwtrotator.ProblemKind{}
+		for _, problem := range report.Problems {
+			kinds[problem.VersionID] = problem.Kind
+		}
+
+		assert.Equal(t, map[string]jwtrotator.ProblemKind{
+			version0: jwtrotator.ProblemExpiredCurrent,
+			version1: jwtrotator.ProblemStalePending,
+			version2: jwtrotator.ProblemUndecodable,
+		}, kinds)
+	})
+}
+
+func TestInspect_MissingCurrent(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store jwtrotator.SecretStore) {
+		// Given
+		putToken(t, store, version0, jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(time.Hour))}, versionstage2.AWSPending)
+
+		jwtRotator := jwtrotator.JWTRotator{Store: store}
+
+		// When
+		report, err := jwtRotator.Inspect(context.Background(), secretToRotate)
+
+		// Then
+		require.NoError(t, err)
+		require.Len(t, report.Problems, 1)
+		assert.Equal(t, jwtrotator.ProblemMissingCurrent, report.Problems[0].Kind)
+	})
+}
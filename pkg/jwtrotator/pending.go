@@ -0,0 +1,208 @@
+package jwtrotator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SKF/go-utility/v2/log"
+
+	versionstage2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/versionstage"
+)
+
+// Versions are immutable, so a PENDING token which went stale while its
+// rotation was failing can not be replaced under the ClientRequestToken of
+// the rotation. The fresh token is instead stored under a version ID derived
+// from the ClientRequestToken, "<token>-r<attempt>", and AWSPENDING is moved
+// to it. The derived IDs are deterministic, so repeated and concurrent
+// retries of createSecret agree on them and stay idempotent.
+const reprovisionSeparator = "-r"
+
+// maxVersionIDLength is the longest version ID Secrets Manager accepts.
+const maxVersionIDLength = 64
+
+func reprovisionedVersionID(clientRequestToken string, attempt int) string {
+	if attempt == 0 {
+		return clientRequestToken
+	}
+
+	return clientRequestToken + reprovisionSeparator + strconv.Itoa(attempt)
+}
+
+// reprovisionAttempt reports whether versionID belongs to the rotation of
+// clientRequestToken and which reprovisioning attempt stored it, the
+// ClientRequestToken itself being attempt 0.
+func reprovisionAttempt(clientRequestToken, versionID string) (int, bool) {
+	if versionID == clientRequestToken {
+		return 0, true
+	}
+
+	suffix := strings.TrimPrefix(versionID, clientRequestToken+reprovisionSeparator)
+	if suffix == versionID {
+		return 0, false
+	}
+
+	attempt, err := strconv.Atoi(suffix)
+	if err != nil || attempt < 1 || strconv.Itoa(attempt) != suffix {
+		return 0, false
+	}
+
+	return attempt, true
+}
+
+// getPendingVersion returns the version holding AWSPENDING if it belongs to
+// the rotation of version, it is the ClientRequestToken or derived from it.
+func (h JWTRotator) getPendingVersion(ctx context.Context, version secretVersion) (SecretValue, error) {
+	secretValue, err := h.store().GetSecretValue(ctx, version.SecretID, "", versionstage2.AWSPending)
+	if err != nil {
+		return SecretValue{}, fmt.Errorf("failed to get secret value: %w", err)
+	}
+
+	if _, ok := reprovisionAttempt(version.ClientRequestToken, secretValue.VersionID); !ok {
+		return SecretValue{}, otherRotationError{
+			versionID: secretValue.VersionID,
+			promoted:  hasStage(secretValue.Stages, versionstage2.AwsCurrent),
+		}
+	}
+
+	return secretValue, nil
+}
+
+// otherRotationError is returned when AWSPENDING is attached to a version of
+// another rotation than the one asked for, as far as the rotation is
+// concerned its PENDING version is not found.
+type otherRotationError struct {
+	versionID string
+
+	// promoted is set when the version is also AWSCURRENT, its rotation
+	// finished without the label being removed.
+	promoted bool
+}
+
+func (e otherRotationError) Error() string {
+	return fmt.Sprintf("%s: %s is held by version %s of another rotation", ErrResourceNotFound, versionstage2.AWSPending, e.versionID)
+}
+
+func (e otherRotationError) Is(target error) bool {
+	return target == ErrResourceNotFound
+}
+
+func hasStage(stages []versionstage2.VersionStage, stage versionstage2.VersionStage) bool {
+	for _, s := range stages {
+		if s == stage {
+			return true
+		}
+	}
+
+	return false
+}
+
+// handleStalePending logs an AWSPENDING label left on a version of an
+// abandoned rotation and removes it if RemoveStalePending is set.
+func (h JWTRotator) handleStalePending(ctx context.Context, version secretVersion, err error) error {
+	var other otherRotationError
+	if !errors.As(err, &other) || other.promoted {
+		return nil
+	}
+
+	log.WithTracing(ctx).Warnf("%s of secret %s is attached to versionID: %s of an abandoned rotation, rotating versionID: %s",
+		versionstage2.AWSPending, version.SecretID, other.versionID, version.ClientRequestToken)
+
+	if !h.RemoveStalePending {
+		return nil
+	}
+
+	if err = h.store().MoveStage(ctx, version.SecretID, versionstage2.AWSPending, "", other.versionID); err != nil {
+		return fmt.Errorf("failed to remove stale %s from version %s: %w", versionstage2.AWSPending, other.versionID, err)
+	}
+
+	return nil
+}
+
+func (h JWTRotator) getPendingSecret(ctx context.Context, version secretVersion) (string, StoredToken, error) {
+	secretValue, err := h.getPendingVersion(ctx, version)
+	if err != nil {
+		return "", StoredToken{}, err
+	}
+
+	var storedToken StoredToken
+	if err = json.Unmarshal(secretValue.Value, &storedToken); err != nil {
+		return "", StoredToken{}, fmt.Errorf("failed to unmarshal secret: %w", err)
+	}
+
+	return secretValue.VersionID, storedToken, nil
+}
+
+// staleReason describes why a PENDING token can no longer pass the lifetime
+// checks of the testSecret step, or returns an empty string. Tokens without a
+// readable expiry are left for testSecret to reject.
+func (h JWTRotator) staleReason(storedToken StoredToken) string {
+	expiry, err := storedToken.RawToken.ParseExpires()
+	if err != nil {
+		return ""
+	}
+
+	lifetime := time.Until(expiry)
+	if lifetime <= 0 {
+		return "already expired"
+	}
+
+	if lifetime < h.MinLifetime {
+		return fmt.Sprintf("expires in %s, minimum lifetime is %s", lifetime.Round(time.Second), h.MinLifetime)
+	}
+
+	return ""
+}
+
+// provisionPendingToken stores the PENDING token of a rotation which has
+// none. When the version of the ClientRequestToken is already stored, but no
+// longer PENDING, e.g. because a stale AWSPENDING label was removed, the token
+// is reprovisioned under a derived version ID instead.
+func (h JWTRotator) provisionPendingToken(ctx context.Context, version secretVersion) error {
+	err := h.provisionNewToken(ctx, version, versionstage2.AWSPending)
+	if !errors.Is(err, ErrResourceExists) {
+		return err
+	}
+
+	log.WithTracing(ctx).Warnf("versionID: %s of secret %s is no longer %s, provisioning a new one",
+		version.ClientRequestToken, version.SecretID, versionstage2.AWSPending)
+
+	return h.reprovisionPendingToken(ctx, version, 1)
+}
+
+// reprovisionPendingToken stores a fresh PENDING token under the version ID
+// of the given reprovisioning attempt. When a concurrent retry stored that
+// version first its token is used instead, as long as it is not stale.
+func (h JWTRotator) reprovisionPendingToken(ctx context.Context, version secretVersion, attempt int) error {
+	versionID := reprovisionedVersionID(version.ClientRequestToken, attempt)
+	if len(versionID) > maxVersionIDLength {
+		return fmt.Errorf("failed to reprovision stale token: version ID %s is longer than %d characters", versionID, maxVersionIDLength)
+	}
+
+	err := h.provisionNewToken(ctx, secretVersion{
+		SecretID:           version.SecretID,
+		ClientRequestToken: versionID,
+	}, versionstage2.AWSPending)
+	if !errors.Is(err, ErrResourceExists) {
+		return err
+	}
+
+	pendingVersion, storedToken, err := h.getPendingSecret(ctx, version)
+	if err != nil {
+		return fmt.Errorf("reprovisioned version %s exists but no pending secret found: %w", versionID, err)
+	}
+
+	if pendingVersion != versionID {
+		return fmt.Errorf("reprovisioned version %s exists but %s is held by version %s", versionID, versionstage2.AWSPending, pendingVersion)
+	}
+
+	if reason := h.staleReason(storedToken); reason != "" {
+		return fmt.Errorf("reprovisioned PENDING token %s", reason)
+	}
+
+	return nil
+}
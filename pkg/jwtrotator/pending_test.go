@@ -0,0 +1,232 @@
+package jwtrotator_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/SKF/go-rest-utility/client/auth"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator"
+	step2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/step"
+	inmemorysecretsmanager2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/testutils/inmemorysecretsmanager"
+	versionstage2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/versionstage"
+)
+
+func TestRotate_CreateSecret_ReprovisionsStalePending(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store jwtrotator.SecretStore) {
+		// Given
+		ctx := context.Background()
+		initializeStore(t, store, jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(time.Hour))})
+		putToken(t, store, version0, jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(-time.Minute))}, versionstage2.AWSPending)
+
+		tokenProvider := &JWTProviderStub{t: t}
+		jwtRotator := jwtrotator.JWTRotator{
+			Store:         store,
+			TokenProvider: tokenProvider,
+		}
+
+		// When
+		for i := 0; i < 2; i++ {
+			err := rotateStep(ctx, jwtRotator, step2.CreateSecret, version0)
+			require.NoError(t, err)
+		}
+
+		testErr := rotateStep(ctx, jwtRotator, step2.TestSecret, version0)
+		finishErr := rotateStep(ctx, jwtRotator, step2.FinishSecret, version0)
+		replayErr := rotateStep(ctx, jwtRotator, step2.CreateSecret, version0)
+
+		// Then
+		require.Len(t, tokenProvider.issued, 1)
+		require.NoError(t, testErr)
+		require.NoError(t, finishErr)
+		require.NoError(t, replayErr)
+		assert.Equal(t, tokenProvider.issued[0], getCurrentToken(t, store).RawToken)
+
+		metadata, err := store.DescribeSecret(ctx, secretToRotate)
+		require.NoError(t, err)
+
+		currentVersion, _ := metadata.VersionWithStage(versionstage2.AwsCurrent)
+		assert.Equal(t, version0+"-r1", currentVersion)
+
+		_, hasPending := metadata.VersionWithStage(versionstage2.AWSPending)
+		assert.False(t, hasPending)
+	})
+}
+
+func TestRotate_CreateSecret_ReprovisionsUntilFresh(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	store := storeFactories["SecretsManagerV1"](t)
+	initializeStore(t, store, jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(time.Minute))})
+
+	tokenProvider := &JWTProviderStub{t: t}
+	jwtRotator := jwtrotator.JWTRotator{
+		Store:         store,
+		TokenProvider: tokenProvider,
+		MinLifetime:   2 * time.Hour,
+	}
+
+	// When
+	for i := 0; i < 3; i++ {
+		err := rotateStep(ctx, jwtRotator, step2.CreateSecret, version0)
+		require.NoError(t, err)
+	}
+
+	// Then
+	require.Len(t, tokenProvider.issued, 3)
+	assert.Equal(t, tokenProvider.issued[2], getPendingToken(t, store).RawToken)
+
+	metadata, err := store.DescribeSecret(ctx, secretToRotate)
+	require.NoError(t, err)
+
+	pendingVersion, _ := metadata.VersionWithStage(versionstage2.AWSPending)
+	assert.Equal(t, version0+"-r2", pendingVersion)
+}
+
+func TestRotate_CreateSecret_ConcurrentReprovision(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store jwtrotator.SecretStore) {
+		// Given
+		ctx := context.Background()
+		initializeStore(t, store, jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(time.Hour))})
+		putToken(t, store, version0, jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(-time.Minute))}, versionstage2.AWSPending)
+
+		concurrentToken := newJWTWithClaims(t, map[string]interface{}{"jti": "concurrent", "exp": time.Now().Add(2 * time.Hour).Unix()})
+		jwtRotator := jwtrotator.JWTRotator{
+			Store: store,
+			TokenProvider: tokenProviderFunc(func(context.Context) (auth.RawToken, error) {
+				// Another retry of the same rotation reprovisions first.
+				putToken(t, store, version0+"-r1", jwtrotator.StoredToken{RawToken: concurrentToken}, versionstage2.AWSPending)
+
+				return newJWTWithClaims(t, map[string]interface{}{"jti": "reprovisioned", "exp": time.Now().Add(2 * time.Hour).Unix()}), nil
+			}),
+		}
+
+		// When
+		err := rotateStep(ctx, jwtRotator, step2.CreateSecret, version0)
+
+		// Then
+		require.NoError(t, err)
+		assert.Equal(t, concurrentToken, getPendingToken(t, store).RawToken)
+	})
+}
+
+func TestRotate_CreateSecret_RetryAfterPendingRemoved(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	store := storeFactories["SecretsManagerV1"](t)
+	initializeStore(t, store, jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(time.Hour))})
+	putToken(t, store, version0, jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(-time.Minute))}, versionstage2.AWSPending)
+
+	// The stale label was removed, e.g. by cleanup-pending.
+	require.NoError(t, store.MoveStage(ctx, secretToRotate, versionstage2.AWSPending, "", version0))
+
+	tokenProvider := &JWTProviderStub{t: t}
+	jwtRotator := jwtrotator.JWTRotator{
+		Store:         store,
+		TokenProvider: tokenProvider,
+	}
+
+	// When
+	err := rotateStep(ctx, jwtRotator, step2.CreateSecret, version0)
+
+	// Then
+	require.NoError(t, err)
+	require.Len(t, tokenProvider.issued, 2)
+	assert.Equal(t, tokenProvider.issued[1], getPendingToken(t, store).RawToken)
+
+	metadata, err := store.DescribeSecret(ctx, secretToRotate)
+	require.NoError(t, err)
+
+	pendingVersion, _ := metadata.VersionWithStage(versionstage2.AWSPending)
+	assert.Equal(t, version0+"-r1", pendingVersion)
+}
+
+func TestRotate_RotateSecret_RetryAfterStalePending(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	secretsManager := inmemorysecretsmanager2.New()
+	store := jwtrotator.SecretsManagerStore{Client: secretsManager}
+	initializeStore(t, store, jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(5*time.Minute))})
+
+	lifetime, issued := 10*time.Minute, 0
+	jwtRotator := jwtrotator.JWTRotator{
+		SecretsManager: secretsManager,
+		TokenProvider: tokenProviderFunc(func(context.Context) (auth.RawToken, error) {
+			issued++
+			return newJWTWithClaims(t, map[string]interface{}{"jti": strconv.Itoa(issued), "exp": time.Now().Add(lifetime).Unix()}), nil
+		}),
+		MinLifetime: 30 * time.Minute,
+	}
+	secretsManager.RegisterRotationFunction(rotationLambdaARN, jwtRotator.Rotate)
+
+	// The rotation fails in testSecret, by the time Lambda retries it the
+	// PENDING token is stale.
+	_, err := secretsManager.RotateSecretWithContext(ctx, &secretsmanager.RotateSecretInput{
+		SecretId:           aws.String(secretToRotate),
+		ClientRequestToken: aws.String(version0),
+		RotationLambdaARN:  aws.String(rotationLambdaARN),
+	})
+	require.Error(t, err)
+
+	lifetime = time.Hour
+
+	// When
+	var retryErrs []error
+	for _, rotationStep := range []step2.Step{step2.CreateSecret, step2.SetSecret, step2.TestSecret, step2.FinishSecret} {
+		retryErrs = append(retryErrs, rotateStep(ctx, jwtRotator, rotationStep, version0))
+	}
+
+	_, nextErr := secretsManager.RotateSecretWithContext(ctx, &secretsmanager.RotateSecretInput{
+		SecretId: aws.String(secretToRotate),
+	})
+
+	// Then
+	assert.Equal(t, []error{nil, nil, nil, nil}, retryErrs)
+	require.NoError(t, nextErr, "the retried rotation must not block later ones")
+
+	metadata, err := store.DescribeSecret(ctx, secretToRotate)
+	require.NoError(t, err)
+	assert.Contains(t, metadata.Versions[version0+"-r1"], versionstage2.AWSPrevious)
+}
+
+func TestRotate_CreateSecret_KeepsPendingOfOtherFormat(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	store := storeFactories["SecretsManagerV1"](t)
+	initializeStore(t, store, jwtrotator.StoredToken{RawToken: "first-token"})
+	putToken(t, store, version0, jwtrotator.StoredToken{RawToken: "opaque-token"}, versionstage2.AWSPending)
+
+	tokenProvider := &JWTProviderStub{t: t}
+	jwtRotator := jwtrotator.JWTRotator{
+		Store:         store,
+		TokenProvider: tokenProvider,
+	}
+
+	// When
+	err := rotateStep(ctx, jwtRotator, step2.CreateSecret, version0)
+
+	// Then
+	require.NoError(t, err)
+	assert.Empty(t, tokenProvider.issued)
+	assert.Equal(t, "opaque-token", string(getPendingToken(t, store).RawToken))
+}
+
+func rotateStep(ctx context.Context, jwtRotator jwtrotator.JWTRotator, step step2.Step, clientRequestToken string) error {
+	return jwtRotator.Rotate(ctx, jwtrotator.SecretManagerEvent{
+		Step:               step,
+		SecretID:           secretToRotate,
+		ClientRequestToken: clientRequestToken,
+	})
+}
+
+type tokenProviderFunc func(ctx context.Context) (auth.RawToken, error)
+
+func (f tokenProviderFunc) GetRawToken(ctx context.Context) (auth.RawToken, error) {
+	return f(ctx)
+}
@@ -0,0 +1,397 @@
+package jwtrotator_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SKF/go-rest-utility/client/auth"
+
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator"
+	step2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/step"
+	inmemorysecretsmanager2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/testutils/inmemorysecretsmanager"
+	versionstage2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/versionstage"
+)
+
+var (
+	propertySeed       = flag.Int64("rotation.seed", 0, "seed of the rotation property test, 0 picks a random seed")
+	propertySequences  = flag.Int("rotation.sequences", 300, "number of step sequences generated by the rotation property test")
+	propertyMaxActions = flag.Int("rotation.actions", 25, "maximum length of a step sequence")
+)
+
+var (
+	propertySteps  = []step2.Step{step2.CreateSecret, step2.SetSecret, step2.TestSecret, step2.FinishSecret}
+	propertyTokens = []string{version0, version1, version2}
+	propertyFaults = []inmemorysecretsmanager2.Operation{
+		inmemorysecretsmanager2.OpDescribeSecret,
+		inmemorysecretsmanager2.OpGetSecretValue,
+		inmemorysecretsmanager2.OpPutSecretValue,
+		inmemorysecretsmanager2.OpUpdateSecretVersionStage,
+	}
+)
+
+// rotationAction is a single Rotate call, optionally failing the token
+// provider, having it issue an expired token, having the tester reject tokens
+// or failing the next call to a secrets manager operation.
+type rotationAction struct {
+	Step            step2.Step
+	Token           int
+	ProviderFails   bool
+	ProviderExpired bool
+	TesterRejects   bool
+	Fault           inmemorysecretsmanager2.Operation
+}
+
+func (a rotationAction) String() string {
+	s := fmt.Sprintf("%s(%s)", a.Step, propertyTokens[a.Token])
+
+	if a.ProviderFails {
+		s += " provider fails"
+	}
+
+	if a.ProviderExpired {
+		s += " provider issues expired token"
+	}
+
+	if a.TesterRejects {
+		s += " tester rejects"
+	}
+
+	if a.Fault != "" {
+		s += fmt.Sprintf(" %s fails", a.Fault)
+	}
+
+	return s
+}
+
+// TestRotate_Properties runs random sequences of rotation steps, repeated, out
+// of order and with interleaved ClientRequestTokens and failures, and checks
+// the invariants of the secret after every step. A failing sequence is shrunk
+// before it is reported, rerun it with -rotation.seed.
+func TestRotate_Properties(t *testing.T) {
+	seed := *propertySeed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	r := rand.New(rand.NewSource(seed)) //nolint:gosec
+
+	for i := 0; i < *propertySequences; i++ {
+		actions := generateActions(r, 1+r.Intn(*propertyMaxActions))
+
+		if failure := runActions(t, actions); failure != "" {
+			minimal := shrinkActions(actions, func(candidate []rotationAction) bool {
+				return runActions(t, candidate) != ""
+			})
+
+			t.Fatalf("invariant violated (seed %d, sequence %d): %s\nminimal sequence:\n  %s",
+				seed, i, runActions(t, minimal), joinActions(minimal))
+		}
+	}
+}
+
+func generateActions(r *rand.Rand, n int) []rotationAction {
+	actions := make([]rotationAction, n)
+
+	for i := range actions {
+		actions[i] = rotationAction{
+			Step:            propertySteps[r.Intn(len(propertySteps))],
+			Token:           r.Intn(len(propertyTokens)),
+			ProviderFails:   r.Intn(10) == 0, //nolint:gomnd
+			ProviderExpired: r.Intn(6) == 0,  //nolint:gomnd
+			TesterRejects:   r.Intn(4) == 0,  //nolint:gomnd
+		}
+
+		if r.Intn(8) == 0 { //nolint:gomnd
+			actions[i].Fault = propertyFaults[r.Intn(len(propertyFaults))]
+		}
+	}
+
+	return actions
+}
+
+// runActions runs the actions against a new secret and returns a description
+// of the first violated invariant, or an empty string.
+func runActions(t *testing.T, actions []rotationAction) string {
+	ctx := context.Background()
+	secretsManager := inmemorysecretsmanager2.New()
+	store := jwtrotator.SecretsManagerStore{Client: secretsManager}
+	initializeStore(t, store, jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(time.Hour))})
+
+	provider := &flakyProvider{t: t}
+	testerRejects := false
+	jwtRotator := jwtrotator.JWTRotator{
+		SecretsManager: secretsManager,
+		TokenProvider:  provider,
+		Testers: []jwtrotator.Tester{jwtrotator.TesterFunc(func(context.Context, auth.RawToken) error {
+			if testerRejects {
+				return errTokenRejected
+			}
+
+			return nil
+		})},
+	}
+
+	// pending is the PENDING version of the rotation in progress, tested
+	// holds the versions which passed the testSecret step.
+	var pending pendingVersion
+
+	tested := map[string]bool{}
+
+	for i, action := range actions {
+		provider.fail, provider.expired = action.ProviderFails, action.ProviderExpired
+		testerRejects = action.TesterRejects
+
+		if action.Fault != "" {
+			secretsManager.InjectFault(inmemorysecretsmanager2.Fault{
+				Operation: action.Fault,
+				Err:       inmemorysecretsmanager2.ErrInternalService,
+				Times:     1,
+			})
+		}
+
+		err := jwtRotator.Rotate(ctx, jwtrotator.SecretManagerEvent{
+			Step:               action.Step,
+			SecretID:           secretToRotate,
+			ClientRequestToken: propertyTokens[action.Token],
+		})
+
+		secretsManager.ClearFaults()
+
+		switch {
+		case err != nil:
+		case action.Step == step2.CreateSecret && rotationFinished(ctx, store, propertyTokens[action.Token]):
+			// A replayed createSecret of a finished rotation does nothing.
+		case action.Step == step2.CreateSecret:
+			// createSecret may have reprovisioned a stale token.
+			pending = currentPending(ctx, store, propertyTokens[action.Token])
+		case action.Step == step2.TestSecret:
+			tested[currentPending(ctx, store, propertyTokens[action.Token]).VersionID] = true
+		case action.Step == step2.FinishSecret && propertyTokens[action.Token] == pending.ClientRequestToken:
+			pending = pendingVersion{}
+		}
+
+		if violation := checkInvariants(ctx, store, pending, tested); violation != "" {
+			return fmt.Sprintf("after action %d, %s: %s", i, action, violation)
+		}
+	}
+
+	return ""
+}
+
+// pendingVersion is the version holding AWSPENDING for the rotation of
+// ClientRequestToken, which is the token itself or derived from it.
+type pendingVersion struct {
+	ClientRequestToken string
+	VersionID          string
+	Fingerprint        string
+}
+
+func currentPending(ctx context.Context, store jwtrotator.SecretStore, clientRequestToken string) pendingVersion {
+	value, err := store.GetSecretValue(ctx, secretToRotate, "", versionstage2.AWSPending)
+	if err != nil {
+		return pendingVersion{ClientRequestToken: clientRequestToken}
+	}
+
+	var storedToken jwtrotator.StoredToken
+	_ = json.Unmarshal(value.Value, &storedToken)
+
+	return pendingVersion{
+		ClientRequestToken: clientRequestToken,
+		VersionID:          value.VersionID,
+		Fingerprint:        storedToken.Fingerprint(),
+	}
+}
+
+// rotationFinished reports whether AWSCURRENT is held by the version of the
+// rotation of clientRequestToken.
+func rotationFinished(ctx context.Context, store jwtrotator.SecretStore, clientRequestToken string) bool {
+	value, err := store.GetSecretValue(ctx, secretToRotate, "", versionstage2.AwsCurrent)
+
+	return err == nil && (value.VersionID == clientRequestToken || strings.HasPrefix(value.VersionID, clientRequestToken+"-r"))
+}
+
+func checkInvariants(ctx context.Context, store jwtrotator.SecretStore, pending pendingVersion, tested map[string]bool) string {
+	description, err := store.DescribeSecret(ctx, secretToRotate)
+	if err != nil {
+		return fmt.Sprintf("failed to describe secret: %s", err)
+	}
+
+	var current []string
+
+	for versionID, stages := range description.Versions {
+		for _, stage := range stages {
+			if stage == versionstage2.AwsCurrent {
+				current = append(current, versionID)
+			}
+		}
+	}
+
+	if len(current) != 1 {
+		return fmt.Sprintf("expected exactly one %s version, got %v", versionstage2.AwsCurrent, current)
+	}
+
+	for _, stage := range description.Versions[current[0]] {
+		if stage == versionstage2.AWSPending {
+			return fmt.Sprintf("%s version %s still holds %s", versionstage2.AwsCurrent, current[0], versionstage2.AWSPending)
+		}
+	}
+
+	if current[0] != initialVersion && !tested[current[0]] {
+		return fmt.Sprintf("%s version %s never passed the testSecret step", versionstage2.AwsCurrent, current[0])
+	}
+
+	currentValue, err := store.GetSecretValue(ctx, secretToRotate, current[0], versionstage2.AwsCurrent)
+	if err != nil {
+		return fmt.Sprintf("failed to get %s: %s", versionstage2.AwsCurrent, err)
+	}
+
+	if problem := validateStoredToken(currentValue.Value); problem != "" {
+		return fmt.Sprintf("%s version %s holds an invalid token: %s", versionstage2.AwsCurrent, current[0], problem)
+	}
+
+	if pending.ClientRequestToken == "" {
+		return ""
+	}
+
+	if pending.VersionID != pending.ClientRequestToken && !strings.HasPrefix(pending.VersionID, pending.ClientRequestToken+"-r") {
+		return fmt.Sprintf("%s of rotation %s is held by version %q", versionstage2.AWSPending, pending.ClientRequestToken, pending.VersionID)
+	}
+
+	if now := currentPending(ctx, store, pending.ClientRequestToken); now != pending {
+		return fmt.Sprintf("%s of rotation %s was lost or changed: %+v, was %+v", versionstage2.AWSPending, pending.ClientRequestToken, now, pending)
+	}
+
+	return ""
+}
+
+func validateStoredToken(value []byte) string {
+	var storedToken jwtrotator.StoredToken
+	if err := json.Unmarshal(value, &storedToken); err != nil {
+		return err.Error()
+	}
+
+	decoded, err := jwtrotator.DecodeToken(storedToken.RawToken)
+	if err != nil {
+		return err.Error()
+	}
+
+	if decoded.ExpiresAt == nil || time.Now().After(*decoded.ExpiresAt) {
+		return "token is expired or never expires"
+	}
+
+	return ""
+}
+
+// shrinkActions removes actions, and the failures injected by them, as long
+// as the sequence keeps failing.
+func shrinkActions(actions []rotationAction, fails func([]rotationAction) bool) []rotationAction {
+	for chunk := len(actions) / 2; chunk >= 1; {
+		shrunk := false
+
+		for start := 0; start+chunk <= len(actions); {
+			candidate := append(append([]rotationAction{}, actions[:start]...), actions[start+chunk:]...)
+			if fails(candidate) {
+				actions, shrunk = candidate, true
+				continue
+			}
+
+			start++
+		}
+
+		if !shrunk {
+			chunk /= 2
+		}
+	}
+
+	for i := range actions {
+		candidate := append([]rotationAction{}, actions...)
+		candidate[i].ProviderFails, candidate[i].ProviderExpired, candidate[i].TesterRejects, candidate[i].Fault = false, false, false, ""
+
+		if candidate[i] != actions[i] && fails(candidate) {
+			actions = candidate
+		}
+	}
+
+	return actions
+}
+
+func joinActions(actions []rotationAction) string {
+	lines := make([]string, len(actions))
+	for i, action := range actions {
+		lines[i] = action.String()
+	}
+
+	return strings.Join(lines, "\n  ")
+}
+
+func TestShrinkActions(t *testing.T) {
+	// Given
+	actions := generateActions(rand.New(rand.NewSource(1)), 20) //nolint:gosec
+	actions[7] = rotationAction{Step: step2.FinishSecret, Token: 2, ProviderFails: true}
+	actions[13] = rotationAction{Step: step2.TestSecret, Token: 2}
+
+	fails := func(candidate []rotationAction) bool {
+		sawFinish := false
+
+		for _, action := range candidate {
+			sawFinish = sawFinish || (action.Step == step2.FinishSecret && action.Token == 2)
+
+			if sawFinish && action.Step == step2.TestSecret && action.Token == 2 {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	// When
+	minimal := shrinkActions(actions, fails)
+
+	// Then
+	expected := []rotationAction{
+		{Step: step2.FinishSecret, Token: 2},
+		{Step: step2.TestSecret, Token: 2},
+	}
+	if fmt.Sprint(minimal) != fmt.Sprint(expected) {
+		t.Fatalf("expected %v, got %v", expected, minimal)
+	}
+}
+
+var (
+	errProviderUnavailable = errors.New("provider unavailable")
+	errTokenRejected       = errors.New("token rejected")
+)
+
+// flakyProvider issues distinct JWTs valid for an hour, unless it is set to
+// fail or to issue expired tokens.
+type flakyProvider struct {
+	t       *testing.T
+	fail    bool
+	expired bool
+	issued  int
+}
+
+func (p *flakyProvider) GetRawToken(context.Context) (auth.RawToken, error) {
+	if p.fail {
+		return "", errProviderUnavailable
+	}
+
+	p.issued++
+
+	expiresAt := time.Now().Add(time.Hour)
+	if p.expired {
+		expiresAt = time.Now().Add(-time.Minute)
+	}
+
+	return newJWTWithClaims(p.t, map[string]interface{}{
+		"jti": fmt.Sprintf("token-%d", p.issued),
+		"exp": expiresAt.Unix(),
+	}), nil
+}
@@ -0,0 +1,177 @@
+package jwtrotator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/SKF/go-rest-utility/client/auth"
+)
+
+var ErrUnknownSecret = errors.New("no route registered for secret")
+
+// arnRandomSuffixLength is the length of the "-xxxxxx" suffix Secrets Manager
+// appends to the secret name in an ARN.
+const arnRandomSuffixLength = 7
+
+// ProviderFactory constructs the token provider for a secret. It is called
+// on the first rotation of the secret and the provider is then reused for as
+// long as the registry lives, i.e. across warm lambda invocations.
+type ProviderFactory func(ctx context.Context, secretID string) (auth.TokenProvider, error)
+
+// Route configures how the secrets matching a pattern are rotated.
+type Route struct {
+	NewTokenProvider ProviderFactory
+
+	// Rotator is the template of the rotators of the matching secrets, every
+	// option set on it is kept. Its TokenProvider is replaced by the one
+	// NewTokenProvider returns, and its Store and SecretsManager default to
+	// the ones of the Registry.
+	Rotator JWTRotator
+}
+
+type route struct {
+	Route
+	pattern string
+
+	m         sync.Mutex
+	providers map[string]auth.TokenProvider
+}
+
+// Registry rotates several secrets from a single lambda by routing each
+// event to the route registered for its secret. The zero value with a Store
+// or SecretsManager set is ready to use.
+type Registry struct {
+	Store          SecretStore
+	SecretsManager SecretsManagerClient
+
+	routes []*route
+}
+
+// Register adds a route for the secrets matching pattern. The pattern is
+// either an exact ARN, a secret name or a glob as understood by path.Match.
+// Exact matches take precedence over globs, which are tried in the order they
+// were registered.
+func (r *Registry) Register(pattern string, route Route) error {
+	if pattern == "" {
+		return errors.New("pattern must not be empty")
+	}
+
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+	}
+
+	if route.NewTokenProvider == nil {
+		return fmt.Errorf("route for '%s' has no token provider factory", pattern)
+	}
+
+	r.routes = append(r.routes, newRoute(pattern, route))
+
+	return nil
+}
+
+func newRoute(pattern string, r Route) *route {
+	return &route{
+		Route:     r,
+		pattern:   pattern,
+		providers: make(map[string]auth.TokenProvider),
+	}
+}
+
+// Rotate handles a Secrets Manager rotation event for any registered secret.
+func (r *Registry) Rotate(ctx context.Context, event SecretManagerEvent) error {
+	jwtRotator, err := r.Rotator(ctx, event.SecretID)
+	if err != nil {
+		return err
+	}
+
+	return jwtRotator.Rotate(ctx, event)
+}
+
+// Rotator returns the rotator configured for the given secret.
+func (r *Registry) Rotator(ctx context.Context, secretID string) (JWTRotator, error) {
+	matched := r.match(secretID)
+	if matched == nil {
+		return JWTRotator{}, fmt.Errorf("%w: '%s'", ErrUnknownSecret, secretID)
+	}
+
+	tokenProvider, err := matched.tokenProvider(ctx, secretID)
+	if err != nil {
+		return JWTRotator{}, fmt.Errorf("failed to create token provider for '%s': %w", secretID, err)
+	}
+
+	jwtRotator := matched.Rotator
+	jwtRotator.TokenProvider = tokenProvider
+
+	if jwtRotator.Store == nil {
+		jwtRotator.Store = r.Store
+	}
+
+	if jwtRotator.SecretsManager == nil {
+		jwtRotator.SecretsManager = r.SecretsManager
+	}
+
+	return jwtRotator, nil
+}
+
+func (r *Registry) match(secretID string) *route {
+	candidates := []string{secretID}
+	if name, ok := secretNameFromARN(secretID); ok {
+		candidates = append(candidates, name)
+	}
+
+	for _, rt := range r.routes {
+		for _, candidate := range candidates {
+			if rt.pattern == candidate {
+				return rt
+			}
+		}
+	}
+
+	for _, rt := range r.routes {
+		for _, candidate := range candidates {
+			if matched, _ := path.Match(rt.pattern, candidate); matched {
+				return rt
+			}
+		}
+	}
+
+	return nil
+}
+
+func (rt *route) tokenProvider(ctx context.Context, secretID string) (auth.TokenProvider, error) {
+	rt.m.Lock()
+	defer rt.m.Unlock()
+
+	if provider, ok := rt.providers[secretID]; ok {
+		return provider, nil
+	}
+
+	provider, err := rt.NewTokenProvider(ctx, secretID)
+	if err != nil {
+		return nil, err
+	}
+
+	rt.providers[secretID] = provider
+
+	return provider, nil
+}
+
+// secretNameFromARN extracts the secret name from a Secrets Manager ARN such as
+// arn:aws:secretsmanager:eu-west-1:123456789012:secret:name-AbCdEf.
+func secretNameFromARN(secretID string) (string, bool) {
+	parts := strings.SplitN(secretID, ":", 7) //nolint:gomnd // An ARN has 7 parts divided by :
+	if len(parts) != 7 || parts[0] != "arn" || parts[2] != "secretsmanager" || parts[5] != "secret" {
+		return "", false
+	}
+
+	name := parts[6]
+	if len(name) <= arnRandomSuffixLength || name[len(name)-arnRandomSuffixLength] != '-' {
+		return "", false
+	}
+
+	return name[:len(name)-arnRandomSuffixLength], true
+}
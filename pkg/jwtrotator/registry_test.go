@@ -0,0 +1,162 @@
+package jwtrotator_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/SKF/go-rest-utility/client/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator"
+	step2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/step"
+	inmemorysecretsmanager2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/testutils/inmemorysecretsmanager"
+)
+
+const secretToRotateARN = "arn:aws:secretsmanager:eu-west-1:123456789012:secret:secret/to/rotate-AbCdEf"
+
+func TestRegistry_Rotator(t *testing.T) {
+	exactProvider, globProvider := &TokenProviderStub{}, &TokenProviderStub{}
+
+	registry := jwtrotator.Registry{}
+	require.NoError(t, registry.Register("secret/*/rotate", jwtrotator.Route{NewTokenProvider: staticProvider(globProvider)}))
+	require.NoError(t, registry.Register(secretToRotate, jwtrotator.Route{NewTokenProvider: staticProvider(exactProvider)}))
+
+	testCases := []struct {
+		secretID string
+		provider auth.TokenProvider
+	}{
+		{secretID: secretToRotate, provider: exactProvider},
+		{secretID: secretToRotateARN, provider: exactProvider},
+		{secretID: "secret/other/rotate", provider: globProvider},
+		{secretID: "arn:aws:secretsmanager:eu-west-1:123456789012:secret:secret/other/rotate-AbCdEf", provider: globProvider},
+	}
+
+	for _, tc := range testCases {
+		jwtRotator, err := registry.Rotator(context.Background(), tc.secretID)
+		require.NoError(t, err, tc.secretID)
+		assert.Same(t, tc.provider, jwtRotator.TokenProvider, tc.secretID)
+	}
+}
+
+func TestRegistry_Rotate_UnknownSecret(t *testing.T) {
+	// Given
+	registry := jwtrotator.Registry{SecretsManager: inmemorysecretsmanager2.New()}
+	require.NoError(t, registry.Register("secret/other", jwtrotator.Route{NewTokenProvider: staticProvider(&TokenProviderStub{})}))
+
+	// When
+	err := registry.Rotate(context.Background(), jwtrotator.SecretManagerEvent{
+		Step:               step2.CreateSecret,
+		SecretID:           secretToRotate,
+		ClientRequestToken: version0,
+	})
+
+	// Then
+	assert.ErrorIs(t, err, jwtrotator.ErrUnknownSecret)
+}
+
+func TestRegistry_Rotate_CachesProvider(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	secretsManager := inmemorysecretsmanager2.New()
+	initializeStore(t, jwtrotator.SecretsManagerStore{Client: secretsManager}, jwtrotator.StoredToken{RawToken: "first-token"})
+
+	calls := 0
+	registry := jwtrotator.Registry{SecretsManager: secretsManager}
+	require.NoError(t, registry.Register(secretToRotate, jwtrotator.Route{
+		NewTokenProvider: func(context.Context, string) (auth.TokenProvider, error) {
+			calls++
+			return &TokenProviderStub{}, nil
+		},
+	}))
+
+	// When
+	for _, version := range []string{version0, version1} {
+		err := registry.Rotate(ctx, jwtrotator.SecretManagerEvent{
+			Step:               step2.CreateSecret,
+			SecretID:           secretToRotate,
+			ClientRequestToken: version,
+		})
+		require.NoError(t, err)
+	}
+
+	// Then
+	assert.Equal(t, 1, calls)
+}
+
+func TestRegistry_Rotate_ProviderFactoryFails(t *testing.T) {
+	// Given
+	calls := 0
+	registry := jwtrotator.Registry{SecretsManager: inmemorysecretsmanager2.New()}
+	require.NoError(t, registry.Register(secretToRotate, jwtrotator.Route{
+		NewTokenProvider: func(context.Context, string) (auth.TokenProvider, error) {
+			calls++
+			return nil, errors.New("no credentials")
+		},
+	}))
+
+	for i := 0; i < 2; i++ {
+		// When
+		_, err := registry.Rotator(context.Background(), secretToRotate)
+
+		// Then
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "no credentials")
+	}
+
+	assert.Equal(t, 2, calls, "failed providers should not be cached")
+}
+
+func TestRegistry_Register_InvalidPattern(t *testing.T) {
+	registry := jwtrotator.Registry{}
+
+	assert.Error(t, registry.Register("secret/[", jwtrotator.Route{NewTokenProvider: staticProvider(&TokenProviderStub{})}))
+	assert.Error(t, registry.Register("", jwtrotator.Route{NewTokenProvider: staticProvider(&TokenProviderStub{})}))
+	assert.Error(t, registry.Register(secretToRotate, jwtrotator.Route{}))
+}
+
+func staticProvider(provider auth.TokenProvider) jwtrotator.ProviderFactory {
+	return func(context.Context, string) (auth.TokenProvider, error) {
+		return provider, nil
+	}
+}
+
+func TestRegistry_Rotator_CopiesTemplate(t *testing.T) {
+	// Given
+	provider, store := &TokenProviderStub{}, storeFactories["SecretsManagerV1"](t)
+	template := jwtrotator.JWTRotator{
+		CredentialSets:     []jwtrotator.CredentialSet{{Name: "blue", TokenProvider: &TokenProviderStub{}}},
+		Testers:            []jwtrotator.Tester{jwtrotator.TesterFunc(func(context.Context, auth.RawToken) error { return nil })},
+		MinLifetime:        time.Hour,
+		CurrentTokenCheck:  jwtrotator.CurrentTokenCheck{FailOnRevoked: true},
+		Bootstrap:          true,
+		RemoveStalePending: true,
+		CanaryStage:        "BLUE",
+		Revocation:         jwtrotator.Revocation{Revoker: &revokerStub{}, GracePeriod: time.Minute},
+	}
+
+	registry := jwtrotator.Registry{Store: store}
+	require.NoError(t, registry.Register(secretToRotate, jwtrotator.Route{
+		NewTokenProvider: staticProvider(provider),
+		Rotator:          template,
+	}))
+
+	// When
+	jwtRotator, err := registry.Rotator(context.Background(), secretToRotate)
+
+	// Then
+	require.NoError(t, err)
+
+	assert.Equal(t, store, jwtRotator.Store)
+	assert.Equal(t, provider, jwtRotator.TokenProvider)
+	assert.Equal(t, template.CredentialSets, jwtRotator.CredentialSets)
+	assert.Len(t, jwtRotator.Testers, 1)
+	assert.Equal(t, template.MinLifetime, jwtRotator.MinLifetime)
+	assert.Equal(t, template.CurrentTokenCheck, jwtRotator.CurrentTokenCheck)
+	assert.True(t, jwtRotator.Bootstrap)
+	assert.True(t, jwtRotator.RemoveStalePending)
+	assert.Equal(t, template.CanaryStage, jwtRotator.CanaryStage)
+	assert.Equal(t, template.Revocation, jwtRotator.Revocation)
+}
@@ -0,0 +1,212 @@
+package jwtrotator
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/SKF/go-rest-utility/client/auth"
+	"github.com/SKF/go-utility/v2/log"
+
+	versionstage2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/versionstage"
+)
+
+// Revoker revokes a token at the identity provider which issued it.
+type Revoker interface {
+	Revoke(ctx context.Context, token auth.RawToken) error
+}
+
+// RevokerFunc adapts a function to the Revoker interface.
+type RevokerFunc func(ctx context.Context, token auth.RawToken) error
+
+func (f RevokerFunc) Revoke(ctx context.Context, token auth.RawToken) error {
+	return f(ctx, token)
+}
+
+// OAuthRevoker revokes tokens at an OAuth 2.0 token revocation endpoint, RFC
+// 7009. ClientID and ClientSecret, when set, authenticate the request with
+// HTTP basic authentication. TokenTypeHint defaults to access_token.
+type OAuthRevoker struct {
+	URL           string
+	ClientID      string
+	ClientSecret  string
+	TokenTypeHint string
+	Client        *http.Client
+}
+
+func (r OAuthRevoker) Revoke(ctx context.Context, token auth.RawToken) error {
+	tokenTypeHint, client := r.TokenTypeHint, r.Client
+
+	if tokenTypeHint == "" {
+		tokenTypeHint = "access_token"
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	form := url.Values{"token": {token.String()}, "token_type_hint": {tokenTypeHint}}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create revocation request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	if r.ClientID != "" {
+		req.SetBasicAuth(r.ClientID, r.ClientSecret)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to revoke token at %s: %w", r.URL, err)
+	}
+	defer resp.Body.Close()
+
+	// The server responds 200 OK both when the token was revoked and when it
+	// was already invalid.
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("revocation %s responded with status %d, expected %d", r.URL, resp.StatusCode, http.StatusOK)
+	}
+
+	return nil
+}
+
+// Revocation revokes the outgoing token of a rotation once consumers have had
+// GracePeriod to pick up its replacement, see RevokePrevious.
+type Revocation struct {
+	Revoker Revoker
+
+	// GracePeriod is how long the AWSPREVIOUS token stays valid after the
+	// version replacing it was promoted to AWSCURRENT.
+	GracePeriod time.Duration
+}
+
+// RevokePrevious revokes the AWSPREVIOUS token of a secret with the Revoker of
+// the Revocation, once its GracePeriod has passed. The grace period runs from
+// the promotion recorded in the TagPromotedVersion and TagPromotedAt tags, a
+// promotion which was not recorded is recorded now, which starts the grace
+// period late rather than early.
+//
+// The revoked version is labelled JWTREVOKED, which makes later calls skip it
+// and stops Rollback from restoring it. Every attempted revocation is logged
+// and recorded in the TagRevocationVersion, TagRevocationOutcome and
+// TagRevocationAt tags. It returns the ID of the revoked version, or an empty
+// string when no revocation was due.
+func (h JWTRotator) RevokePrevious(ctx context.Context, secretID string) (string, error) {
+	if h.Revocation.Revoker == nil {
+		return "", fmt.Errorf("failed to revoke previous token: no revoker configured")
+	}
+
+	metadata, err := h.store().DescribeSecret(ctx, secretID)
+	if err != nil {
+		return "", fmt.Errorf("failed to describe secret with id '%s': %w", secretID, err)
+	}
+
+	previousVersion, ok := metadata.VersionWithStage(versionstage2.AWSPrevious)
+	if !ok || hasStage(metadata.Versions[previousVersion], versionstage2.JWTRevoked) {
+		return "", nil
+	}
+
+	currentVersion, ok := metadata.VersionWithStage(versionstage2.AwsCurrent)
+	if !ok || currentVersion == previousVersion {
+		return "", nil
+	}
+
+	promotedAt, ok := promotionTime(metadata.Tags, currentVersion)
+	if !ok {
+		log.WithTracing(ctx).Infof("Promotion of %s versionID: %s of secret %s was not recorded, starting its grace period now", versionstage2.AwsCurrent, currentVersion, secretID)
+
+		if err = h.tagPromotion(ctx, secretID, currentVersion); err != nil {
+			return "", err
+		}
+
+		return "", nil
+	}
+
+	if time.Now().Before(promotedAt.Add(h.Revocation.GracePeriod)) {
+		return "", nil
+	}
+
+	previousToken, err := h.getSecret(ctx, secretID, previousVersion, versionstage2.AWSPrevious)
+	if err != nil {
+		return "", fmt.Errorf("failed to get previous secret: %w", err)
+	}
+
+	if expiry, parseErr := previousToken.RawToken.ParseExpires(); parseErr == nil && time.Now().After(expiry) {
+		return "", nil
+	}
+
+	if err = h.Revocation.Revoker.Revoke(ctx, previousToken.RawToken); err != nil {
+		log.WithTracing(ctx).WithError(err).Errorf("Failed to revoke %s versionID: %s of secret %s", versionstage2.AWSPrevious, previousVersion, secretID)
+		h.recordRevocation(ctx, secretID, previousVersion, RevocationFailed)
+
+		return "", fmt.Errorf("failed to revoke previous token: %w", err)
+	}
+
+	log.WithTracing(ctx).Infof("Revoked %s versionID: %s of secret %s, fingerprint: %s", versionstage2.AWSPrevious, previousVersion, secretID, previousToken.Fingerprint())
+	h.recordRevocation(ctx, secretID, previousVersion, RevocationRevoked)
+
+	revokedVersion, _ := metadata.VersionWithStage(versionstage2.JWTRevoked)
+	if err = h.store().MoveStage(ctx, secretID, versionstage2.JWTRevoked, previousVersion, revokedVersion); err != nil {
+		return "", fmt.Errorf("revoked previous token but failed to label it %s: %w", versionstage2.JWTRevoked, err)
+	}
+
+	return previousVersion, nil
+}
+
+// recordPromotion records that versionID was promoted to AWSCURRENT when
+// revocation is configured, it is called right after the promotion. Failing
+// to record it is only logged, as RevokePrevious then records the promotion
+// itself.
+func (h JWTRotator) recordPromotion(ctx context.Context, secretID, versionID string) {
+	if h.Revocation.Revoker == nil {
+		return
+	}
+
+	if err := h.tagPromotion(ctx, secretID, versionID); err != nil {
+		log.WithTracing(ctx).WithError(err).Warnf("Failed to record the promotion of versionID: %s of secret %s", versionID, secretID)
+	}
+}
+
+func (h JWTRotator) tagPromotion(ctx context.Context, secretID, versionID string) error {
+	if err := h.store().TagSecret(ctx, secretID, map[string]string{
+		TagPromotedVersion: versionID,
+		TagPromotedAt:      time.Now().UTC().Format(time.RFC3339Nano),
+	}); err != nil {
+		return fmt.Errorf("failed to record promotion of version %s: %w", versionID, err)
+	}
+
+	return nil
+}
+
+// recordRevocation records the outcome of revoking the token of versionID,
+// the revocation is logged already so failing to record it is only logged.
+func (h JWTRotator) recordRevocation(ctx context.Context, secretID, versionID, outcome string) {
+	if err := h.store().TagSecret(ctx, secretID, map[string]string{
+		TagRevocationVersion: versionID,
+		TagRevocationOutcome: outcome,
+		TagRevocationAt:      time.Now().UTC().Format(time.RFC3339Nano),
+	}); err != nil {
+		log.WithTracing(ctx).WithError(err).Warnf("Failed to record the revocation of versionID: %s of secret %s", versionID, secretID)
+	}
+}
+
+// promotionTime returns when versionID was promoted to AWSCURRENT according to
+// tags, it reports false if its promotion was not recorded.
+func promotionTime(tags map[string]string, versionID string) (time.Time, bool) {
+	if tags[TagPromotedVersion] != versionID {
+		return time.Time{}, false
+	}
+
+	promotedAt, err := time.Parse(time.RFC3339Nano, tags[TagPromotedAt])
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return promotedAt, true
+}
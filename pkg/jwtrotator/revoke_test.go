@@ -0,0 +1,312 @@
+package jwtrotator_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SKF/go-rest-utility/client/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator"
+	step2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/step"
+	inmemorysecretsmanager2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/testutils/inmemorysecretsmanager"
+	versionstage2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/versionstage"
+)
+
+func TestRevokePrevious(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store jwtrotator.SecretStore) {
+		// Given
+		ctx := context.Background()
+		previousToken := newJWT(t, time.Now().Add(time.Hour))
+		promoteOver(t, store, previousToken, newJWT(t, time.Now().Add(2*time.Hour)))
+		tagPromoted(t, store, version0, time.Now())
+
+		revoker := &revokerStub{}
+		jwtRotator := jwtrotator.JWTRotator{
+			Store:      store,
+			Revocation: jwtrotator.Revocation{Revoker: revoker},
+		}
+
+		// When
+		revoked, err := jwtRotator.RevokePrevious(ctx, secretToRotate)
+		require.NoError(t, err)
+
+		revokedAgain, err := jwtRotator.RevokePrevious(ctx, secretToRotate)
+		require.NoError(t, err)
+
+		// Then
+		assert.Equal(t, initialVersion, revoked)
+		assert.Empty(t, revokedAgain)
+		assert.Equal(t, []auth.RawToken{previousToken}, revoker.revoked)
+
+		metadata, err := store.DescribeSecret(ctx, secretToRotate)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []versionstage2.VersionStage{versionstage2.AWSPrevious, versionstage2.JWTRevoked}, metadata.Versions[initialVersion])
+		assert.Equal(t, initialVersion, metadata.Tags[jwtrotator.TagRevocationVersion])
+		assert.Equal(t, jwtrotator.RevocationRevoked, metadata.Tags[jwtrotator.TagRevocationOutcome])
+		assert.NotEmpty(t, metadata.Tags[jwtrotator.TagRevocationAt])
+	})
+}
+
+func TestRevokePrevious_NotDue(t *testing.T) {
+	for name, test := range map[string]struct {
+		previousToken auth.RawToken
+		gracePeriod   time.Duration
+	}{
+		"within grace period": {previousToken: newJWT(t, time.Now().Add(time.Hour)), gracePeriod: time.Hour},
+		"already expired":     {previousToken: newJWT(t, time.Now().Add(-time.Minute))},
+	} {
+		test := test
+
+		t.Run(name, func(t *testing.T) {
+			// Given
+			store := storeFactories["SecretsManagerV1"](t)
+			promoteOver(t, store, test.previousToken, newJWT(t, time.Now().Add(2*time.Hour)))
+			tagPromoted(t, store, version0, time.Now())
+
+			revoker := &revokerStub{}
+			jwtRotator := jwtrotator.JWTRotator{
+				Store:      store,
+				Revocation: jwtrotator.Revocation{Revoker: revoker, GracePeriod: test.gracePeriod},
+			}
+
+			// When
+			revoked, err := jwtRotator.RevokePrevious(context.Background(), secretToRotate)
+
+			// Then
+			require.NoError(t, err)
+			assert.Empty(t, revoked)
+			assert.Empty(t, revoker.revoked)
+		})
+	}
+}
+
+func TestRevokePrevious_RevokerFails(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	store := storeFactories["SecretsManagerV1"](t)
+	promoteOver(t, store, newJWT(t, time.Now().Add(time.Hour)), newJWT(t, time.Now().Add(2*time.Hour)))
+	tagPromoted(t, store, version0, time.Now())
+
+	jwtRotator := jwtrotator.JWTRotator{
+		Store: store,
+		Revocation: jwtrotator.Revocation{
+			Revoker: jwtrotator.RevokerFunc(func(context.Context, auth.RawToken) error {
+				return fmt.Errorf("provider unavailable")
+			}),
+		},
+	}
+
+	// When
+	_, err := jwtRotator.RevokePrevious(ctx, secretToRotate)
+
+	// Then
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "provider unavailable")
+
+	metadata, err := store.DescribeSecret(ctx, secretToRotate)
+	require.NoError(t, err)
+	assert.Equal(t, []versionstage2.VersionStage{versionstage2.AWSPrevious}, metadata.Versions[initialVersion])
+	assert.Equal(t, initialVersion, metadata.Tags[jwtrotator.TagRevocationVersion])
+	assert.Equal(t, jwtrotator.RevocationFailed, metadata.Tags[jwtrotator.TagRevocationOutcome])
+}
+
+func TestRevokePrevious_GracePeriodFromPromotion(t *testing.T) {
+	// Given
+	const gracePeriod = 100 * time.Millisecond
+
+	ctx := context.Background()
+	store := storeFactories["SecretsManagerV1"](t)
+	initializeStore(t, store, jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(time.Hour))})
+	putToken(t, store, version0, jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(2*time.Hour))}, versionstage2.JWTCanary)
+
+	revoker := &revokerStub{}
+	jwtRotator := jwtrotator.JWTRotator{
+		Store:      store,
+		Revocation: jwtrotator.Revocation{Revoker: revoker, GracePeriod: gracePeriod},
+	}
+
+	// The canary is promoted once the grace period has passed since its
+	// version was created.
+	time.Sleep(2 * gracePeriod)
+
+	_, err := jwtRotator.PromoteCanary(ctx, secretToRotate)
+	require.NoError(t, err)
+
+	// When
+	revokedAfterPromotion, err := jwtRotator.RevokePrevious(ctx, secretToRotate)
+	require.NoError(t, err)
+
+	time.Sleep(2 * gracePeriod)
+
+	revokedAfterGracePeriod, err := jwtRotator.RevokePrevious(ctx, secretToRotate)
+	require.NoError(t, err)
+
+	// Then
+	assert.Empty(t, revokedAfterPromotion)
+	assert.Equal(t, initialVersion, revokedAfterGracePeriod)
+	assert.Len(t, revoker.revoked, 1)
+}
+
+func TestRevokePrevious_RotationRecordsPromotion(t *testing.T) {
+	for name, test := range map[string]struct {
+		client      jwtrotator.SecretsManagerClient
+		expectedErr error
+	}{
+		"tagging client": {client: inmemorysecretsmanager2.New()},
+		// Existing v1 clients without TagResourceWithContext keep rotating,
+		// but can not record promotions for revocation.
+		"client without tagging": {
+			client:      clientWithoutTagging{SecretsManagerClient: inmemorysecretsmanager2.New()},
+			expectedErr: jwtrotator.ErrTaggingNotSupported,
+		},
+	} {
+		test := test
+
+		t.Run(name, func(t *testing.T) {
+			// Given
+			ctx := context.Background()
+			store := jwtrotator.SecretsManagerStore{Client: test.client}
+			initializeStore(t, store, jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(5*time.Minute))})
+
+			tokenProvider := &JWTProviderStub{t: t}
+			jwtRotator := jwtrotator.JWTRotator{
+				Store:         store,
+				TokenProvider: tokenProvider,
+				Revocation:    jwtrotator.Revocation{Revoker: &revokerStub{}},
+			}
+
+			for _, rotationStep := range []step2.Step{step2.CreateSecret, step2.TestSecret, step2.FinishSecret} {
+				require.NoError(t, rotateStep(ctx, jwtRotator, rotationStep, version0))
+			}
+
+			// When
+			revoked, err := jwtRotator.RevokePrevious(ctx, secretToRotate)
+
+			// Then
+			assert.Equal(t, tokenProvider.issued[0], getCurrentToken(t, store).RawToken)
+
+			if test.expectedErr != nil {
+				require.ErrorIs(t, err, test.expectedErr)
+				assert.Empty(t, revoked)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, initialVersion, revoked)
+		})
+	}
+}
+
+func TestRevokePrevious_PromotionNotRecorded(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	store := storeFactories["SecretsManagerV1"](t)
+	promoteOver(t, store, newJWT(t, time.Now().Add(time.Hour)), newJWT(t, time.Now().Add(2*time.Hour)))
+
+	revoker := &revokerStub{}
+	jwtRotator := jwtrotator.JWTRotator{
+		Store:      store,
+		Revocation: jwtrotator.Revocation{Revoker: revoker},
+	}
+
+	// When
+	revokedFirst, err := jwtRotator.RevokePrevious(ctx, secretToRotate)
+	require.NoError(t, err)
+
+	revokedSecond, err := jwtRotator.RevokePrevious(ctx, secretToRotate)
+	require.NoError(t, err)
+
+	// Then
+	assert.Empty(t, revokedFirst)
+	assert.Equal(t, initialVersion, revokedSecond)
+	assert.Len(t, revoker.revoked, 1)
+}
+
+func TestRollback_Revoked(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	store := storeFactories["SecretsManagerV1"](t)
+	currentToken := newJWT(t, time.Now().Add(2*time.Hour))
+	promoteOver(t, store, newJWT(t, time.Now().Add(time.Hour)), currentToken)
+	tagPromoted(t, store, version0, time.Now())
+
+	jwtRotator := jwtrotator.JWTRotator{
+		Store:      store,
+		Revocation: jwtrotator.Revocation{Revoker: &revokerStub{}},
+	}
+
+	_, err := jwtRotator.RevokePrevious(ctx, secretToRotate)
+	require.NoError(t, err)
+
+	// When
+	_, err = jwtRotator.Rollback(ctx, secretToRotate, "bad deploy")
+
+	// Then
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "its token was revoked")
+	assert.Equal(t, currentToken, getCurrentToken(t, store).RawToken)
+}
+
+func TestOAuthRevoker(t *testing.T) {
+	// Given
+	token := newJWT(t, time.Now().Add(time.Hour))
+
+	var revoked []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != "rotator" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "access_token", r.PostForm.Get("token_type_hint"))
+		revoked = append(revoked, r.PostForm.Get("token"))
+	}))
+	defer server.Close()
+
+	// When
+	err := jwtrotator.OAuthRevoker{URL: server.URL, ClientID: "rotator", ClientSecret: "secret"}.Revoke(context.Background(), token)
+	unauthorizedErr := jwtrotator.OAuthRevoker{URL: server.URL}.Revoke(context.Background(), token)
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, []string{token.String()}, revoked)
+	require.Error(t, unauthorizedErr)
+	assert.Contains(t, unauthorizedErr.Error(), "responded with status 401")
+}
+
+// tagPromoted records the promotion of versionID to AWSCURRENT like the
+// rotator does when it promotes a version.
+func tagPromoted(t *testing.T, store jwtrotator.SecretStore, versionID string, promotedAt time.Time) {
+	t.Helper()
+
+	err := store.TagSecret(context.Background(), secretToRotate, map[string]string{
+		jwtrotator.TagPromotedVersion: versionID,
+		jwtrotator.TagPromotedAt:      promotedAt.UTC().Format(time.RFC3339Nano),
+	})
+	require.NoError(t, err)
+}
+
+// clientWithoutTagging is a SecretsManagerClient written before tagging was
+// used, it does not implement SecretsManagerTagger.
+type clientWithoutTagging struct {
+	jwtrotator.SecretsManagerClient
+}
+
+type revokerStub struct {
+	revoked []auth.RawToken
+}
+
+func (r *revokerStub) Revoke(_ context.Context, token auth.RawToken) error {
+	r.revoked = append(r.revoked, token)
+
+	return nil
+}
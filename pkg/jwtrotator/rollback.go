@@ -0,0 +1,88 @@
+package jwtrotator
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/SKF/go-utility/v2/log"
+
+	versionstage2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/versionstage"
+)
+
+// Rollback restores the AWSPREVIOUS version of a secret as AWSCURRENT, for
+// when a newly promoted token turns out to be bad. The previous token must
+// still pass the same checks as in the testSecret step, so an expired,
+// revoked, compromised or rejected token is never restored. The demoted
+// version becomes AWSPREVIOUS.
+//
+// The reason is logged together with the versions swapped, and recorded in
+// the TagRollbackFrom, TagRollbackTo, TagRollbackReason and TagRollbackAt
+// tags. It returns the ID of the restored version.
+func (h JWTRotator) Rollback(ctx context.Context, secretID, reason string) (string, error) {
+	metadata, err := h.store().DescribeSecret(ctx, secretID)
+	if err != nil {
+		return "", fmt.Errorf("failed to describe secret with id '%s': %w", secretID, err)
+	}
+
+	currentVersion, ok := metadata.VersionWithStage(versionstage2.AwsCurrent)
+	if !ok {
+		return "", fmt.Errorf("failed to roll back: %w: no secret with stage %s found", ErrResourceNotFound, versionstage2.AwsCurrent)
+	}
+
+	previousVersion, ok := metadata.VersionWithStage(versionstage2.AWSPrevious)
+	if !ok {
+		return "", fmt.Errorf("failed to roll back: %w: no secret with stage %s found", ErrResourceNotFound, versionstage2.AWSPrevious)
+	}
+
+	if previousVersion == currentVersion {
+		return "", fmt.Errorf("failed to roll back: version %s is both %s and %s", currentVersion, versionstage2.AwsCurrent, versionstage2.AWSPrevious)
+	}
+
+	if hasStage(metadata.Versions[previousVersion], versionstage2.Compromised(previousVersion)) {
+		return "", fmt.Errorf("refusing to roll back to version %s: its token was compromised", previousVersion)
+	}
+
+	if hasStage(metadata.Versions[previousVersion], versionstage2.JWTRevoked) {
+		return "", fmt.Errorf("refusing to roll back to version %s: its token was revoked", previousVersion)
+	}
+
+	storedToken, err := h.getSecret(ctx, secretID, previousVersion, versionstage2.AWSPrevious)
+	if err != nil {
+		return "", fmt.Errorf("failed to get previous secret: %w", err)
+	}
+
+	if err = h.validateToken(ctx, storedToken, "PREVIOUS"); err != nil {
+		return "", fmt.Errorf("refusing to roll back to version %s: %w", previousVersion, err)
+	}
+
+	if err = h.store().MoveStage(ctx, secretID, versionstage2.AwsCurrent, previousVersion, currentVersion); err != nil {
+		return "", fmt.Errorf("failed to update secret from PREVIOUS to CURRENT: %w", err)
+	}
+
+	h.recordPromotion(ctx, secretID, previousVersion)
+
+	log.WithTracing(ctx).Warnf("Rolled back secret %s from versionID: %s to versionID: %s, reason: %s", secretID, currentVersion, previousVersion, reason)
+
+	h.recordRollback(ctx, secretID, currentVersion, previousVersion, reason)
+
+	return previousVersion, nil
+}
+
+// recordRollback tags the secret with the rollback which was just made. The
+// rollback already happened, so a failure is only logged. A reason too long
+// for a tag value is truncated.
+func (h JWTRotator) recordRollback(ctx context.Context, secretID, fromVersionID, toVersionID, reason string) {
+	if runes := []rune(reason); len(runes) > maxTagValueLength {
+		reason = string(runes[:maxTagValueLength])
+	}
+
+	if err := h.store().TagSecret(ctx, secretID, map[string]string{
+		TagRollbackFrom:   fromVersionID,
+		TagRollbackTo:     toVersionID,
+		TagRollbackReason: reason,
+		TagRollbackAt:     time.Now().UTC().Format(time.RFC3339Nano),
+	}); err != nil {
+		log.WithTracing(ctx).WithError(err).Warnf("Failed to record the rollback of secret %s to versionID: %s", secretID, toVersionID)
+	}
+}
@@ -0,0 +1,125 @@
+package jwtrotator_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/SKF/go-rest-utility/client/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator"
+	versionstage2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/versionstage"
+)
+
+func TestRollback(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store jwtrotator.SecretStore) {
+		// Given
+		ctx := context.Background()
+		previousToken := newJWT(t, time.Now().Add(time.Hour))
+		promoteOver(t, store, previousToken, newJWT(t, time.Now().Add(time.Hour)))
+
+		var testedToken auth.RawToken
+
+		jwtRotator := jwtrotator.JWTRotator{
+			Store: store,
+			Testers: []jwtrotator.Tester{
+				jwtrotator.TesterFunc(func(_ context.Context, token auth.RawToken) error {
+					testedToken = token
+					return nil
+				}),
+			},
+		}
+
+		// When
+		restored, err := jwtRotator.Rollback(ctx, secretToRotate, "new token rejected by API")
+
+		// Then
+		require.NoError(t, err)
+		assert.Equal(t, initialVersion, restored)
+		assert.Equal(t, previousToken, testedToken)
+		assert.Equal(t, previousToken, getCurrentToken(t, store).RawToken)
+
+		description, err := store.DescribeSecret(ctx, secretToRotate)
+		require.NoError(t, err)
+		assert.Contains(t, description.Versions[version0], versionstage2.AWSPrevious)
+		assert.Equal(t, version0, description.Tags[jwtrotator.TagRollbackFrom])
+		assert.Equal(t, initialVersion, description.Tags[jwtrotator.TagRollbackTo])
+		assert.Equal(t, "new token rejected by API", description.Tags[jwtrotator.TagRollbackReason])
+
+		rolledBackAt, err := time.Parse(time.RFC3339Nano, description.Tags[jwtrotator.TagRollbackAt])
+		require.NoError(t, err)
+		assert.WithinDuration(t, time.Now(), rolledBackAt, time.Minute)
+	})
+}
+
+func TestRollback_ExpiredPrevious(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store jwtrotator.SecretStore) {
+		// Given
+		currentToken := newJWT(t, time.Now().Add(time.Hour))
+		promoteOver(t, store, newJWT(t, time.Now().Add(-time.Minute)), currentToken)
+
+		jwtRotator := jwtrotator.JWTRotator{Store: store}
+
+		// When
+		_, err := jwtRotator.Rollback(context.Background(), secretToRotate, "")
+
+		// Then
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "PREVIOUS token already expired")
+		assert.Equal(t, currentToken, getCurrentToken(t, store).RawToken)
+	})
+}
+
+func TestRollback_RejectedByTester(t *testing.T) {
+	// Given
+	store := storeFactories["SecretsManagerV1"](t)
+	currentToken := newJWT(t, time.Now().Add(time.Hour))
+	promoteOver(t, store, newJWT(t, time.Now().Add(time.Hour)), currentToken)
+
+	jwtRotator := jwtrotator.JWTRotator{
+		Store: store,
+		Testers: []jwtrotator.Tester{
+			jwtrotator.TesterFunc(func(context.Context, auth.RawToken) error {
+				return fmt.Errorf("rejected by API")
+			}),
+		},
+	}
+
+	// When
+	_, err := jwtRotator.Rollback(context.Background(), secretToRotate, "")
+
+	// Then
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "rejected by API")
+	assert.Equal(t, currentToken, getCurrentToken(t, store).RawToken)
+}
+
+func TestRollback_NoPrevious(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store jwtrotator.SecretStore) {
+		// Given
+		initializeStore(t, store, jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(time.Hour))})
+
+		jwtRotator := jwtrotator.JWTRotator{Store: store}
+
+		// When
+		_, err := jwtRotator.Rollback(context.Background(), secretToRotate, "")
+
+		// Then
+		assert.ErrorIs(t, err, jwtrotator.ErrResourceNotFound)
+	})
+}
+
+// promoteOver stores previous as the initial version and promotes current
+// over it, leaving previous labelled AWSPREVIOUS.
+func promoteOver(t *testing.T, store jwtrotator.SecretStore, previous, current auth.RawToken) {
+	t.Helper()
+
+	initializeStore(t, store, jwtrotator.StoredToken{RawToken: previous})
+	putToken(t, store, version0, jwtrotator.StoredToken{RawToken: current}, versionstage2.AWSPending)
+
+	err := store.MoveStage(context.Background(), secretToRotate, versionstage2.AwsCurrent, version0, initialVersion)
+	require.NoError(t, err)
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/google/uuid"
 
 	step2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/step"
 	versionstage2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/versionstage"
@@ -24,9 +25,54 @@ type SecretsManagerClient interface {
 	GetSecretValueWithContext(ctx aws.Context, input *secretsmanager.GetSecretValueInput, opts ...request.Option) (*secretsmanager.GetSecretValueOutput, error)
 }
 
+// BootstrapVersionID is the version ID used for the first token of a secret
+// provisioned in bootstrap mode. Using a fixed ID makes a concurrent or
+// repeated bootstrap fail instead of overwriting an already stored token.
+const BootstrapVersionID = "jwt-rotator-bootstrap-0000000000000000"
+
 type JWTRotator struct {
+	// Store holds the rotated secrets. When it is nil the secrets are kept in
+	// AWS Secrets Manager through SecretsManager.
+	Store SecretStore
+
 	SecretsManager SecretsManagerClient
 	TokenProvider  auth.TokenProvider
+
+	// CredentialSets replace TokenProvider with credentials that are
+	// alternated between on each rotation, for identity providers which
+	// revoke earlier tokens when the same client signs in again. The
+	// outgoing token then stays valid until the rotation after next.
+	CredentialSets []CredentialSet
+
+	// Testers are run against the PENDING token in the testSecret step, any
+	// failing tester stops the token from being promoted.
+	Testers []Tester
+
+	// MinLifetime is the shortest remaining lifetime a PENDING token must
+	// have to pass the testSecret step.
+	MinLifetime time.Duration
+
+	// CurrentTokenCheck verifies in the testSecret step that the AWSCURRENT
+	// token is still accepted after the PENDING token was minted.
+	CurrentTokenCheck CurrentTokenCheck
+
+	// Bootstrap enables provisioning the first token straight from the
+	// TokenProvider when a secret without an AWSCURRENT version is rotated.
+	Bootstrap bool
+
+	// RemoveStalePending removes an AWSPENDING label left on a version of an
+	// abandoned rotation in the createSecret step, before the new token is
+	// provisioned. Otherwise the label is only logged, and moved once the new
+	// token is stored.
+	RemoveStalePending bool
+
+	// CanaryStage is the custom staging label of the canary tokens staged by
+	// StageCanary and promoted by PromoteCanary, it defaults to JWTCANARY.
+	CanaryStage versionstage2.VersionStage
+
+	// Revocation revokes the AWSPREVIOUS token after a grace period, when
+	// RevokePrevious is called, e.g. by a scheduler.
+	Revocation Revocation
 }
 
 type SecretManagerEvent struct {
@@ -60,40 +106,191 @@ func (h JWTRotator) Rotate(ctx context.Context, event SecretManagerEvent) error
 	return nil
 }
 
+// RotateNow runs every rotation step for a new version of the secret, for
+// stores without a rotation schedule of their own. It returns the version ID
+// of the new AWSCURRENT token.
+func (h JWTRotator) RotateNow(ctx context.Context, secretID string) (string, error) {
+	versionID := uuid.New().String()
+
+	for _, step := range []step2.Step{step2.CreateSecret, step2.SetSecret, step2.TestSecret, step2.FinishSecret} {
+		if err := h.Rotate(ctx, SecretManagerEvent{
+			Step:               step,
+			SecretID:           secretID,
+			ClientRequestToken: versionID,
+		}); err != nil {
+			return "", fmt.Errorf("%s step failed: %w", step, err)
+		}
+	}
+
+	return versionID, nil
+}
+
 func (h JWTRotator) createSecret(ctx context.Context, version secretVersion) error {
 	log.WithTracing(ctx).Infof("Creating secret with versionID: %s", version.ClientRequestToken)
 
-	if _, err := h.getCurrentSecret(ctx, version.SecretID); err != nil {
+	if _, err := h.getCurrentSecret(ctx, version.SecretID); errors.Is(err, ErrResourceNotFound) && h.Bootstrap {
+		if _, err = h.InitializeSecret(ctx, version.SecretID); err != nil {
+			return fmt.Errorf("failed to bootstrap secret: %w", err)
+		}
+	} else if err != nil {
 		return fmt.Errorf("failed to create secret: no secret with stage %s found: %w", versionstage2.AwsCurrent, err)
 	}
 
-	_, err := h.getPendingSecret(ctx, version)
+	if finished, err := h.rotationFinished(ctx, version); err != nil {
+		return err
+	} else if finished {
+		return nil
+	}
+
+	pendingVersion, storedToken, err := h.getPendingSecret(ctx, version)
 	if errors.Is(err, ErrResourceNotFound) {
-		if err = h.provisionNewToken(ctx, version); err != nil {
+		if err = h.handleStalePending(ctx, version, err); err != nil {
+			return err
+		}
+
+		if err = h.provisionPendingToken(ctx, version); err != nil {
 			return fmt.Errorf("failed to provision new token: %w", err)
 		}
+
+		return nil
 	} else if err != nil {
 		return fmt.Errorf("failed to get pending secret: %w", err)
 	}
 
+	if reason := h.staleReason(storedToken); reason != "" {
+		log.WithTracing(ctx).Warnf("PENDING token of versionID: %s %s, provisioning a new one", pendingVersion, reason)
+
+		attempt, _ := reprovisionAttempt(version.ClientRequestToken, pendingVersion)
+		if err = h.reprovisionPendingToken(ctx, version, attempt+1); err != nil {
+			return fmt.Errorf("failed to reprovision stale token: %w", err)
+		}
+	}
+
 	return nil
 }
 
+// rotationFinished reports whether AWSCURRENT is held by the version of the
+// rotation, a replayed createSecret step then has nothing left to do.
+func (h JWTRotator) rotationFinished(ctx context.Context, version secretVersion) (bool, error) {
+	metadata, err := h.store().DescribeSecret(ctx, version.SecretID)
+	if err != nil {
+		return false, fmt.Errorf("failed to describe secret with id '%s': %w", version.SecretID, err)
+	}
+
+	currentVersion, ok := metadata.VersionWithStage(versionstage2.AwsCurrent)
+	if !ok {
+		return false, nil
+	}
+
+	_, finished := reprovisionAttempt(version.ClientRequestToken, currentVersion)
+
+	return finished, nil
+}
+
+// InitializeSecret provisions the first token of a secret and stores it as
+// AWSCURRENT. It never overwrites an existing value and reports whether a
+// token was stored, a secret which already has an AWSCURRENT version is left
+// untouched.
+func (h JWTRotator) InitializeSecret(ctx context.Context, secretID string) (bool, error) {
+	_, err := h.getCurrentSecret(ctx, secretID)
+	if err == nil {
+		return false, nil
+	} else if !errors.Is(err, ErrResourceNotFound) {
+		return false, fmt.Errorf("failed to get current secret: %w", err)
+	}
+
+	log.WithTracing(ctx).Infof("Bootstrapping secret %s with versionID: %s", secretID, BootstrapVersionID)
+
+	err = h.provisionNewToken(ctx, secretVersion{
+		SecretID:           secretID,
+		ClientRequestToken: BootstrapVersionID,
+	}, versionstage2.AwsCurrent)
+	if !errors.Is(err, ErrResourceExists) {
+		return err == nil, err
+	}
+
+	// Someone else bootstrapped the secret concurrently, make sure their
+	// token made it to AWSCURRENT before backing off.
+	if _, err = h.getCurrentSecret(ctx, secretID); err != nil {
+		return false, fmt.Errorf("bootstrap version exists but no secret with stage %s found: %w", versionstage2.AwsCurrent, err)
+	}
+
+	return false, nil
+}
+
 func (h JWTRotator) testSecret(ctx context.Context, version secretVersion) error {
 	log.WithTracing(ctx).Infof("Testing secret with versionID: %s", version.ClientRequestToken)
 
-	storedToken, err := h.getPendingSecret(ctx, version)
+	pendingVersion, storedToken, err := h.getPendingSecret(ctx, version)
 	if err != nil {
 		return fmt.Errorf("failed to get pending secret: %w", err)
 	}
 
+	if err = h.validateToken(ctx, storedToken, "PENDING"); err != nil {
+		return err
+	}
+
+	if err = h.checkCurrentToken(ctx, version, storedToken); err != nil {
+		return err
+	}
+
+	return h.markTested(ctx, version.SecretID, pendingVersion)
+}
+
+// markTested labels the version which passed the testSecret step, so the
+// finishSecret step only promotes tested tokens.
+func (h JWTRotator) markTested(ctx context.Context, secretID, versionID string) error {
+	metadata, err := h.store().DescribeSecret(ctx, secretID)
+	if err != nil {
+		return fmt.Errorf("failed to describe secret with id '%s': %w", secretID, err)
+	}
+
+	testedVersion, _ := metadata.VersionWithStage(versionstage2.JWTTested)
+	if testedVersion == versionID {
+		return nil
+	}
+
+	if err = h.store().MoveStage(ctx, secretID, versionstage2.JWTTested, versionID, testedVersion); err != nil {
+		return fmt.Errorf("failed to label version %s %s: %w", versionID, versionstage2.JWTTested, err)
+	}
+
+	return nil
+}
+
+// removeTested removes the label of a tested version once it leaves the
+// rotation, it is only meaningful while the version is PENDING.
+func (h JWTRotator) removeTested(ctx context.Context, secretID string, metadata SecretDescription, versionID string) error {
+	if !hasStage(metadata.Versions[versionID], versionstage2.JWTTested) {
+		return nil
+	}
+
+	if err := h.store().MoveStage(ctx, secretID, versionstage2.JWTTested, "", versionID); err != nil {
+		return fmt.Errorf("failed to remove %s from version %s: %w", versionstage2.JWTTested, versionID, err)
+	}
+
+	return nil
+}
+
+// validateToken checks that the token, described by label in errors, lives at
+// least MinLifetime and passes every tester.
+func (h JWTRotator) validateToken(ctx context.Context, storedToken StoredToken, label string) error {
 	expiry, err := storedToken.RawToken.ParseExpires()
 	if err != nil {
 		return fmt.Errorf("failed to parse JWT expiry: %w", err)
 	}
 
 	if time.Now().After(expiry) {
-		return fmt.Errorf("JWT token test failed: PENDING token already expired")
+		return fmt.Errorf("JWT token test failed: %s token already expired", label)
+	}
+
+	if lifetime := time.Until(expiry); lifetime < h.MinLifetime {
+		return fmt.Errorf("JWT token test failed: %s token expires in %s, minimum lifetime is %s", label, lifetime.Round(time.Second), h.MinLifetime)
+	}
+
+	for _, tester := range h.Testers {
+		if err = tester.Test(ctx, storedToken.RawToken); err != nil {
+			return fmt.Errorf("JWT token test failed: %w", err)
+		}
 	}
 
 	return nil
@@ -102,112 +299,149 @@ func (h JWTRotator) testSecret(ctx context.Context, version secretVersion) error
 func (h JWTRotator) finishSecret(ctx context.Context, version secretVersion) error {
 	log.WithTracing(ctx).Infof("Finishing secret with versionID: %s", version.ClientRequestToken)
 
-	metadata, err := h.SecretsManager.DescribeSecretWithContext(ctx, &secretsmanager.DescribeSecretInput{
-		SecretId: &version.SecretID,
-	})
+	metadata, err := h.store().DescribeSecret(ctx, version.SecretID)
 	if err != nil {
-		return fmt.Errorf("failed to describe secret with id '%s': %w", version.SecretID, parseAWSError(err))
+		return fmt.Errorf("failed to describe secret with id '%s': %w", version.SecretID, err)
 	}
 
-	currentVersion, err := h.findCurrentVersion(metadata)
-	if err != nil {
-		return fmt.Errorf("could not find current version: %w", err)
+	currentVersion, ok := metadata.VersionWithStage(versionstage2.AwsCurrent)
+	if !ok {
+		return fmt.Errorf("could not find current version: could not find secret with stage %s in metadata", versionstage2.AwsCurrent)
 	}
 
-	if currentVersion == version.ClientRequestToken {
-		return nil
+	// The PENDING token may have been reprovisioned under a derived version ID.
+	pendingVersion, isPending := metadata.VersionWithStage(versionstage2.AWSPending)
+	if isPending {
+		_, isPending = reprovisionAttempt(version.ClientRequestToken, pendingVersion)
 	}
 
-	if _, err = h.SecretsManager.UpdateSecretVersionStageWithContext(ctx, &secretsmanager.UpdateSecretVersionStageInput{
-		MoveToVersionId:     &version.ClientRequestToken,
-		RemoveFromVersionId: &currentVersion,
-		SecretId:            &version.SecretID,
-		VersionStage:        versionstage2.AwsCurrent.StringPtr(),
-	}); err != nil {
-		return fmt.Errorf("failed to update secret from PENDING to CURRENT: %w", parseAWSError(err))
-	}
+	if _, ok = reprovisionAttempt(version.ClientRequestToken, currentVersion); !ok {
+		if isPending && !hasStage(metadata.Versions[pendingVersion], versionstage2.JWTTested) {
+			return fmt.Errorf("refusing to promote version %s: %w", pendingVersion, ErrNotTested)
+		}
 
-	return nil
-}
+		if !isPending {
+			return fmt.Errorf("refusing to promote version %s: %w", version.ClientRequestToken, ErrNotPending)
+		}
+
+		if err = h.checkPromotable(ctx, version.SecretID, pendingVersion); err != nil {
+			return fmt.Errorf("refusing to promote version %s: %w", pendingVersion, err)
+		}
 
-func (h JWTRotator) findCurrentVersion(metadata *secretsmanager.DescribeSecretOutput) (string, error) {
-	for versionID, stages := range metadata.VersionIdsToStages {
-		for _, stage := range stages {
-			if stageEquals(stage, versionstage2.AwsCurrent) {
-				return versionID, nil
-			}
+		if err = h.store().MoveStage(ctx, version.SecretID, versionstage2.AwsCurrent, pendingVersion, currentVersion); err != nil {
+			return fmt.Errorf("failed to update secret from PENDING to CURRENT: %w", err)
 		}
+
+		h.recordPromotion(ctx, version.SecretID, pendingVersion)
+
+		currentVersion = pendingVersion
 	}
 
-	return "", fmt.Errorf("could not find secret with stage %s in metadata", versionstage2.AwsCurrent)
-}
+	// Also done when a retried finishSecret finds the version already
+	// promoted, in case removing the label failed the first time.
+	if isPending && pendingVersion == currentVersion {
+		if err = h.removeTested(ctx, version.SecretID, metadata, pendingVersion); err != nil {
+			return err
+		}
+
+		if err = h.store().MoveStage(ctx, version.SecretID, versionstage2.AWSPending, "", pendingVersion); err != nil {
+			return fmt.Errorf("failed to remove %s from the promoted version: %w", versionstage2.AWSPending, err)
+		}
+	}
 
-func stageEquals(stage *string, versionStage versionstage2.VersionStage) bool {
-	return stage != nil && *stage == string(versionStage)
+	return nil
 }
 
-func (h JWTRotator) provisionNewToken(ctx context.Context, version secretVersion) error {
-	rawToken, err := h.TokenProvider.GetRawToken(ctx)
+// checkPromotable re-runs the lightweight part of the testSecret checks on a
+// PENDING version right before it is promoted, the token must be decodable
+// and not yet expired.
+func (h JWTRotator) checkPromotable(ctx context.Context, secretID, versionID string) error {
+	storedToken, err := h.getSecret(ctx, secretID, versionID, versionstage2.AWSPending)
 	if err != nil {
-		return fmt.Errorf("failed to provision new token: %w", err)
+		return fmt.Errorf("failed to get pending secret: %w", err)
 	}
 
-	secretBytes, err := json.Marshal(StoredToken{RawToken: rawToken})
+	expiry, err := storedToken.RawToken.ParseExpires()
 	if err != nil {
-		return fmt.Errorf("failed to marshal secretmodel: %w", err)
+		return fmt.Errorf("failed to parse JWT expiry: %w", err)
 	}
 
-	if _, err = h.SecretsManager.PutSecretValueWithContext(ctx, &secretsmanager.PutSecretValueInput{
-		ClientRequestToken: &version.ClientRequestToken,
-		SecretBinary:       secretBytes,
-		SecretId:           &version.SecretID,
-		VersionStages:      []*string{versionstage2.AWSPending.StringPtr()},
-	}); err != nil {
-		return fmt.Errorf("failed to put secret value: %w", parseAWSError(err))
+	if time.Now().After(expiry) {
+		return fmt.Errorf("PENDING token already expired")
 	}
 
 	return nil
 }
 
-func (h JWTRotator) getPendingSecret(ctx context.Context, version secretVersion) (StoredToken, error) {
-	return h.getSecret(ctx, secretsmanager.GetSecretValueInput{
-		SecretId:     &version.SecretID,
-		VersionId:    &version.ClientRequestToken,
-		VersionStage: versionstage2.AWSPending.StringPtr(),
-	})
+func (h JWTRotator) provisionNewToken(ctx context.Context, version secretVersion, stage versionstage2.VersionStage) error {
+	storedToken, err := h.newToken(ctx, version)
+	if err != nil {
+		return err
+	}
+
+	return h.storeToken(ctx, version, storedToken, stage)
 }
 
-func (h JWTRotator) getCurrentSecret(ctx context.Context, secretID string) (StoredToken, error) {
-	return h.getSecretByStage(ctx, secretID, versionstage2.AwsCurrent)
+// newToken gets a new token for version from the token provider, or the
+// credential set, in turn.
+func (h JWTRotator) newToken(ctx context.Context, version secretVersion) (StoredToken, error) {
+	currentToken, err := h.getCurrentSecret(ctx, version.SecretID)
+	if err != nil && !errors.Is(err, ErrResourceNotFound) {
+		return StoredToken{}, fmt.Errorf("failed to get current secret: %w", err)
+	}
+
+	credentialSet, tokenProvider, err := h.tokenProvider(currentToken)
+	if err != nil {
+		return StoredToken{}, fmt.Errorf("failed to select credential set: %w", err)
+	}
+
+	rawToken, err := getNewToken(ctx, tokenProvider, currentToken)
+	if err != nil {
+		return StoredToken{}, err
+	}
+
+	if credentialSet != "" {
+		log.WithTracing(ctx).Infof("Provisioned versionID: %s of secret %s with credential set %s", version.ClientRequestToken, version.SecretID, credentialSet)
+	}
+
+	return StoredToken{RawToken: rawToken, CredentialSet: credentialSet}, nil
 }
 
-func (h JWTRotator) getSecretByStage(ctx context.Context, secretID string, stage versionstage2.VersionStage) (StoredToken, error) {
-	secretBinary, err := h.SecretsManager.GetSecretValueWithContext(ctx, &secretsmanager.GetSecretValueInput{
-		SecretId:     &secretID,
-		VersionStage: stage.StringPtr(),
-	})
+func (h JWTRotator) storeToken(ctx context.Context, version secretVersion, storedToken StoredToken, stage versionstage2.VersionStage) error {
+	secretBytes, err := json.Marshal(storedToken)
 	if err != nil {
-		return StoredToken{}, fmt.Errorf("failed to get secret value: %w", parseAWSError(err))
+		return fmt.Errorf("failed to marshal secretmodel: %w", err)
 	}
 
-	var storedToken StoredToken
-	if err = json.Unmarshal(secretBinary.SecretBinary, &storedToken); err != nil {
-		return StoredToken{}, fmt.Errorf("failed to unmarshal secret: %w", err)
+	if err = h.store().PutSecretValue(ctx, version.SecretID, version.ClientRequestToken, secretBytes, []versionstage2.VersionStage{stage}); err != nil {
+		return fmt.Errorf("failed to put secret value: %w", err)
 	}
 
-	return storedToken, nil
+	return nil
 }
 
-func (h JWTRotator) getSecret(ctx context.Context, input secretsmanager.GetSecretValueInput) (StoredToken, error) {
-	secretBinary, err := h.SecretsManager.GetSecretValueWithContext(ctx, &input)
+func (h JWTRotator) getCurrentSecret(ctx context.Context, secretID string) (StoredToken, error) {
+	return h.getSecret(ctx, secretID, "", versionstage2.AwsCurrent)
+}
+
+func (h JWTRotator) getSecret(ctx context.Context, secretID, versionID string, stage versionstage2.VersionStage) (StoredToken, error) {
+	secretValue, err := h.store().GetSecretValue(ctx, secretID, versionID, stage)
 	if err != nil {
-		return StoredToken{}, fmt.Errorf("failed to get secret value: %w", parseAWSError(err))
+		return StoredToken{}, fmt.Errorf("failed to get secret value: %w", err)
 	}
 
 	var storedToken StoredToken
-	if err = json.Unmarshal(secretBinary.SecretBinary, &storedToken); err != nil {
+	if err = json.Unmarshal(secretValue.Value, &storedToken); err != nil {
 		return StoredToken{}, fmt.Errorf("failed to unmarshal secret: %w", err)
 	}
 
 	return storedToken, nil
 }
+
+func (h JWTRotator) store() SecretStore {
+	if h.Store != nil {
+		return h.Store
+	}
+
+	return SecretsManagerStore{Client: h.SecretsManager}
+}
@@ -2,9 +2,11 @@ package jwtrotator_test
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/SKF/go-rest-utility/client/auth"
 	"github.com/aws/aws-sdk-go/aws"
@@ -13,209 +15,647 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/SKF/jwt-rotator/pkg/jwtrotator"
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator/filestore"
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator/secretsmanagerv2"
 	step2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/step"
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator/testutils/fakevault"
 	inmemorysecretsmanager2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/testutils/inmemorysecretsmanager"
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator/testutils/secretsmanagerserver"
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator/vaultstore"
 	versionstage2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/versionstage"
 )
 
 const (
-	secretToRotate = "secret/to/rotate"
+	secretToRotate    = "secret/to/rotate"
+	rotationLambdaARN = "arn:aws:lambda:eu-west-1:123456789012:function:jwt-rotator"
+)
+
+// Version IDs are ClientRequestTokens, which Secrets Manager requires to be at
+// least 32 characters long.
+const (
+	initialVersion = "00000000-0000-4000-8000-00000000000a"
+	version0       = "00000000-0000-4000-8000-000000000000"
+	version1       = "00000000-0000-4000-8000-000000000001"
+	version2       = "00000000-0000-4000-8000-000000000002"
 )
 
 func TestRotate_CreateSecret_Uninitialized(t *testing.T) {
-	// Given
-	secretsManager := inmemorysecretsmanager2.New()
-	jwtRotator := jwtrotator.JWTRotator{
-		SecretsManager: secretsManager,
-		TokenProvider:  &TokenProviderStub{},
-	}
+	forEachStore(t, func(t *testing.T, store jwtrotator.SecretStore) {
+		// Given
+		jwtRotator := jwtrotator.JWTRotator{
+			Store:         store,
+			TokenProvider: &TokenProviderStub{},
+		}
 
-	// When
-	err := jwtRotator.Rotate(context.Background(), jwtrotator.SecretManagerEvent{
-		Step:               step2.CreateSecret,
-		SecretID:           secretToRotate,
-		ClientRequestToken: "version-0",
+		// When
+		err := jwtRotator.Rotate(context.Background(), jwtrotator.SecretManagerEvent{
+			Step:               step2.CreateSecret,
+			SecretID:           secretToRotate,
+			ClientRequestToken: version0,
+		})
+
+		// Then
+		require.Error(t, err)
+		assert.ErrorIs(t, err, jwtrotator.ErrResourceNotFound)
 	})
+}
 
-	// Then
-	require.Error(t, err)
-	assert.ErrorIs(t, err, jwtrotator.ErrResourceNotFound)
+func TestRotate_CreateSecret_Bootstrap(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store jwtrotator.SecretStore) {
+		// Given
+		ctx := context.Background()
+		jwtRotator := jwtrotator.JWTRotator{
+			Store:         store,
+			TokenProvider: &TokenProviderStub{},
+			Bootstrap:     true,
+		}
+
+		// When
+		err := jwtRotator.Rotate(ctx, jwtrotator.SecretManagerEvent{
+			Step:               step2.CreateSecret,
+			SecretID:           secretToRotate,
+			ClientRequestToken: version0,
+		})
+
+		// Then
+		require.NoError(t, err)
+		currentToken := getCurrentToken(t, store)
+		assert.Equal(t, "token-0", string(currentToken.RawToken))
+
+		pendingToken := getPendingToken(t, store)
+		assert.Equal(t, "token-1", string(pendingToken.RawToken))
+	})
+}
+
+func TestInitializeSecret(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store jwtrotator.SecretStore) {
+		// Given
+		ctx := context.Background()
+		jwtRotator := jwtrotator.JWTRotator{
+			Store:         store,
+			TokenProvider: &TokenProviderStub{},
+		}
+
+		for i := 0; i < 2; i++ {
+			// When
+			initialized, err := jwtRotator.InitializeSecret(ctx, secretToRotate)
+
+			// Then
+			require.NoError(t, err)
+			assert.Equal(t, i == 0, initialized)
+
+			currentToken := getCurrentToken(t, store)
+			assert.Equal(t, "token-0", string(currentToken.RawToken))
+		}
+	})
+}
+
+func TestInitializeSecret_AlreadyInitialized(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store jwtrotator.SecretStore) {
+		// Given
+		ctx := context.Background()
+		initialToken := jwtrotator.StoredToken{
+			RawToken: "first-token",
+		}
+		initializeStore(t, store, initialToken)
+
+		jwtRotator := jwtrotator.JWTRotator{
+			Store:         store,
+			TokenProvider: &TokenProviderStub{},
+		}
+
+		// When
+		initialized, err := jwtRotator.InitializeSecret(ctx, secretToRotate)
+
+		// Then
+		require.NoError(t, err)
+		assert.False(t, initialized)
+		assert.Equal(t, initialToken, getCurrentToken(t, store))
+	})
 }
 
 func TestRotate_CreateSecret(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store jwtrotator.SecretStore) {
+		// Given
+		ctx := context.Background()
+		initialToken := jwtrotator.StoredToken{
+			RawToken: "first-token",
+		}
+		initializeStore(t, store, initialToken)
+
+		jwtRotator := jwtrotator.JWTRotator{
+			Store:         store,
+			TokenProvider: &TokenProviderStub{},
+		}
+
+		// When
+		err := jwtRotator.Rotate(ctx, jwtrotator.SecretManagerEvent{
+			Step:               step2.CreateSecret,
+			SecretID:           secretToRotate,
+			ClientRequestToken: version0,
+		})
+
+		// Then
+		require.NoError(t, err)
+		currentToken := getCurrentToken(t, store)
+		assert.Equal(t, initialToken, currentToken)
+
+		pendingToken := getPendingToken(t, store)
+		assert.Equal(t, "token-0", string(pendingToken.RawToken))
+	})
+}
+
+func TestRotate_CreateSecret_Twice(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store jwtrotator.SecretStore) {
+		// Given
+		ctx := context.Background()
+		initialToken := jwtrotator.StoredToken{
+			RawToken: "first-token",
+		}
+		initializeStore(t, store, initialToken)
+
+		jwtRotator := jwtrotator.JWTRotator{
+			Store:         store,
+			TokenProvider: &TokenProviderStub{},
+		}
+
+		for i := 0; i < 2; i++ {
+			// When
+			err := jwtRotator.Rotate(ctx, jwtrotator.SecretManagerEvent{
+				Step:               step2.CreateSecret,
+				SecretID:           secretToRotate,
+				ClientRequestToken: version0,
+			})
+
+			// Then
+			require.NoError(t, err)
+			currentToken := getCurrentToken(t, store)
+			assert.Equal(t, initialToken, currentToken)
+
+			pendingToken := getPendingToken(t, store)
+			assert.Equal(t, "token-0", string(pendingToken.RawToken))
+		}
+	})
+}
+
+func TestRotate_TestSecret(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store jwtrotator.SecretStore) {
+		// Given
+		ctx := context.Background()
+		initialToken := jwtrotator.StoredToken{
+			RawToken: "first-token",
+		}
+		initializeStore(t, store, initialToken)
+
+		jwtRotator := jwtrotator.JWTRotator{
+			Store:         store,
+			TokenProvider: &TokenProviderStub{},
+		}
+
+		// When
+		err := jwtRotator.Rotate(ctx, jwtrotator.SecretManagerEvent{
+			Step:               step2.CreateSecret,
+			SecretID:           secretToRotate,
+			ClientRequestToken: version0,
+		})
+		require.NoError(t, err)
+		err = jwtRotator.Rotate(ctx, jwtrotator.SecretManagerEvent{
+			Step:               step2.TestSecret,
+			SecretID:           secretToRotate,
+			ClientRequestToken: version0,
+		})
+
+		// Then
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid token")
+	})
+}
+
+func TestRotate_TestSecret_Testers(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store jwtrotator.SecretStore) {
+		// Given
+		ctx := context.Background()
+		initializeStore(t, store, jwtrotator.StoredToken{RawToken: "first-token"})
+
+		pendingToken := newJWT(t, time.Now().Add(time.Hour))
+		var testedToken auth.RawToken
+
+		jwtRotator := jwtrotator.JWTRotator{
+			Store:         store,
+			TokenProvider: pendingToken,
+			Testers: []jwtrotator.Tester{
+				jwtrotator.TesterFunc(func(_ context.Context, token auth.RawToken) error {
+					testedToken = token
+					return nil
+				}),
+				jwtrotator.TesterFunc(func(context.Context, auth.RawToken) error {
+					return fmt.Errorf("rejected by API")
+				}),
+			},
+		}
+
+		// When
+		err := jwtRotator.Rotate(ctx, jwtrotator.SecretManagerEvent{
+			Step:               step2.CreateSecret,
+			SecretID:           secretToRotate,
+			ClientRequestToken: version0,
+		})
+		require.NoError(t, err)
+		err = jwtRotator.Rotate(ctx, jwtrotator.SecretManagerEvent{
+			Step:               step2.TestSecret,
+			SecretID:           secretToRotate,
+			ClientRequestToken: version0,
+		})
+
+		// Then
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "rejected by API")
+		assert.Equal(t, pendingToken, testedToken)
+	})
+}
+
+func TestRotate_FinishSecret(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store jwtrotator.SecretStore) {
+		// Given
+		ctx := context.Background()
+		initialToken := jwtrotator.StoredToken{
+			RawToken: "first-token",
+		}
+		initializeStore(t, store, initialToken)
+
+		tokenProvider := &JWTProviderStub{t: t}
+		jwtRotator := jwtrotator.JWTRotator{
+			Store:         store,
+			TokenProvider: tokenProvider,
+		}
+
+		// When
+		err := jwtRotator.Rotate(ctx, jwtrotator.SecretManagerEvent{
+			Step:               step2.CreateSecret,
+			SecretID:           secretToRotate,
+			ClientRequestToken: version0,
+		})
+		require.NoError(t, err)
+		err = jwtRotator.Rotate(ctx, jwtrotator.SecretManagerEvent{
+			Step:               step2.TestSecret,
+			SecretID:           secretToRotate,
+			ClientRequestToken: version0,
+		})
+		require.NoError(t, err)
+		err = jwtRotator.Rotate(ctx, jwtrotator.SecretManagerEvent{
+			Step:               step2.FinishSecret,
+			SecretID:           secretToRotate,
+			ClientRequestToken: version0,
+		})
+
+		// Then
+		require.NoError(t, err)
+		currentToken := getCurrentToken(t, store)
+		assert.Equal(t, tokenProvider.issued[0], currentToken.RawToken)
+
+		metadata, err := store.DescribeSecret(ctx, secretToRotate)
+		require.NoError(t, err)
+		assert.Equal(t, []versionstage2.VersionStage{versionstage2.AwsCurrent}, metadata.Versions[version0])
+		// Promotions are only recorded when revocation is configured.
+		assert.NotContains(t, metadata.Tags, jwtrotator.TagPromotedVersion)
+
+		_, hasPending := metadata.VersionWithStage(versionstage2.AWSPending)
+		assert.False(t, hasPending)
+	})
+}
+
+func TestRotate_FinishSecret_NotPending(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store jwtrotator.SecretStore) {
+		// Given
+		ctx := context.Background()
+		initialToken := jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(time.Hour))}
+		initializeStore(t, store, initialToken)
+		putToken(t, store, version0, jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(time.Hour))}, versionstage2.AWSPending)
+		putToken(t, store, version1, jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(time.Hour))}, versionstage2.AWSPending)
+
+		jwtRotator := jwtrotator.JWTRotator{Store: store}
+
+		// When
+		err := rotateStep(ctx, jwtRotator, step2.FinishSecret, version0)
+
+		// Then
+		assert.ErrorIs(t, err, jwtrotator.ErrNotPending)
+		assert.Equal(t, initialToken, getCurrentToken(t, store))
+	})
+}
+
+func TestRotate_FinishSecret_NotTested(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store jwtrotator.SecretStore) {
+		// Given
+		ctx := context.Background()
+		initialToken := jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(time.Hour))}
+		initializeStore(t, store, initialToken)
+
+		jwtRotator := jwtrotator.JWTRotator{Store: store, TokenProvider: &JWTProviderStub{t: t}}
+		require.NoError(t, rotateStep(ctx, jwtRotator, step2.CreateSecret, version0))
+
+		// When
+		err := rotateStep(ctx, jwtRotator, step2.FinishSecret, version0)
+
+		// Then
+		assert.ErrorIs(t, err, jwtrotator.ErrNotTested)
+		assert.Equal(t, initialToken, getCurrentToken(t, store))
+	})
+}
+
+func TestRotate_FinishSecret_ExpiredPending(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store jwtrotator.SecretStore) {
+		// Given
+		ctx := context.Background()
+		initialToken := jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(time.Hour))}
+		initializeStore(t, store, initialToken)
+		putToken(t, store, version0, jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(-time.Minute))}, versionstage2.AWSPending, versionstage2.JWTTested)
+
+		jwtRotator := jwtrotator.JWTRotator{Store: store}
+
+		// When
+		err := rotateStep(ctx, jwtRotator, step2.FinishSecret, version0)
+
+		// Then
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "PENDING token already expired")
+		assert.Equal(t, initialToken, getCurrentToken(t, store))
+	})
+}
+
+func TestRotate_FinishSecret_Replayed(t *testing.T) {
 	// Given
 	ctx := context.Background()
 	secretsManager := inmemorysecretsmanager2.New()
-	initialToken := jwtrotator.StoredToken{
-		RawToken: "first-token",
-	}
-	initializeSecretsManager(t, secretsManager, initialToken)
-
-	jwtRotator := jwtrotator.JWTRotator{
-		SecretsManager: secretsManager,
-		TokenProvider:  &TokenProviderStub{},
-	}
+	store := jwtrotator.SecretsManagerStore{Client: secretsManager}
+	initializeStore(t, store, jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(time.Hour))})
+
+	tokenProvider := &JWTProviderStub{t: t}
+	jwtRotator := jwtrotator.JWTRotator{Store: store, TokenProvider: tokenProvider}
+	require.NoError(t, rotateStep(ctx, jwtRotator, step2.CreateSecret, version0))
+	require.NoError(t, rotateStep(ctx, jwtRotator, step2.TestSecret, version0))
+
+	// Promoting succeeds but removing the labels afterwards fails.
+	secretsManager.InjectFault(inmemorysecretsmanager2.Fault{
+		Operation: inmemorysecretsmanager2.OpUpdateSecretVersionStage,
+		Err:       inmemorysecretsmanager2.ErrInternalService,
+		After:     1,
+		Times:     1,
+	})
 
 	// When
-	err := jwtRotator.Rotate(ctx, jwtrotator.SecretManagerEvent{
-		Step:               step2.CreateSecret,
-		SecretID:           secretToRotate,
-		ClientRequestToken: "version-0",
-	})
+	firstErr := rotateStep(ctx, jwtRotator, step2.FinishSecret, version0)
+	secondErr := rotateStep(ctx, jwtRotator, step2.FinishSecret, version0)
 
 	// Then
+	require.Error(t, firstErr)
+	require.NoError(t, secondErr)
+	assert.Equal(t, tokenProvider.issued[0], getCurrentToken(t, store).RawToken)
+
+	metadata, err := store.DescribeSecret(ctx, secretToRotate)
 	require.NoError(t, err)
-	currentToken := getCurrentToken(t, secretsManager)
-	assert.Equal(t, initialToken, currentToken)
 
-	pendingToken := getPendingToken(t, secretsManager)
-	assert.Equal(t, "token-0", string(pendingToken.RawToken))
+	_, hasPending := metadata.VersionWithStage(versionstage2.AWSPending)
+	assert.False(t, hasPending)
 }
 
-func TestRotate_CreateSecret_Twice(t *testing.T) {
+func TestRotateNow(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store jwtrotator.SecretStore) {
+		// Given
+		ctx := context.Background()
+		tokenProvider := &JWTProviderStub{t: t}
+		initializeStore(t, store, jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(time.Hour))})
+
+		jwtRotator := jwtrotator.JWTRotator{
+			Store:         store,
+			TokenProvider: tokenProvider,
+		}
+
+		// When
+		versionID, err := jwtRotator.RotateNow(ctx, secretToRotate)
+
+		// Then
+		require.NoError(t, err)
+		assert.Equal(t, tokenProvider.issued[0], getCurrentToken(t, store).RawToken)
+
+		metadata, err := store.DescribeSecret(ctx, secretToRotate)
+		require.NoError(t, err)
+
+		currentVersion, _ := metadata.VersionWithStage(versionstage2.AwsCurrent)
+		assert.Equal(t, versionID, currentVersion)
+
+		previousVersion, _ := metadata.VersionWithStage(versionstage2.AWSPrevious)
+		assert.Equal(t, initialVersion, previousVersion)
+	})
+}
+
+func TestRotate_RotateSecret(t *testing.T) {
 	// Given
 	ctx := context.Background()
 	secretsManager := inmemorysecretsmanager2.New()
-	initialToken := jwtrotator.StoredToken{
-		RawToken: "first-token",
-	}
-	initializeSecretsManager(t, secretsManager, initialToken)
+	store := jwtrotator.SecretsManagerStore{Client: secretsManager}
+	tokenProvider := &JWTProviderStub{t: t}
+	initializeStore(t, store, jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(time.Hour))})
 
 	jwtRotator := jwtrotator.JWTRotator{
 		SecretsManager: secretsManager,
-		TokenProvider:  &TokenProviderStub{},
+		TokenProvider:  tokenProvider,
 	}
+	secretsManager.RegisterRotationFunction(rotationLambdaARN, jwtRotator.Rotate)
 
-	for i := 0; i < 2; i++ {
-		// When
-		err := jwtRotator.Rotate(ctx, jwtrotator.SecretManagerEvent{
-			Step:               step2.CreateSecret,
-			SecretID:           secretToRotate,
-			ClientRequestToken: "version-0",
-		})
+	// When
+	output, err := secretsManager.RotateSecretWithContext(ctx, &secretsmanager.RotateSecretInput{
+		SecretId:          aws.String(secretToRotate),
+		RotationLambdaARN: aws.String(rotationLambdaARN),
+	})
 
-		// Then
-		require.NoError(t, err)
-		currentToken := getCurrentToken(t, secretsManager)
-		assert.Equal(t, initialToken, currentToken)
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, tokenProvider.issued[0], getCurrentToken(t, store).RawToken)
 
-		pendingToken := getPendingToken(t, secretsManager)
-		assert.Equal(t, "token-0", string(pendingToken.RawToken))
-	}
+	description, err := secretsManager.DescribeSecretWithContext(ctx, &secretsmanager.DescribeSecretInput{SecretId: aws.String(secretToRotate)})
+	require.NoError(t, err)
+	assert.True(t, aws.BoolValue(description.RotationEnabled))
+	assert.NotNil(t, description.LastRotatedDate)
+	assert.Equal(t, []string{"AWSCURRENT"}, aws.StringValueSlice(description.VersionIdsToStages[*output.VersionId]))
+	assert.Equal(t, []string{"AWSPREVIOUS"}, aws.StringValueSlice(description.VersionIdsToStages[initialVersion]))
 }
 
-func TestRotate_TestSecret(t *testing.T) {
+func TestRotate_RotateSecret_FailedStep(t *testing.T) {
 	// Given
 	ctx := context.Background()
 	secretsManager := inmemorysecretsmanager2.New()
-	initialToken := jwtrotator.StoredToken{
-		RawToken: "first-token",
-	}
-	initializeSecretsManager(t, secretsManager, initialToken)
+	store := jwtrotator.SecretsManagerStore{Client: secretsManager}
+	initializeStore(t, store, jwtrotator.StoredToken{RawToken: newJWT(t, time.Now().Add(time.Hour))})
 
 	jwtRotator := jwtrotator.JWTRotator{
 		SecretsManager: secretsManager,
 		TokenProvider:  &TokenProviderStub{},
 	}
+	secretsManager.RegisterRotationFunction(rotationLambdaARN, jwtRotator.Rotate)
+
+	input := &secretsmanager.RotateSecretInput{
+		SecretId:          aws.String(secretToRotate),
+		RotationLambdaARN: aws.String(rotationLambdaARN),
+	}
 
 	// When
-	err := jwtRotator.Rotate(ctx, jwtrotator.SecretManagerEvent{
-		Step:               step2.CreateSecret,
-		SecretID:           secretToRotate,
-		ClientRequestToken: "version-0",
-	})
-	require.NoError(t, err)
-	err = jwtRotator.Rotate(ctx, jwtrotator.SecretManagerEvent{
-		Step:               step2.TestSecret,
-		SecretID:           secretToRotate,
-		ClientRequestToken: "version-0",
-	})
+	_, err := secretsManager.RotateSecretWithContext(ctx, input)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "step testSecret")
+
+	_, err = secretsManager.RotateSecretWithContext(ctx, input)
 
 	// Then
 	require.Error(t, err)
-	assert.Contains(t, err.Error(), "invalid token")
+	assert.Contains(t, err.Error(), "previous rotation isn't complete")
+	assert.Equal(t, "token-0", string(getPendingToken(t, store).RawToken))
+
+	description, err := secretsManager.DescribeSecretWithContext(ctx, &secretsmanager.DescribeSecretInput{SecretId: aws.String(secretToRotate)})
+	require.NoError(t, err)
+	assert.Nil(t, description.LastRotatedDate)
 }
 
-func TestRotate_FinishSecret(t *testing.T) {
+func TestRotate_CreateSecret_RetryAfterFault(t *testing.T) {
 	// Given
 	ctx := context.Background()
 	secretsManager := inmemorysecretsmanager2.New()
-	initialToken := jwtrotator.StoredToken{
-		RawToken: "first-token",
-	}
-	initializeSecretsManager(t, secretsManager, initialToken)
+	initializeStore(t, jwtrotator.SecretsManagerStore{Client: secretsManager}, jwtrotator.StoredToken{RawToken: "first-token"})
+	secretsManager.InjectFault(inmemorysecretsmanager2.Fault{
+		Operation: inmemorysecretsmanager2.OpPutSecretValue,
+		Err:       inmemorysecretsmanager2.ErrInternalService,
+		Times:     1,
+	})
+	secretsManager.ResetCalls()
 
 	jwtRotator := jwtrotator.JWTRotator{
 		SecretsManager: secretsManager,
 		TokenProvider:  &TokenProviderStub{},
 	}
-
-	// When
-	err := jwtRotator.Rotate(ctx, jwtrotator.SecretManagerEvent{
+	event := jwtrotator.SecretManagerEvent{
 		Step:               step2.CreateSecret,
 		SecretID:           secretToRotate,
-		ClientRequestToken: "version-0",
-	})
-	require.NoError(t, err)
-	err = jwtRotator.Rotate(ctx, jwtrotator.SecretManagerEvent{
-		Step:               step2.FinishSecret,
-		SecretID:           secretToRotate,
-		ClientRequestToken: "version-0",
-	})
+		ClientRequestToken: version0,
+	}
+
+	// When
+	firstErr := jwtRotator.Rotate(ctx, event)
+	secondErr := jwtRotator.Rotate(ctx, event)
+	thirdErr := jwtRotator.Rotate(ctx, event)
 
 	// Then
-	require.NoError(t, err)
-	currentToken := getCurrentToken(t, secretsManager)
-	assert.Equal(t, "token-0", string(currentToken.RawToken))
+	require.Error(t, firstErr)
+	assert.Contains(t, firstErr.Error(), "InternalServiceError")
+	require.NoError(t, secondErr)
+	require.NoError(t, thirdErr)
+	assert.Equal(t, 2, secretsManager.CallCount(inmemorysecretsmanager2.OpPutSecretValue, secretToRotate))
+	assert.Equal(t, "token-1", string(getPendingToken(t, jwtrotator.SecretsManagerStore{Client: secretsManager}).RawToken))
+}
 
-	pendingToken := getPendingToken(t, secretsManager)
-	assert.Equal(t, "token-0", string(pendingToken.RawToken))
+// storeFactories create an empty store for each SecretStore adapter the
+// rotation tests are run against.
+var storeFactories = map[string]func(t *testing.T) jwtrotator.SecretStore{
+	"SecretsManagerV1": func(*testing.T) jwtrotator.SecretStore {
+		return jwtrotator.SecretsManagerStore{Client: inmemorysecretsmanager2.New()}
+	},
+	"SecretsManagerV2": func(*testing.T) jwtrotator.SecretStore {
+		return jwtrotator.SecretsManagerStore{Client: secretsmanagerv2.Client{API: inmemorysecretsmanager2.New()}}
+	},
+	"SecretsManagerV1HTTP": func(t *testing.T) jwtrotator.SecretStore {
+		server := secretsmanagerserver.New(inmemorysecretsmanager2.New())
+		t.Cleanup(server.Close)
+
+		return jwtrotator.SecretsManagerStore{Client: server.V1Client()}
+	},
+	"SecretsManagerV2HTTP": func(t *testing.T) jwtrotator.SecretStore {
+		server := secretsmanagerserver.New(inmemorysecretsmanager2.New())
+		t.Cleanup(server.Close)
+
+		return jwtrotator.SecretsManagerStore{Client: secretsmanagerv2.Client{API: server.V2Client()}}
+	},
+	"File": func(t *testing.T) jwtrotator.SecretStore {
+		return filestore.Store{Dir: t.TempDir()}
+	},
+	"Vault": func(t *testing.T) jwtrotator.SecretStore {
+		server := fakevault.New()
+		t.Cleanup(server.Close)
+
+		return vaultstore.Store{Address: server.URL, Token: fakevault.Token}
+	},
 }
 
-func initializeSecretsManager(t *testing.T, manager *inmemorysecretsmanager2.InMemorySecretsManager, token jwtrotator.StoredToken) {
+func forEachStore(t *testing.T, test func(t *testing.T, store jwtrotator.SecretStore)) {
+	t.Helper()
+
+	for name, newStore := range storeFactories {
+		newStore := newStore
+
+		t.Run(name, func(t *testing.T) {
+			test(t, newStore(t))
+		})
+	}
+}
+
+func initializeStore(t *testing.T, store jwtrotator.SecretStore, token jwtrotator.StoredToken) {
+	t.Helper()
+
+	putToken(t, store, initialVersion, token, versionstage2.AwsCurrent)
+}
+
+func putToken(t *testing.T, store jwtrotator.SecretStore, versionID string, token jwtrotator.StoredToken, stages ...versionstage2.VersionStage) {
+	t.Helper()
+
 	bytes, err := json.Marshal(token)
 	require.NoError(t, err)
 
-	_, err = manager.PutSecretValueWithContext(context.Background(), &secretsmanager.PutSecretValueInput{
-		ClientRequestToken: aws.String("initial-version"),
-		SecretBinary:       bytes,
-		SecretId:           aws.String(secretToRotate),
-		VersionStages:      []*string{versionstage2.AwsCurrent.StringPtr()},
-	})
-
+	err = store.PutSecretValue(context.Background(), secretToRotate, versionID, bytes, stages)
 	require.NoError(t, err)
 }
 
-func getCurrentToken(t *testing.T, secretsManager *inmemorysecretsmanager2.InMemorySecretsManager) jwtrotator.StoredToken {
+func getCurrentToken(t *testing.T, store jwtrotator.SecretStore) jwtrotator.StoredToken {
 	t.Helper()
 
-	result, err := secretsManager.GetSecretValueWithContext(context.Background(), &secretsmanager.GetSecretValueInput{
-		SecretId:     aws.String(secretToRotate),
-		VersionStage: versionstage2.AwsCurrent.StringPtr(),
-	})
+	return getTokenByStage(t, store, versionstage2.AwsCurrent)
+}
+
+func getPendingToken(t *testing.T, store jwtrotator.SecretStore) jwtrotator.StoredToken {
+	t.Helper()
+
+	return getTokenByStage(t, store, versionstage2.AWSPending)
+}
+
+func getTokenByStage(t *testing.T, store jwtrotator.SecretStore, stage versionstage2.VersionStage) jwtrotator.StoredToken {
+	t.Helper()
+
+	result, err := store.GetSecretValue(context.Background(), secretToRotate, "", stage)
 	require.NoError(t, err)
 
 	var token jwtrotator.StoredToken
-	err = json.Unmarshal(result.SecretBinary, &token)
+	err = json.Unmarshal(result.Value, &token)
 	require.NoError(t, err)
 
 	return token
 }
 
-func getPendingToken(t *testing.T, secretsManager *inmemorysecretsmanager2.InMemorySecretsManager) jwtrotator.StoredToken {
+func newJWT(t *testing.T, expiresAt time.Time) auth.RawToken {
 	t.Helper()
 
-	result, err := secretsManager.GetSecretValueWithContext(context.Background(), &secretsmanager.GetSecretValueInput{
-		SecretId:     aws.String(secretToRotate),
-		VersionStage: versionstage2.AWSPending.StringPtr(),
-	})
+	return newJWTWithClaims(t, map[string]interface{}{"sub": "service-user", "exp": expiresAt.Unix()})
+}
+
+func newJWTWithClaims(t *testing.T, tokenClaims map[string]interface{}) auth.RawToken {
+	t.Helper()
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
 	require.NoError(t, err)
 
-	var token jwtrotator.StoredToken
-	err = json.Unmarshal(result.SecretBinary, &token)
+	claims, err := json.Marshal(tokenClaims)
 	require.NoError(t, err)
 
-	return token
+	return auth.RawToken(fmt.Sprintf("%s.%s.signature",
+		base64.RawURLEncoding.EncodeToString(header),
+		base64.RawURLEncoding.EncodeToString(claims),
+	))
 }
 
 type TokenProviderStub struct {
@@ -230,3 +670,22 @@ func (t *TokenProviderStub) GetRawToken(context.Context) (auth.RawToken, error)
 }
 
 var _ auth.TokenProvider = &TokenProviderStub{}
+
+// JWTProviderStub issues distinct JWTs valid for an hour.
+type JWTProviderStub struct {
+	t      *testing.T
+	name   string
+	issued []auth.RawToken
+}
+
+func (p *JWTProviderStub) GetRawToken(context.Context) (auth.RawToken, error) {
+	token := newJWTWithClaims(p.t, map[string]interface{}{
+		"jti": fmt.Sprintf("%stoken-%d", p.name, len(p.issued)),
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	p.issued = append(p.issued, token)
+
+	return token, nil
+}
+
+var _ auth.TokenProvider = &JWTProviderStub{}
@@ -0,0 +1,118 @@
+// Package scheduler triggers rotations on an interval, for secret stores which,
+// unlike AWS Secrets Manager, have no rotation schedule of their own.
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/SKF/go-utility/v2/log"
+)
+
+// Rotator rotates a secret immediately, it is implemented by
+// jwtrotator.JWTRotator.
+type Rotator interface {
+	RotateNow(ctx context.Context, secretID string) (string, error)
+}
+
+// Revoker revokes the outgoing token of a secret once it is due, it is
+// implemented by jwtrotator.JWTRotator.
+type Revoker interface {
+	RevokePrevious(ctx context.Context, secretID string) (string, error)
+}
+
+type Scheduler struct {
+	Rotator   Rotator
+	SecretIDs []string
+
+	// Revoker, when set, revokes the outgoing tokens of the secrets whose
+	// grace period has passed, on every tick after the rotations.
+	Revoker Revoker
+
+	// Interval between two rotations of the secrets, it must be shorter than
+	// the lifetime of the tokens.
+	Interval time.Duration
+}
+
+// RotateAll rotates every secret once. A failed rotation does not stop the
+// remaining secrets from being rotated, all failures are returned together.
+func (s Scheduler) RotateAll(ctx context.Context) error {
+	var failures []string
+
+	for _, secretID := range s.SecretIDs {
+		versionID, err := s.Rotator.RotateNow(ctx, secretID)
+		if err != nil {
+			log.WithTracing(ctx).WithError(err).Errorf("Failed to rotate secret %s", secretID)
+			failures = append(failures, fmt.Sprintf("%s: %s", secretID, err))
+
+			continue
+		}
+
+		log.WithTracing(ctx).Infof("Rotated secret %s to versionID: %s", secretID, versionID)
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("failed to rotate %d of %d secrets: %s", len(failures), len(s.SecretIDs), strings.Join(failures, "; "))
+	}
+
+	return nil
+}
+
+// RevokeAll revokes every outgoing token which is due. Like RotateAll a failed
+// revocation does not stop the remaining secrets, all failures are returned
+// together.
+func (s Scheduler) RevokeAll(ctx context.Context) error {
+	if s.Revoker == nil {
+		return fmt.Errorf("no revoker configured")
+	}
+
+	var failures []string
+
+	for _, secretID := range s.SecretIDs {
+		versionID, err := s.Revoker.RevokePrevious(ctx, secretID)
+		if err != nil {
+			log.WithTracing(ctx).WithError(err).Errorf("Failed to revoke the previous token of secret %s", secretID)
+			failures = append(failures, fmt.Sprintf("%s: %s", secretID, err))
+
+			continue
+		}
+
+		if versionID != "" {
+			log.WithTracing(ctx).Infof("Revoked versionID: %s of secret %s", versionID, secretID)
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("failed to revoke %d of %d secrets: %s", len(failures), len(s.SecretIDs), strings.Join(failures, "; "))
+	}
+
+	return nil
+}
+
+// Run rotates every secret straight away and then once every Interval, until
+// the context is done. Failed rotations are logged and retried on the next
+// tick, as are failed revocations when a Revoker is set.
+func (s Scheduler) Run(ctx context.Context) error {
+	if s.Interval <= 0 {
+		return fmt.Errorf("interval must be positive, got %s", s.Interval)
+	}
+
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		_ = s.RotateAll(ctx)
+
+		if s.Revoker != nil {
+			_ = s.RevokeAll(ctx)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package scheduler_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator/scheduler"
+)
+
+type rotatorStub struct {
+	m       sync.Mutex
+	rotated []string
+	failing map[string]bool
+}
+
+func (r *rotatorStub) RotateNow(_ context.Context, secretID string) (string, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	r.rotated = append(r.rotated, secretID)
+
+	if r.failing[secretID] {
+		return "", errors.New("provider unavailable")
+	}
+
+	return "new-version", nil
+}
+
+func (r *rotatorStub) count() int {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	return len(r.rotated)
+}
+
+func TestScheduler_RotateAll(t *testing.T) {
+	// Given
+	rotator := &rotatorStub{failing: map[string]bool{"secret-a": true}}
+	s := scheduler.Scheduler{
+		Rotator:   rotator,
+		SecretIDs: []string{"secret-a", "secret-b"},
+	}
+
+	// When
+	err := s.RotateAll(context.Background())
+
+	// Then
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to rotate 1 of 2 secrets: secret-a: provider unavailable")
+	assert.Equal(t, []string{"secret-a", "secret-b"}, rotator.rotated)
+}
+
+type revokerStub struct {
+	revoked []string
+	failing map[string]bool
+}
+
+func (r *revokerStub) RevokePrevious(_ context.Context, secretID string) (string, error) {
+	if r.failing[secretID] {
+		return "", errors.New("provider unavailable")
+	}
+
+	r.revoked = append(r.revoked, secretID)
+
+	return "previous-version", nil
+}
+
+func TestScheduler_RevokeAll(t *testing.T) {
+	// Given
+	revoker := &revokerStub{failing: map[string]bool{"secret-b": true}}
+	s := scheduler.Scheduler{
+		Revoker:   revoker,
+		SecretIDs: []string{"secret-a", "secret-b", "secret-c"},
+	}
+
+	// When
+	err := s.RevokeAll(context.Background())
+
+	// Then
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to revoke 1 of 3 secrets: secret-b: provider unavailable")
+	assert.Equal(t, []string{"secret-a", "secret-c"}, revoker.revoked)
+}
+
+func TestScheduler_Run(t *testing.T) {
+	// Given
+	rotator := &rotatorStub{}
+	s := scheduler.Scheduler{
+		Rotator:   rotator,
+		SecretIDs: []string{"secret-a"},
+		Interval:  time.Millisecond,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+
+	// When
+	go func() { done <- s.Run(ctx) }()
+
+	require.Eventually(t, func() bool { return rotator.count() >= 3 }, time.Second, time.Millisecond)
+	cancel()
+
+	// Then
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
@@ -1,7 +1,23 @@
 package jwtrotator
 
-import "github.com/SKF/go-rest-utility/client/auth"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/SKF/go-rest-utility/client/auth"
+)
 
 type StoredToken struct {
 	RawToken auth.RawToken `json:"token"`
+
+	// CredentialSet names the JWTRotator.CredentialSets entry which issued
+	// the token, it is empty for tokens of a single TokenProvider.
+	CredentialSet string `json:"credentialSet,omitempty"`
+}
+
+// Fingerprint identifies the stored token without revealing it, it is the
+// hex encoded SHA-256 sum of the raw token.
+func (t StoredToken) Fingerprint() string {
+	sum := sha256.Sum256([]byte(t.RawToken))
+	return hex.EncodeToString(sum[:])
 }
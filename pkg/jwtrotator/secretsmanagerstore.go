@@ -0,0 +1,142 @@
+package jwtrotator
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+
+	versionstage2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/versionstage"
+)
+
+// SecretsManagerTagger is implemented by the SecretsManagerClients which can
+// tag secrets, like the AWS SDK client, secretsmanagerv2.Client and the
+// in-memory secrets manager. SecretsManagerStore.TagSecret requires it.
+type SecretsManagerTagger interface {
+	TagResourceWithContext(ctx aws.Context, input *secretsmanager.TagResourceInput, opts ...request.Option) (*secretsmanager.TagResourceOutput, error)
+}
+
+// SecretsManagerStore is the SecretStore backed by AWS Secrets Manager.
+type SecretsManagerStore struct {
+	Client SecretsManagerClient
+}
+
+func (s SecretsManagerStore) GetSecretValue(ctx context.Context, secretID, versionID string, stage versionstage2.VersionStage) (SecretValue, error) {
+	input := &secretsmanager.GetSecretValueInput{
+		SecretId: &secretID,
+	}
+
+	if versionID != "" {
+		input.VersionId = &versionID
+	}
+
+	if stage != "" {
+		input.VersionStage = stage.StringPtr()
+	}
+
+	output, err := s.Client.GetSecretValueWithContext(ctx, input)
+	if err != nil {
+		return SecretValue{}, parseAWSError(err)
+	}
+
+	return SecretValue{
+		VersionID:   aws.StringValue(output.VersionId),
+		Stages:      stagesFromStrings(output.VersionStages),
+		Value:       output.SecretBinary,
+		CreatedDate: aws.TimeValue(output.CreatedDate),
+	}, nil
+}
+
+func (s SecretsManagerStore) PutSecretValue(ctx context.Context, secretID, versionID string, value []byte, stages []versionstage2.VersionStage) error {
+	versionStages := make([]*string, len(stages))
+	for i := range stages {
+		versionStages[i] = stages[i].StringPtr()
+	}
+
+	_, err := s.Client.PutSecretValueWithContext(ctx, &secretsmanager.PutSecretValueInput{
+		ClientRequestToken: &versionID,
+		SecretBinary:       value,
+		SecretId:           &secretID,
+		VersionStages:      versionStages,
+	})
+
+	return parseAWSError(err)
+}
+
+func (s SecretsManagerStore) MoveStage(ctx context.Context, secretID string, stage versionstage2.VersionStage, toVersionID, fromVersionID string) error {
+	input := &secretsmanager.UpdateSecretVersionStageInput{
+		SecretId:     &secretID,
+		VersionStage: stage.StringPtr(),
+	}
+
+	if toVersionID != "" {
+		input.MoveToVersionId = &toVersionID
+	}
+
+	if fromVersionID != "" {
+		input.RemoveFromVersionId = &fromVersionID
+	}
+
+	_, err := s.Client.UpdateSecretVersionStageWithContext(ctx, input)
+
+	return parseAWSError(err)
+}
+
+func (s SecretsManagerStore) DescribeSecret(ctx context.Context, secretID string) (SecretDescription, error) {
+	output, err := s.Client.DescribeSecretWithContext(ctx, &secretsmanager.DescribeSecretInput{
+		SecretId: &secretID,
+	})
+	if err != nil {
+		return SecretDescription{}, parseAWSError(err)
+	}
+
+	description := SecretDescription{
+		Versions: make(map[string][]versionstage2.VersionStage, len(output.VersionIdsToStages)),
+		Tags:     tagsToMap(output.Tags),
+	}
+
+	for versionID, stages := range output.VersionIdsToStages {
+		description.Versions[versionID] = stagesFromStrings(stages)
+	}
+
+	return description, nil
+}
+
+func (s SecretsManagerStore) TagSecret(ctx context.Context, secretID string, tags map[string]string) error {
+	tagger, ok := s.Client.(SecretsManagerTagger)
+	if !ok {
+		return fmt.Errorf("%w: %T does not implement TagResourceWithContext", ErrTaggingNotSupported, s.Client)
+	}
+
+	input := &secretsmanager.TagResourceInput{
+		SecretId: &secretID,
+		Tags:     make([]*secretsmanager.Tag, 0, len(tags)),
+	}
+
+	for key, value := range tags {
+		input.Tags = append(input.Tags, &secretsmanager.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+
+	_, err := tagger.TagResourceWithContext(ctx, input)
+
+	return parseAWSError(err)
+}
+
+func stagesFromStrings(stages []*string) []versionstage2.VersionStage {
+	result := make([]versionstage2.VersionStage, 0, len(stages))
+
+	for _, stage := range stages {
+		if stage != nil {
+			result = append(result, versionstage2.VersionStage(*stage))
+		}
+	}
+
+	return result
+}
+
+var (
+	_ SecretStore          = SecretsManagerStore{}
+	_ SecretsManagerTagger = &secretsmanager.SecretsManager{}
+)
@@ -0,0 +1,157 @@
+// Package secretsmanagerv2 adapts the AWS SDK for Go v2 Secrets Manager client
+// to the jwtrotator.SecretsManagerClient interface.
+package secretsmanagerv2
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	secretsmanagerv1 "github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/smithy-go"
+
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator"
+)
+
+// API is the part of the v2 Secrets Manager client used by the rotator, it is
+// implemented by *secretsmanager.Client.
+type API interface {
+	DescribeSecret(ctx context.Context, input *secretsmanager.DescribeSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.DescribeSecretOutput, error)
+	UpdateSecretVersionStage(ctx context.Context, input *secretsmanager.UpdateSecretVersionStageInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.UpdateSecretVersionStageOutput, error)
+	PutSecretValue(ctx context.Context, input *secretsmanager.PutSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.PutSecretValueOutput, error)
+	GetSecretValue(ctx context.Context, input *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+	TagResource(ctx context.Context, input *secretsmanager.TagResourceInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.TagResourceOutput, error)
+}
+
+var _ API = &secretsmanager.Client{}
+
+// Client lets a v2 Secrets Manager client be used as the SecretsManager of a
+// jwtrotator.JWTRotator. Errors returned by the v2 client are translated to
+// awserr.Error so the rotator can classify them as it does for v1.
+//
+// The v1 request options are not applicable to the v2 client and are ignored.
+type Client struct {
+	API API
+}
+
+func (c Client) DescribeSecretWithContext(ctx aws.Context, input *secretsmanagerv1.DescribeSecretInput, _ ...request.Option) (*secretsmanagerv1.DescribeSecretOutput, error) {
+	output, err := c.API.DescribeSecret(ctx, &secretsmanager.DescribeSecretInput{
+		SecretId: input.SecretId,
+	})
+	if err != nil {
+		return nil, toAWSError(err)
+	}
+
+	result := &secretsmanagerv1.DescribeSecretOutput{
+		ARN:                output.ARN,
+		CreatedDate:        output.CreatedDate,
+		LastChangedDate:    output.LastChangedDate,
+		LastRotatedDate:    output.LastRotatedDate,
+		Name:               output.Name,
+		RotationEnabled:    aws.Bool(output.RotationEnabled),
+		RotationLambdaARN:  output.RotationLambdaARN,
+		VersionIdsToStages: make(map[string][]*string, len(output.VersionIdsToStages)),
+	}
+
+	for versionID, stages := range output.VersionIdsToStages {
+		result.VersionIdsToStages[versionID] = aws.StringSlice(stages)
+	}
+
+	for _, tag := range output.Tags {
+		result.Tags = append(result.Tags, &secretsmanagerv1.Tag{Key: tag.Key, Value: tag.Value})
+	}
+
+	return result, nil
+}
+
+func (c Client) UpdateSecretVersionStageWithContext(ctx aws.Context, input *secretsmanagerv1.UpdateSecretVersionStageInput, _ ...request.Option) (*secretsmanagerv1.UpdateSecretVersionStageOutput, error) {
+	output, err := c.API.UpdateSecretVersionStage(ctx, &secretsmanager.UpdateSecretVersionStageInput{
+		SecretId:            input.SecretId,
+		VersionStage:        input.VersionStage,
+		MoveToVersionId:     input.MoveToVersionId,
+		RemoveFromVersionId: input.RemoveFromVersionId,
+	})
+	if err != nil {
+		return nil, toAWSError(err)
+	}
+
+	return &secretsmanagerv1.UpdateSecretVersionStageOutput{
+		ARN:  output.ARN,
+		Name: output.Name,
+	}, nil
+}
+
+func (c Client) PutSecretValueWithContext(ctx aws.Context, input *secretsmanagerv1.PutSecretValueInput, _ ...request.Option) (*secretsmanagerv1.PutSecretValueOutput, error) {
+	output, err := c.API.PutSecretValue(ctx, &secretsmanager.PutSecretValueInput{
+		SecretId:           input.SecretId,
+		ClientRequestToken: input.ClientRequestToken,
+		SecretBinary:       input.SecretBinary,
+		SecretString:       input.SecretString,
+		VersionStages:      aws.StringValueSlice(input.VersionStages),
+	})
+	if err != nil {
+		return nil, toAWSError(err)
+	}
+
+	return &secretsmanagerv1.PutSecretValueOutput{
+		ARN:           output.ARN,
+		Name:          output.Name,
+		VersionId:     output.VersionId,
+		VersionStages: aws.StringSlice(output.VersionStages),
+	}, nil
+}
+
+func (c Client) GetSecretValueWithContext(ctx aws.Context, input *secretsmanagerv1.GetSecretValueInput, _ ...request.Option) (*secretsmanagerv1.GetSecretValueOutput, error) {
+	output, err := c.API.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId:     input.SecretId,
+		VersionId:    input.VersionId,
+		VersionStage: input.VersionStage,
+	})
+	if err != nil {
+		return nil, toAWSError(err)
+	}
+
+	return &secretsmanagerv1.GetSecretValueOutput{
+		ARN:           output.ARN,
+		CreatedDate:   output.CreatedDate,
+		Name:          output.Name,
+		SecretBinary:  output.SecretBinary,
+		SecretString:  output.SecretString,
+		VersionId:     output.VersionId,
+		VersionStages: aws.StringSlice(output.VersionStages),
+	}, nil
+}
+
+func (c Client) TagResourceWithContext(ctx aws.Context, input *secretsmanagerv1.TagResourceInput, _ ...request.Option) (*secretsmanagerv1.TagResourceOutput, error) {
+	tags := make([]types.Tag, 0, len(input.Tags))
+	for _, tag := range input.Tags {
+		tags = append(tags, types.Tag{Key: tag.Key, Value: tag.Value})
+	}
+
+	if _, err := c.API.TagResource(ctx, &secretsmanager.TagResourceInput{
+		SecretId: input.SecretId,
+		Tags:     tags,
+	}); err != nil {
+		return nil, toAWSError(err)
+	}
+
+	return &secretsmanagerv1.TagResourceOutput{}, nil
+}
+
+func toAWSError(err error) error {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return awserr.New(apiErr.ErrorCode(), apiErr.ErrorMessage(), err)
+	}
+
+	return err
+}
+
+var (
+	_ jwtrotator.SecretsManagerClient = Client{}
+	_ jwtrotator.SecretsManagerTagger = Client{}
+)
@@ -0,0 +1,87 @@
+package secretsmanagerv2_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/SKF/go-rest-utility/client/auth"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator"
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator/secretsmanagerv2"
+	step2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/step"
+	inmemorysecretsmanager2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/testutils/inmemorysecretsmanager"
+	versionstage2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/versionstage"
+)
+
+const secretToRotate = "secret/to/rotate"
+
+// newToken is a JWT expiring in 2100, the finishSecret step only promotes
+// unexpired tokens.
+const newToken auth.RawToken = "eyJhbGciOiJSUzI1NiJ9.eyJleHAiOjQxMDI0NDQ4MDB9.signature"
+
+func TestClient_Rotate(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	inMemory := inmemorysecretsmanager2.New()
+
+	initialToken, err := json.Marshal(jwtrotator.StoredToken{RawToken: "first-token"})
+	require.NoError(t, err)
+
+	_, err = inMemory.PutSecretValue(ctx, &secretsmanager.PutSecretValueInput{
+		ClientRequestToken: aws.String("initial-version"),
+		SecretBinary:       initialToken,
+		SecretId:           aws.String(secretToRotate),
+		VersionStages:      []string{string(versionstage2.AwsCurrent)},
+	})
+	require.NoError(t, err)
+
+	jwtRotator := jwtrotator.JWTRotator{
+		SecretsManager: secretsmanagerv2.Client{API: inMemory},
+		TokenProvider:  newToken,
+	}
+
+	// When
+	for _, step := range []step2.Step{step2.CreateSecret, step2.TestSecret, step2.FinishSecret} {
+		err = jwtRotator.Rotate(ctx, jwtrotator.SecretManagerEvent{
+			Step:               step,
+			SecretID:           secretToRotate,
+			ClientRequestToken: "version-0",
+		})
+		require.NoError(t, err)
+	}
+
+	// Then
+	output, err := inMemory.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId:     aws.String(secretToRotate),
+		VersionStage: aws.String(string(versionstage2.AwsCurrent)),
+	})
+	require.NoError(t, err)
+
+	var current jwtrotator.StoredToken
+	require.NoError(t, json.Unmarshal(output.SecretBinary, &current))
+	assert.Equal(t, newToken, current.RawToken)
+	assert.Equal(t, "version-0", aws.StringValue(output.VersionId))
+}
+
+func TestClient_ResourceNotFound(t *testing.T) {
+	// Given
+	jwtRotator := jwtrotator.JWTRotator{
+		SecretsManager: secretsmanagerv2.Client{API: inmemorysecretsmanager2.New()},
+		TokenProvider:  auth.RawToken("new-token"),
+	}
+
+	// When
+	err := jwtRotator.Rotate(context.Background(), jwtrotator.SecretManagerEvent{
+		Step:               step2.CreateSecret,
+		SecretID:           secretToRotate,
+		ClientRequestToken: "version-0",
+	})
+
+	// Then
+	assert.ErrorIs(t, err, jwtrotator.ErrResourceNotFound)
+}
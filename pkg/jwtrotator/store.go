@@ -0,0 +1,68 @@
+package jwtrotator
+
+import (
+	"context"
+	"time"
+
+	versionstage2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/versionstage"
+)
+
+// SecretStore is the storage the rotation engine is written against. It
+// models a secret as a set of immutable versions, each identified by a
+// version ID and labelled with staging labels. A staging label is attached to
+// at most one version of a secret at a time.
+//
+// Implementations report missing secrets or versions with ErrResourceNotFound.
+type SecretStore interface {
+	// GetSecretValue returns the version of a secret matching versionID and
+	// stage, an empty versionID or stage matches any version.
+	GetSecretValue(ctx context.Context, secretID, versionID string, stage versionstage2.VersionStage) (SecretValue, error)
+
+	// PutSecretValue stores a new version of a secret labelled with stages,
+	// which are removed from any other version holding them. Putting the same
+	// value again is a no-op, putting a different value for an existing
+	// version fails with ErrResourceExists.
+	PutSecretValue(ctx context.Context, secretID, versionID string, value []byte, stages []versionstage2.VersionStage) error
+
+	// MoveStage moves stage from the version fromVersionID to the version
+	// toVersionID. Either may be empty to only attach or only remove the stage.
+	MoveStage(ctx context.Context, secretID string, stage versionstage2.VersionStage, toVersionID, fromVersionID string) error
+
+	// DescribeSecret returns the staging labels of every labelled version of a
+	// secret together with the tags of the secret.
+	DescribeSecret(ctx context.Context, secretID string) (SecretDescription, error)
+
+	// TagSecret adds tags to a secret, replacing the value of tags it already
+	// has. The rotator records the state RevokePrevious depends on in tags.
+	TagSecret(ctx context.Context, secretID string, tags map[string]string) error
+}
+
+// SecretValue is a single version of a secret.
+type SecretValue struct {
+	VersionID string
+	Stages    []versionstage2.VersionStage
+	Value     []byte
+
+	// CreatedDate is when the version was stored, it is the zero time if the
+	// store does not know.
+	CreatedDate time.Time
+}
+
+type SecretDescription struct {
+	// Versions maps the version ID of every labelled version to its stages.
+	Versions map[string][]versionstage2.VersionStage
+	Tags     map[string]string
+}
+
+// VersionWithStage returns the ID of the version holding stage.
+func (d SecretDescription) VersionWithStage(stage versionstage2.VersionStage) (string, bool) {
+	for versionID, stages := range d.Versions {
+		for _, s := range stages {
+			if s == stage {
+				return versionID, true
+			}
+		}
+	}
+
+	return "", false
+}
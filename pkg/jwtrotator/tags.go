@@ -0,0 +1,260 @@
+package jwtrotator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SKF/go-rest-utility/client/auth"
+	"github.com/SKF/go-utility/v2/log"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+)
+
+const (
+	tagPrefix = "jwt-rotator:"
+
+	TagProvider          = tagPrefix + "provider"
+	TagCredentialsSecret = tagPrefix + "credentials-secret"
+	TagAudience          = tagPrefix + "audience"
+	TagMinLifetime       = tagPrefix + "min-lifetime"
+)
+
+// The rotator records its own state in these tags, they are not configuration
+// and ParseTagConfig ignores them.
+const (
+	// TagPromotedVersion and TagPromotedAt record the last version promoted
+	// to AWSCURRENT and when, in RFC 3339 format.
+	TagPromotedVersion = tagPrefix + "promoted-version"
+	TagPromotedAt      = tagPrefix + "promoted-at"
+
+	// TagRevocationVersion, TagRevocationOutcome and TagRevocationAt record
+	// the last revocation attempted by RevokePrevious, the outcome is either
+	// RevocationRevoked or RevocationFailed.
+	TagRevocationVersion = tagPrefix + "revocation-version"
+	TagRevocationOutcome = tagPrefix + "revocation-outcome"
+	TagRevocationAt      = tagPrefix + "revocation-at"
+
+	// TagRollbackFrom, TagRollbackTo, TagRollbackReason and TagRollbackAt
+	// record the last Rollback, the version it demoted, the version it
+	// restored, why and when.
+	TagRollbackFrom   = tagPrefix + "rollback-from"
+	TagRollbackTo     = tagPrefix + "rollback-to"
+	TagRollbackReason = tagPrefix + "rollback-reason"
+	TagRollbackAt     = tagPrefix + "rollback-at"
+)
+
+// maxTagValueLength is the longest tag value Secrets Manager accepts.
+const maxTagValueLength = 256
+
+const (
+	RevocationRevoked = "revoked"
+	RevocationFailed  = "failed"
+)
+
+// ProviderSecretCredentials is the provider tag value selecting an
+// auth.SecretCredentialsTokenProvider.
+const ProviderSecretCredentials = "secret-credentials"
+
+var ErrInvalidTags = errors.New("invalid rotation tags")
+
+// TagConfig is the rotation configuration a secret describes with its tags.
+type TagConfig struct {
+	Provider          string
+	CredentialsSecret string
+	Audience          string
+	MinLifetime       time.Duration
+}
+
+// ParseTagConfig reads the rotation configuration from the tags of a secret.
+// Every invalid or unknown jwt-rotator tag is reported in the returned error.
+func ParseTagConfig(tags map[string]string) (TagConfig, error) {
+	var (
+		config   TagConfig
+		problems []string
+	)
+
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := strings.TrimSpace(tags[key])
+
+		switch key {
+		case TagProvider:
+			config.Provider = value
+		case TagCredentialsSecret:
+			config.CredentialsSecret = value
+		case TagAudience:
+			config.Audience = value
+		case TagMinLifetime:
+			if value == "" {
+				break
+			}
+
+			minLifetime, err := time.ParseDuration(value)
+			if err != nil || minLifetime < 0 {
+				problems = append(problems, fmt.Sprintf("%s: '%s' is not a valid duration", key, value))
+			}
+
+			config.MinLifetime = minLifetime
+		case TagPromotedVersion, TagPromotedAt, TagRevocationVersion, TagRevocationOutcome, TagRevocationAt,
+			TagRollbackFrom, TagRollbackTo, TagRollbackReason, TagRollbackAt:
+			continue
+		default:
+			if strings.HasPrefix(key, tagPrefix) {
+				problems = append(problems, fmt.Sprintf("%s: unknown tag", key))
+			}
+
+			continue
+		}
+
+		if value == "" {
+			problems = append(problems, fmt.Sprintf("%s: must not be empty", key))
+		}
+	}
+
+	if _, ok := tags[TagProvider]; !ok {
+		problems = append(problems, fmt.Sprintf("%s: missing", TagProvider))
+	}
+
+	if len(problems) > 0 {
+		return TagConfig{}, fmt.Errorf("%w: %s", ErrInvalidTags, strings.Join(problems, "; "))
+	}
+
+	return config, nil
+}
+
+// TagProviderFactory constructs the token provider selected by the provider tag.
+type TagProviderFactory func(ctx context.Context, config TagConfig) (auth.TokenProvider, error)
+
+// SecretCredentialsProvider builds an auth.SecretCredentialsTokenProvider
+// signing in with the credentials stored in the credentials-secret tag.
+func SecretCredentialsProvider(secretsClient auth.SecretsClient) TagProviderFactory {
+	return func(_ context.Context, config TagConfig) (auth.TokenProvider, error) {
+		if config.CredentialsSecret == "" {
+			return nil, fmt.Errorf("%w: %s: required by provider '%s'", ErrInvalidTags, TagCredentialsSecret, config.Provider)
+		}
+
+		return &auth.SecretCredentialsTokenProvider{
+			SecretID:      config.CredentialsSecret,
+			SecretsClient: secretsClient,
+		}, nil
+	}
+}
+
+// TaggedRotator rotates any secret which describes its own rotation with
+// jwt-rotator tags, building the token provider and testers from them.
+type TaggedRotator struct {
+	Store          SecretStore
+	SecretsManager SecretsManagerClient
+
+	// Providers maps the values accepted in the provider tag to the factory
+	// building that provider.
+	Providers map[string]TagProviderFactory
+
+	m         sync.Mutex
+	providers map[taggedProviderKey]auth.TokenProvider
+}
+
+type taggedProviderKey struct {
+	secretID          string
+	provider          string
+	credentialsSecret string
+}
+
+// Rotate handles a Secrets Manager rotation event, failing it if the secret
+// is not tagged correctly.
+func (r *TaggedRotator) Rotate(ctx context.Context, event SecretManagerEvent) error {
+	jwtRotator, err := r.Rotator(ctx, event.SecretID)
+	if err != nil {
+		log.WithTracing(ctx).WithError(err).Errorf("Refusing to rotate secret %s", event.SecretID)
+		return err
+	}
+
+	return jwtRotator.Rotate(ctx, event)
+}
+
+// Rotator returns the rotator configured by the tags of the given secret.
+func (r *TaggedRotator) Rotator(ctx context.Context, secretID string) (JWTRotator, error) {
+	jwtRotator := JWTRotator{
+		Store:          r.Store,
+		SecretsManager: r.SecretsManager,
+	}
+
+	metadata, err := jwtRotator.store().DescribeSecret(ctx, secretID)
+	if err != nil {
+		return JWTRotator{}, fmt.Errorf("failed to describe secret with id '%s': %w", secretID, err)
+	}
+
+	config, err := ParseTagConfig(metadata.Tags)
+	if err != nil {
+		return JWTRotator{}, fmt.Errorf("secret '%s': %w", secretID, err)
+	}
+
+	tokenProvider, err := r.tokenProvider(ctx, secretID, config)
+	if err != nil {
+		return JWTRotator{}, fmt.Errorf("secret '%s': %w", secretID, err)
+	}
+
+	jwtRotator.TokenProvider = tokenProvider
+	jwtRotator.MinLifetime = config.MinLifetime
+
+	if config.Audience != "" {
+		jwtRotator.Testers = append(jwtRotator.Testers, AudienceTester{Audience: config.Audience})
+	}
+
+	return jwtRotator, nil
+}
+
+func (r *TaggedRotator) tokenProvider(ctx context.Context, secretID string, config TagConfig) (auth.TokenProvider, error) {
+	factory, ok := r.Providers[config.Provider]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s: unknown provider '%s'", ErrInvalidTags, TagProvider, config.Provider)
+	}
+
+	key := taggedProviderKey{
+		secretID:          secretID,
+		provider:          config.Provider,
+		credentialsSecret: config.CredentialsSecret,
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if provider, ok := r.providers[key]; ok {
+		return provider, nil
+	}
+
+	provider, err := factory(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token provider: %w", err)
+	}
+
+	if r.providers == nil {
+		r.providers = make(map[taggedProviderKey]auth.TokenProvider)
+	}
+
+	r.providers[key] = provider
+
+	return provider, nil
+}
+
+func tagsToMap(tags []*secretsmanager.Tag) map[string]string {
+	result := make(map[string]string, len(tags))
+
+	for _, tag := range tags {
+		if tag != nil && tag.Key != nil && tag.Value != nil {
+			result[*tag.Key] = *tag.Value
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,141 @@
+package jwtrotator_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/SKF/go-rest-utility/client/auth"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator"
+	step2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/step"
+	inmemorysecretsmanager2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/testutils/inmemorysecretsmanager"
+)
+
+func TestParseTagConfig(t *testing.T) {
+	config, err := jwtrotator.ParseTagConfig(map[string]string{
+		jwtrotator.TagProvider:          jwtrotator.ProviderSecretCredentials,
+		jwtrotator.TagCredentialsSecret: "credentials/service-user",
+		jwtrotator.TagAudience:          "api",
+		jwtrotator.TagMinLifetime:       "1h",
+		jwtrotator.TagPromotedVersion:   version0,
+		jwtrotator.TagRevocationOutcome: jwtrotator.RevocationFailed,
+		"team":                          "platform",
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, jwtrotator.TagConfig{
+		Provider:          jwtrotator.ProviderSecretCredentials,
+		CredentialsSecret: "credentials/service-user",
+		Audience:          "api",
+		MinLifetime:       time.Hour,
+	}, config)
+}
+
+func TestParseTagConfig_Invalid(t *testing.T) {
+	_, err := jwtrotator.ParseTagConfig(map[string]string{
+		jwtrotator.TagAudience:    " ",
+		jwtrotator.TagMinLifetime: "one hour",
+		"jwt-rotator:audiance":    "api",
+	})
+
+	require.ErrorIs(t, err, jwtrotator.ErrInvalidTags)
+	assert.Contains(t, err.Error(), "jwt-rotator:audience: must not be empty")
+	assert.Contains(t, err.Error(), "jwt-rotator:min-lifetime: 'one hour' is not a valid duration")
+	assert.Contains(t, err.Error(), "jwt-rotator:audiance: unknown tag")
+	assert.Contains(t, err.Error(), "jwt-rotator:provider: missing")
+}
+
+func TestTaggedRotator_Rotate(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	secretsManager := inmemorysecretsmanager2.New()
+	initializeStore(t, jwtrotator.SecretsManagerStore{Client: secretsManager}, jwtrotator.StoredToken{RawToken: "first-token"})
+	tagSecret(t, secretsManager, map[string]string{
+		jwtrotator.TagProvider:    "stub",
+		jwtrotator.TagAudience:    "api",
+		jwtrotator.TagMinLifetime: "2h",
+	})
+
+	var configs []jwtrotator.TagConfig
+
+	rotator := jwtrotator.TaggedRotator{
+		SecretsManager: secretsManager,
+		Providers: map[string]jwtrotator.TagProviderFactory{
+			"stub": func(_ context.Context, config jwtrotator.TagConfig) (auth.TokenProvider, error) {
+				configs = append(configs, config)
+				return newJWTWithClaims(t, map[string]interface{}{"aud": []string{"api"}, "exp": time.Now().Add(time.Hour).Unix()}), nil
+			},
+		},
+	}
+
+	// When
+	err := rotator.Rotate(ctx, jwtrotator.SecretManagerEvent{
+		Step:               step2.CreateSecret,
+		SecretID:           secretToRotate,
+		ClientRequestToken: version0,
+	})
+	require.NoError(t, err)
+	err = rotator.Rotate(ctx, jwtrotator.SecretManagerEvent{
+		Step:               step2.TestSecret,
+		SecretID:           secretToRotate,
+		ClientRequestToken: version0,
+	})
+
+	// Then
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "minimum lifetime is 2h0m0s")
+	assert.Len(t, configs, 1, "provider should be cached between steps")
+}
+
+func TestTaggedRotator_Rotate_BadTags(t *testing.T) {
+	// Given
+	secretsManager := inmemorysecretsmanager2.New()
+	initializeStore(t, jwtrotator.SecretsManagerStore{Client: secretsManager}, jwtrotator.StoredToken{RawToken: "first-token"})
+	tagSecret(t, secretsManager, map[string]string{
+		jwtrotator.TagProvider: "unknown",
+	})
+
+	rotator := jwtrotator.TaggedRotator{
+		SecretsManager: secretsManager,
+		Providers: map[string]jwtrotator.TagProviderFactory{
+			jwtrotator.ProviderSecretCredentials: jwtrotator.SecretCredentialsProvider(nil),
+		},
+	}
+
+	// When
+	err := rotator.Rotate(context.Background(), jwtrotator.SecretManagerEvent{
+		Step:               step2.CreateSecret,
+		SecretID:           secretToRotate,
+		ClientRequestToken: version0,
+	})
+
+	// Then
+	require.ErrorIs(t, err, jwtrotator.ErrInvalidTags)
+	assert.Contains(t, err.Error(), "unknown provider 'unknown'")
+}
+
+func TestAudienceTester(t *testing.T) {
+	tester := jwtrotator.AudienceTester{Audience: "api"}
+
+	assert.NoError(t, tester.Test(context.Background(), newJWTWithClaims(t, map[string]interface{}{"aud": "api"})))
+	assert.NoError(t, tester.Test(context.Background(), newJWTWithClaims(t, map[string]interface{}{"aud": []string{"web", "api"}})))
+	assert.Error(t, tester.Test(context.Background(), newJWTWithClaims(t, map[string]interface{}{"aud": "web"})))
+	assert.Error(t, tester.Test(context.Background(), newJWTWithClaims(t, map[string]interface{}{})))
+}
+
+func tagSecret(t *testing.T, manager *inmemorysecretsmanager2.InMemorySecretsManager, tags map[string]string) {
+	t.Helper()
+
+	input := &secretsmanager.TagResourceInput{SecretId: aws.String(secretToRotate)}
+	for key, value := range tags {
+		input.Tags = append(input.Tags, &secretsmanager.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+
+	_, err := manager.TagResourceWithContext(context.Background(), input)
+	require.NoError(t, err)
+}
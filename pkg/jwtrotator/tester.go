@@ -0,0 +1,152 @@
+package jwtrotator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/SKF/go-rest-utility/client/auth"
+)
+
+// Tester validates a newly provisioned token during the testSecret step,
+// before it is promoted to AWSCURRENT.
+type Tester interface {
+	Test(ctx context.Context, token auth.RawToken) error
+}
+
+// TesterFunc adapts a function to the Tester interface.
+type TesterFunc func(ctx context.Context, token auth.RawToken) error
+
+func (f TesterFunc) Test(ctx context.Context, token auth.RawToken) error {
+	return f(ctx, token)
+}
+
+// AudienceTester checks that the token is issued for the given audience.
+type AudienceTester struct {
+	Audience string
+}
+
+func (t AudienceTester) Test(_ context.Context, token auth.RawToken) error {
+	decoded, err := DecodeToken(token)
+	if err != nil {
+		return err
+	}
+
+	switch aud := decoded.Claims["aud"].(type) {
+	case string:
+		if aud == t.Audience {
+			return nil
+		}
+	case []interface{}:
+		for _, a := range aud {
+			if a == t.Audience {
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("token is not issued for audience '%s'", t.Audience)
+}
+
+// HTTPProbeTester checks that the token is accepted by an API, by calling URL
+// with the token as a bearer token and expecting ExpectedStatus, which
+// defaults to 200 OK.
+type HTTPProbeTester struct {
+	URL            string
+	Method         string
+	ExpectedStatus int
+	Client         *http.Client
+}
+
+func (t HTTPProbeTester) Test(ctx context.Context, token auth.RawToken) error {
+	method, expectedStatus, client := t.Method, t.ExpectedStatus, t.Client
+
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	if expectedStatus == 0 {
+		expectedStatus = http.StatusOK
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, t.URL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create probe request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token.String())
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to probe %s: %w", t.URL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != expectedStatus {
+		return fmt.Errorf("probe %s %s responded with status %d, expected %d", method, t.URL, resp.StatusCode, expectedStatus)
+	}
+
+	return nil
+}
+
+// IntrospectionTester checks that the token is active according to an OAuth
+// 2.0 token introspection endpoint, RFC 7662. ClientID and ClientSecret, when
+// set, authenticate the request with HTTP basic authentication.
+type IntrospectionTester struct {
+	URL          string
+	ClientID     string
+	ClientSecret string
+	Client       *http.Client
+}
+
+func (t IntrospectionTester) Test(ctx context.Context, token auth.RawToken) error {
+	client := t.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	form := url.Values{"token": {token.String()}, "token_type_hint": {"access_token"}}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create introspection request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	if t.ClientID != "" {
+		req.SetBasicAuth(t.ClientID, t.ClientSecret)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to introspect token at %s: %w", t.URL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("introspection %s responded with status %d, expected %d", t.URL, resp.StatusCode, http.StatusOK)
+	}
+
+	var introspection struct {
+		Active bool `json:"active"`
+	}
+
+	if err = json.NewDecoder(resp.Body).Decode(&introspection); err != nil {
+		return fmt.Errorf("failed to decode introspection response: %w", err)
+	}
+
+	if !introspection.Active {
+		return fmt.Errorf("token is not active according to %s", t.URL)
+	}
+
+	return nil
+}
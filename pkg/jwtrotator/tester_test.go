@@ -0,0 +1,70 @@
+package jwtrotator_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator"
+)
+
+func TestHTTPProbeTester(t *testing.T) {
+	// Given
+	validToken := newJWT(t, time.Now().Add(time.Hour))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+validToken.String() {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	tester := jwtrotator.HTTPProbeTester{URL: server.URL}
+
+	// When
+	err := tester.Test(context.Background(), validToken)
+	require.NoError(t, err)
+
+	err = tester.Test(context.Background(), newJWT(t, time.Now().Add(time.Minute)))
+
+	// Then
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "responded with status 401, expected 200")
+}
+
+func TestIntrospectionTester(t *testing.T) {
+	// Given
+	activeToken := newJWT(t, time.Now().Add(time.Hour))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != "rotator" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		require.NoError(t, r.ParseForm())
+		_, _ = fmt.Fprintf(w, `{"active": %t}`, r.PostForm.Get("token") == activeToken.String())
+	}))
+	defer server.Close()
+
+	tester := jwtrotator.IntrospectionTester{URL: server.URL, ClientID: "rotator", ClientSecret: "secret"}
+
+	// When
+	err := tester.Test(context.Background(), activeToken)
+	require.NoError(t, err)
+
+	inactiveErr := tester.Test(context.Background(), newJWT(t, time.Now().Add(time.Minute)))
+	unauthorizedErr := jwtrotator.IntrospectionTester{URL: server.URL}.Test(context.Background(), activeToken)
+
+	// Then
+	require.Error(t, inactiveErr)
+	assert.Contains(t, inactiveErr.Error(), "token is not active")
+	require.Error(t, unauthorizedErr)
+	assert.Contains(t, unauthorizedErr.Error(), "responded with status 401")
+}
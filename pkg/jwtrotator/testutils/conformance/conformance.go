@@ -0,0 +1,292 @@
+// Package conformance checks that a jwtrotator.SecretsManagerClient behaves
+// like AWS Secrets Manager where the rotator depends on it. Run it against
+// every fake or custom backend to keep them from drifting from AWS:
+//
+//	func TestConformance(t *testing.T) {
+//		conformance.Run(t, func(t *testing.T) (jwtrotator.SecretsManagerClient, string) {
+//			client := newClient(t)
+//			return client, createSecret(t, client)
+//		})
+//	}
+package conformance
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator"
+)
+
+// unknownSecretID names a secret which is never created.
+const unknownSecretID = "conformance/unknown-secret"
+
+// Version IDs are ClientRequestTokens, which must be at least 32 characters.
+const (
+	version0 = "00000000-0000-4000-8000-000000000000"
+	version1 = "00000000-0000-4000-8000-000000000001"
+	version2 = "00000000-0000-4000-8000-000000000002"
+	unknown  = "00000000-0000-4000-8000-00000000ffff"
+)
+
+// Factory returns a client together with the ID of a secret it created for
+// the check, the secret must not have any versions yet.
+type Factory func(t *testing.T) (jwtrotator.SecretsManagerClient, string)
+
+type check struct {
+	name string
+	run  func(t *testing.T, c client)
+}
+
+var checks = []check{
+	{name: "GetSecretValue/UnknownSecret", run: testGetUnknownSecret},
+	{name: "GetSecretValue/WithoutVersions", run: testGetWithoutVersions},
+	{name: "GetSecretValue/ByIDAndStage", run: testGetByIDAndStage},
+	{name: "GetSecretValue/DefaultsToCurrent", run: testGetDefaultsToCurrent},
+	{name: "DescribeSecret/UnknownSecret", run: testDescribeUnknownSecret},
+	{name: "DescribeSecret/LabelledVersions", run: testDescribeLabelledVersions},
+	{name: "PutSecretValue/MovesStages", run: testPutMovesStages},
+	{name: "PutSecretValue/Idempotent", run: testPutIdempotent},
+	{name: "PutSecretValue/ConflictingValue", run: testPutConflictingValue},
+	{name: "UpdateSecretVersionStage/MoveCurrent", run: testMoveCurrent},
+	{name: "UpdateSecretVersionStage/RemoveStage", run: testRemoveStage},
+	{name: "UpdateSecretVersionStage/RequiresRemoveFromVersionID", run: testMoveRequiresRemoveFrom},
+	{name: "UpdateSecretVersionStage/CustomStage", run: testMoveCustomStage},
+}
+
+// Run checks the clients made by factory, each check gets a new client.
+func Run(t *testing.T, factory Factory) {
+	t.Helper()
+
+	for _, c := range checks {
+		c := c
+
+		t.Run(c.name, func(t *testing.T) {
+			secretsManager, secretID := factory(t)
+			c.run(t, client{t: t, SecretsManagerClient: secretsManager, secretID: secretID})
+		})
+	}
+}
+
+func testGetUnknownSecret(t *testing.T, c client) {
+	_, err := c.GetSecretValueWithContext(context.Background(), &secretsmanager.GetSecretValueInput{
+		SecretId:     aws.String(unknownSecretID),
+		VersionStage: aws.String("AWSCURRENT"),
+	})
+	assertErrorCode(t, err, secretsmanager.ErrCodeResourceNotFoundException)
+}
+
+func testGetWithoutVersions(t *testing.T, c client) {
+	_, err := c.get(nil, aws.String("AWSCURRENT"))
+	assertErrorCode(t, err, secretsmanager.ErrCodeResourceNotFoundException)
+	assert.Empty(t, c.stages())
+}
+
+func testGetByIDAndStage(t *testing.T, c client) {
+	c.put(version0, "first", "AWSCURRENT")
+	c.put(version1, "second", "AWSPENDING")
+
+	byID, err := c.get(aws.String(version1), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "second", string(byID.SecretBinary))
+	assert.Equal(t, []string{"AWSPENDING"}, aws.StringValueSlice(byID.VersionStages))
+
+	byStage, err := c.get(nil, aws.String("AWSCURRENT"))
+	require.NoError(t, err)
+	assert.Equal(t, version0, aws.StringValue(byStage.VersionId))
+	assert.Equal(t, "first", string(byStage.SecretBinary))
+
+	byBoth, err := c.get(aws.String(version1), aws.String("AWSPENDING"))
+	require.NoError(t, err)
+	assert.Equal(t, "second", string(byBoth.SecretBinary))
+
+	_, err = c.get(aws.String(version1), aws.String("AWSCURRENT"))
+	assertErrorCode(t, err, secretsmanager.ErrCodeResourceNotFoundException)
+
+	_, err = c.get(aws.String(unknown), nil)
+	assertErrorCode(t, err, secretsmanager.ErrCodeResourceNotFoundException)
+}
+
+func testGetDefaultsToCurrent(t *testing.T, c client) {
+	c.put(version0, "first", "AWSCURRENT")
+	c.put(version1, "second", "AWSPENDING")
+
+	output, err := c.get(nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, version0, aws.StringValue(output.VersionId))
+}
+
+func testDescribeUnknownSecret(t *testing.T, c client) {
+	_, err := c.DescribeSecretWithContext(context.Background(), &secretsmanager.DescribeSecretInput{SecretId: aws.String(unknownSecretID)})
+	assertErrorCode(t, err, secretsmanager.ErrCodeResourceNotFoundException)
+}
+
+func testDescribeLabelledVersions(t *testing.T, c client) {
+	c.put(version0, "first", "AWSCURRENT")
+	c.put(version1, "second", "AWSPENDING", "CUSTOM")
+
+	assert.Equal(t, map[string][]string{
+		version0: {"AWSCURRENT"},
+		version1: {"AWSPENDING", "CUSTOM"},
+	}, c.stages())
+}
+
+func testPutMovesStages(t *testing.T, c client) {
+	c.put(version0, "first", "AWSCURRENT")
+	c.put(version1, "second", "AWSPENDING")
+	c.put(version2, "third", "AWSPENDING")
+
+	stages := c.stages()
+	assert.Equal(t, []string{"AWSCURRENT"}, stages[version0])
+	assert.Equal(t, []string{"AWSPENDING"}, stages[version2])
+	assert.Empty(t, stages[version1])
+}
+
+func testPutIdempotent(t *testing.T, c client) {
+	c.put(version0, "first", "AWSCURRENT")
+	c.put(version1, "second", "AWSPENDING")
+	c.put(version1, "second", "AWSPENDING")
+
+	assert.Equal(t, map[string][]string{
+		version0: {"AWSCURRENT"},
+		version1: {"AWSPENDING"},
+	}, c.stages())
+}
+
+func testPutConflictingValue(t *testing.T, c client) {
+	c.put(version0, "first", "AWSCURRENT")
+
+	_, err := c.PutSecretValueWithContext(context.Background(), &secretsmanager.PutSecretValueInput{
+		SecretId:           aws.String(c.secretID),
+		ClientRequestToken: aws.String(version0),
+		SecretBinary:       []byte("other"),
+		VersionStages:      aws.StringSlice([]string{"AWSCURRENT"}),
+	})
+	assertErrorCode(t, err, secretsmanager.ErrCodeResourceExistsException)
+
+	output, err := c.get(aws.String(version0), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "first", string(output.SecretBinary))
+}
+
+func testMoveCurrent(t *testing.T, c client) {
+	c.put(version0, "first", "AWSCURRENT")
+	c.put(version1, "second", "AWSPENDING")
+
+	require.NoError(t, c.move("AWSCURRENT", aws.String(version1), aws.String(version0)))
+
+	assert.Equal(t, map[string][]string{
+		version0: {"AWSPREVIOUS"},
+		version1: {"AWSCURRENT", "AWSPENDING"},
+	}, c.stages())
+}
+
+func testRemoveStage(t *testing.T, c client) {
+	c.put(version0, "first", "AWSCURRENT")
+	c.put(version1, "second", "AWSPENDING")
+
+	require.NoError(t, c.move("AWSPENDING", nil, aws.String(version1)))
+
+	assert.Equal(t, map[string][]string{version0: {"AWSCURRENT"}}, c.stages())
+}
+
+func testMoveRequiresRemoveFrom(t *testing.T, c client) {
+	c.put(version0, "first", "AWSCURRENT")
+	c.put(version1, "second", "AWSPENDING")
+
+	err := c.move("AWSCURRENT", aws.String(version1), nil)
+	assertErrorCode(t, err, secretsmanager.ErrCodeInvalidParameterException)
+
+	assert.Equal(t, []string{"AWSCURRENT"}, c.stages()[version0])
+}
+
+func testMoveCustomStage(t *testing.T, c client) {
+	c.put(version0, "first", "AWSCURRENT")
+	c.put(version1, "second", "AWSPENDING")
+
+	require.NoError(t, c.move("JWTCANARY", aws.String(version1), nil))
+	assert.Equal(t, map[string][]string{
+		version0: {"AWSCURRENT"},
+		version1: {"AWSPENDING", "JWTCANARY"},
+	}, c.stages())
+
+	require.NoError(t, c.move("JWTCANARY", aws.String(version0), aws.String(version1)))
+	assert.Equal(t, map[string][]string{
+		version0: {"AWSCURRENT", "JWTCANARY"},
+		version1: {"AWSPENDING"},
+	}, c.stages())
+}
+
+type client struct {
+	jwtrotator.SecretsManagerClient
+	t        *testing.T
+	secretID string
+}
+
+func (c client) put(versionID, value string, stages ...string) {
+	c.t.Helper()
+
+	_, err := c.PutSecretValueWithContext(context.Background(), &secretsmanager.PutSecretValueInput{
+		SecretId:           aws.String(c.secretID),
+		ClientRequestToken: aws.String(versionID),
+		SecretBinary:       []byte(value),
+		VersionStages:      aws.StringSlice(stages),
+	})
+	require.NoError(c.t, err)
+}
+
+func (c client) get(versionID, stage *string) (*secretsmanager.GetSecretValueOutput, error) {
+	return c.GetSecretValueWithContext(context.Background(), &secretsmanager.GetSecretValueInput{
+		SecretId:     aws.String(c.secretID),
+		VersionId:    versionID,
+		VersionStage: stage,
+	})
+}
+
+func (c client) move(stage string, toVersionID, fromVersionID *string) error {
+	_, err := c.UpdateSecretVersionStageWithContext(context.Background(), &secretsmanager.UpdateSecretVersionStageInput{
+		SecretId:            aws.String(c.secretID),
+		VersionStage:        aws.String(stage),
+		MoveToVersionId:     toVersionID,
+		RemoveFromVersionId: fromVersionID,
+	})
+
+	return err
+}
+
+// stages returns the sorted stages of every labelled version.
+func (c client) stages() map[string][]string {
+	c.t.Helper()
+
+	output, err := c.DescribeSecretWithContext(context.Background(), &secretsmanager.DescribeSecretInput{SecretId: aws.String(c.secretID)})
+	require.NoError(c.t, err)
+
+	result := make(map[string][]string, len(output.VersionIdsToStages))
+
+	for versionID, stages := range output.VersionIdsToStages {
+		if len(stages) == 0 {
+			continue
+		}
+
+		result[versionID] = aws.StringValueSlice(stages)
+		sort.Strings(result[versionID])
+	}
+
+	return result
+}
+
+func assertErrorCode(t *testing.T, err error, code string) {
+	t.Helper()
+
+	var aerr awserr.Error
+	if assert.True(t, errors.As(err, &aerr), "expected an awserr.Error with code %s, got %v", code, err) {
+		assert.Equal(t, code, aerr.Code())
+	}
+}
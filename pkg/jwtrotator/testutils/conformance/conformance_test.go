@@ -0,0 +1,60 @@
+package conformance_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator"
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator/secretsmanagerv2"
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator/testutils/conformance"
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator/testutils/inmemorysecretsmanager"
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator/testutils/secretsmanagerserver"
+)
+
+const secretID = "conformance/secret"
+
+func TestInMemory(t *testing.T) {
+	conformance.Run(t, func(t *testing.T) (jwtrotator.SecretsManagerClient, string) {
+		return newManager(t), secretID
+	})
+}
+
+func TestInMemoryV2(t *testing.T) {
+	conformance.Run(t, func(t *testing.T) (jwtrotator.SecretsManagerClient, string) {
+		return secretsmanagerv2.Client{API: newManager(t)}, secretID
+	})
+}
+
+func TestServerV1(t *testing.T) {
+	conformance.Run(t, func(t *testing.T) (jwtrotator.SecretsManagerClient, string) {
+		server := secretsmanagerserver.New(newManager(t))
+		t.Cleanup(server.Close)
+
+		return server.V1Client(), secretID
+	})
+}
+
+func TestServerV2(t *testing.T) {
+	conformance.Run(t, func(t *testing.T) (jwtrotator.SecretsManagerClient, string) {
+		server := secretsmanagerserver.New(newManager(t))
+		t.Cleanup(server.Close)
+
+		return secretsmanagerv2.Client{API: server.V2Client()}, secretID
+	})
+}
+
+// newManager returns an emulator holding a secret without versions.
+func newManager(t *testing.T) *inmemorysecretsmanager.InMemorySecretsManager {
+	t.Helper()
+
+	manager := inmemorysecretsmanager.New()
+
+	_, err := manager.CreateSecretWithContext(context.Background(), &secretsmanager.CreateSecretInput{Name: aws.String(secretID)})
+	require.NoError(t, err)
+
+	return manager
+}
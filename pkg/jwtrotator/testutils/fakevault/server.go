@@ -0,0 +1,214 @@
+// Package fakevault is an in-memory stand-in for the HTTP API of a Vault KV
+// version 2 secrets engine, covering what vaultstore uses.
+package fakevault
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const Token = "fake-vault-token"
+
+type version struct {
+	data        map[string]interface{}
+	createdTime time.Time
+}
+
+type secret struct {
+	versions       []version
+	customMetadata map[string]string
+}
+
+type Server struct {
+	*httptest.Server
+
+	// Mount is the path the fake engine is mounted at.
+	Mount string
+
+	// FailedMetadataWrites is the number of metadata writes still to fail
+	// with an internal error, e.g. to interrupt a write halfway.
+	FailedMetadataWrites int
+
+	m       sync.Mutex
+	secrets map[string]*secret
+}
+
+// New starts a fake Vault mounting a KV version 2 engine at "secret",
+// requests must authenticate with Token. Close the server when done.
+func New() *Server {
+	s := &Server{
+		Mount:   "secret",
+		secrets: make(map[string]*secret),
+	}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+
+	return s
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Vault-Token") != Token {
+		writeErrors(w, http.StatusForbidden, "permission denied")
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/v1/"+s.Mount+"/")
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	switch {
+	case strings.HasPrefix(path, "data/") && r.Method == http.MethodGet:
+		s.readData(w, r, strings.TrimPrefix(path, "data/"))
+	case strings.HasPrefix(path, "data/") && (r.Method == http.MethodPost || r.Method == http.MethodPut):
+		s.writeData(w, r, strings.TrimPrefix(path, "data/"))
+	case strings.HasPrefix(path, "metadata/") && r.Method == http.MethodGet:
+		s.readMetadata(w, strings.TrimPrefix(path, "metadata/"))
+	case strings.HasPrefix(path, "metadata/") && (r.Method == http.MethodPost || r.Method == http.MethodPut) && s.FailedMetadataWrites > 0:
+		s.FailedMetadataWrites--
+		writeErrors(w, http.StatusInternalServerError, "internal error")
+	case strings.HasPrefix(path, "metadata/") && (r.Method == http.MethodPost || r.Method == http.MethodPut):
+		s.writeMetadata(w, r, strings.TrimPrefix(path, "metadata/"))
+	default:
+		writeErrors(w, http.StatusNotFound)
+	}
+}
+
+func (s *Server) readData(w http.ResponseWriter, r *http.Request, path string) {
+	secret, ok := s.secrets[path]
+	if !ok || len(secret.versions) == 0 {
+		writeErrors(w, http.StatusNotFound)
+		return
+	}
+
+	number := len(secret.versions)
+
+	if query := r.URL.Query().Get("version"); query != "" && query != "0" {
+		n, err := strconv.Atoi(query)
+		if err != nil {
+			writeErrors(w, http.StatusBadRequest, "invalid version")
+			return
+		}
+
+		if n < 1 || n > len(secret.versions) {
+			writeErrors(w, http.StatusNotFound)
+			return
+		}
+
+		number = n
+	}
+
+	v := secret.versions[number-1]
+
+	writeJSON(w, map[string]interface{}{
+		"data": map[string]interface{}{
+			"data": v.data,
+			"metadata": map[string]interface{}{
+				"created_time":    v.createdTime,
+				"custom_metadata": secret.customMetadata,
+				"deletion_time":   "",
+				"destroyed":       false,
+				"version":         number,
+			},
+		},
+	})
+}
+
+func (s *Server) writeData(w http.ResponseWriter, r *http.Request, path string) {
+	var body struct {
+		Options struct {
+			CAS *int `json:"cas"`
+		} `json:"options"`
+		Data map[string]interface{} `json:"data"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeErrors(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	secret := s.secret(path)
+
+	if body.Options.CAS != nil && *body.Options.CAS != len(secret.versions) {
+		writeErrors(w, http.StatusBadRequest, "check-and-set parameter did not match the current version")
+		return
+	}
+
+	created := time.Now().UTC()
+	secret.versions = append(secret.versions, version{data: body.Data, createdTime: created})
+
+	writeJSON(w, map[string]interface{}{
+		"data": map[string]interface{}{
+			"created_time": created,
+			"version":      len(secret.versions),
+		},
+	})
+}
+
+func (s *Server) readMetadata(w http.ResponseWriter, path string) {
+	secret, ok := s.secrets[path]
+	if !ok {
+		writeErrors(w, http.StatusNotFound)
+		return
+	}
+
+	versions := make(map[string]interface{}, len(secret.versions))
+	for i, v := range secret.versions {
+		versions[strconv.Itoa(i+1)] = map[string]interface{}{
+			"created_time":  v.createdTime,
+			"deletion_time": "",
+			"destroyed":     false,
+		}
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"data": map[string]interface{}{
+			"current_version": len(secret.versions),
+			"custom_metadata": secret.customMetadata,
+			"versions":        versions,
+		},
+	})
+}
+
+func (s *Server) writeMetadata(w http.ResponseWriter, r *http.Request, path string) {
+	var body struct {
+		CustomMetadata map[string]string `json:"custom_metadata"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeErrors(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.secret(path).customMetadata = body.CustomMetadata
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) secret(path string) *secret {
+	if _, ok := s.secrets[path]; !ok {
+		s.secrets[path] = &secret{}
+	}
+
+	return s.secrets[path]
+}
+
+func writeJSON(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeErrors(w http.ResponseWriter, status int, errs ...string) {
+	if errs == nil {
+		errs = []string{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"errors": errs})
+}
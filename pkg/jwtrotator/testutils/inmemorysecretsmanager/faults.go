@@ -0,0 +1,223 @@
+package inmemorysecretsmanager
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+)
+
+type Operation string
+
+const (
+	OpCreateSecret             Operation = "CreateSecret"
+	OpDescribeSecret           Operation = "DescribeSecret"
+	OpGetSecretValue           Operation = "GetSecretValue"
+	OpPutSecretValue           Operation = "PutSecretValue"
+	OpUpdateSecretVersionStage Operation = "UpdateSecretVersionStage"
+	OpTagResource              Operation = "TagResource"
+	OpRotateSecret             Operation = "RotateSecret"
+)
+
+// Errors to inject with a Fault, they are the errors the AWS SDK returns.
+var (
+	ErrThrottling       = awserr.New("ThrottlingException", "Rate exceeded", nil)
+	ErrInternalService  = &secretsmanager.InternalServiceError{Message_: aws.String("An error occurred on the server side.")}
+	ErrResourceNotFound = &secretsmanager.ResourceNotFoundException{Message_: aws.String("Secrets Manager can't find the specified secret.")}
+)
+
+// Fault makes matching calls fail. Faults are matched in the order they were
+// injected, the first one that fires decides the outcome of a call.
+type Fault struct {
+	// Operation and SecretID select the calls the fault applies to, empty
+	// values match every operation or secret.
+	Operation Operation
+	SecretID  string
+
+	// Err is returned by the failing calls.
+	Err error
+
+	// Timeout makes the failing calls block until their context is done, as
+	// a request that never gets a response. Err is ignored.
+	Timeout bool
+
+	// After is the number of matching calls let through before the fault
+	// fires, Times the number of calls it fires for, 0 meaning forever.
+	After int
+	Times int
+
+	// Probability of the fault firing for a matching call, 0 means it always
+	// fires. Seed the random source with SetSeed for reproducible tests.
+	Probability float64
+
+	matched int
+	fired   int
+}
+
+// Call is a call made to the in-memory secrets manager, Err is the error
+// returned by it because of an injected fault or a done context.
+type Call struct {
+	Operation Operation
+	SecretID  string
+	Err       error
+}
+
+// InjectFault adds a fault, see Fault for how it is matched.
+func (s *InMemorySecretsManager) InjectFault(fault Fault) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.faults = append(s.faults, &fault)
+}
+
+// ClearFaults removes every injected fault and latency.
+func (s *InMemorySecretsManager) ClearFaults() {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.faults = nil
+	s.latency = nil
+}
+
+// SetLatency delays every call to operation, or to every operation if it is
+// empty. A call whose context is done while it is delayed fails like a
+// canceled request.
+func (s *InMemorySecretsManager) SetLatency(operation Operation, latency time.Duration) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.latency == nil {
+		s.latency = make(map[Operation]time.Duration)
+	}
+
+	s.latency[operation] = latency
+}
+
+// SetSeed seeds the random source deciding whether probabilistic faults fire.
+func (s *InMemorySecretsManager) SetSeed(seed int64) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.rand = rand.New(rand.NewSource(seed)) //nolint:gosec
+}
+
+// Calls returns every call made so far, in order.
+func (s *InMemorySecretsManager) Calls() []Call {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	calls := make([]Call, 0, len(s.calls))
+	for _, call := range s.calls {
+		calls = append(calls, *call)
+	}
+
+	return calls
+}
+
+// CallCount returns how many calls were made to operation for secretID, an
+// empty secretID counts the calls for every secret.
+func (s *InMemorySecretsManager) CallCount(operation Operation, secretID string) int {
+	count := 0
+
+	for _, call := range s.Calls() {
+		if call.Operation == operation && (secretID == "" || call.SecretID == secretID) {
+			count++
+		}
+	}
+
+	return count
+}
+
+// ResetCalls clears the call log.
+func (s *InMemorySecretsManager) ResetCalls() {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.calls = nil
+}
+
+// before logs a call and applies the latency and faults configured for it,
+// it must be called without holding the lock.
+func (s *InMemorySecretsManager) before(ctx context.Context, operation Operation, secretID *string) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	s.m.Lock()
+
+	call := &Call{Operation: operation, SecretID: aws.StringValue(secretID)}
+	fault := s.matchFault(*call)
+
+	s.calls = append(s.calls, call)
+
+	latency, ok := s.latency[operation]
+	if !ok {
+		latency = s.latency[""]
+	}
+
+	s.m.Unlock()
+
+	if ctx.Err() == nil && fault != nil && fault.Timeout {
+		<-ctx.Done()
+	} else if ctx.Err() == nil && latency > 0 {
+		timer := time.NewTimer(latency)
+		defer timer.Stop()
+
+		select {
+		case <-ctx.Done():
+		case <-timer.C:
+		}
+	}
+
+	var err error
+
+	if ctx.Err() != nil {
+		err = awserr.New(request.CanceledErrorCode, "request context canceled", ctx.Err())
+	} else if fault != nil && !fault.Timeout {
+		err = fault.Err
+	}
+
+	// The call is logged before waiting so concurrent calls keep their order,
+	// its outcome is only known now.
+	s.m.Lock()
+	call.Err = err
+	s.m.Unlock()
+
+	return err
+}
+
+// matchFault returns the fault firing for call, it must be called with the
+// lock held.
+func (s *InMemorySecretsManager) matchFault(call Call) *Fault {
+	for _, fault := range s.faults {
+		if (fault.Operation != "" && fault.Operation != call.Operation) || (fault.SecretID != "" && fault.SecretID != call.SecretID) {
+			continue
+		}
+
+		fault.matched++
+
+		if fault.matched <= fault.After || (fault.Times > 0 && fault.fired >= fault.Times) {
+			continue
+		}
+
+		if fault.Probability > 0 {
+			if s.rand == nil {
+				s.rand = rand.New(rand.NewSource(time.Now().UnixNano())) //nolint:gosec
+			}
+
+			if s.rand.Float64() >= fault.Probability {
+				continue
+			}
+		}
+
+		fault.fired++
+
+		return fault
+	}
+
+	return nil
+}
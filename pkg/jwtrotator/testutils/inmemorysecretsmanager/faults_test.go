@@ -0,0 +1,151 @@
+package inmemorysecretsmanager_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator/testutils/inmemorysecretsmanager"
+)
+
+func getCurrent(ctx context.Context, manager *inmemorysecretsmanager.InMemorySecretsManager, secretID string) error {
+	_, err := manager.GetSecretValueWithContext(ctx, &secretsmanager.GetSecretValueInput{SecretId: aws.String(secretID)})
+	return err
+}
+
+func TestFault_Scripted(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	manager := inmemorysecretsmanager.New()
+	put(t, manager, "version-0", "first")
+	_, err := manager.PutSecretValueWithContext(ctx, &secretsmanager.PutSecretValueInput{
+		SecretId:           aws.String("other/secret"),
+		ClientRequestToken: aws.String("version-0"),
+		SecretBinary:       []byte("first"),
+	})
+	require.NoError(t, err)
+
+	manager.InjectFault(inmemorysecretsmanager.Fault{
+		Operation: inmemorysecretsmanager.OpGetSecretValue,
+		SecretID:  secretID,
+		Err:       inmemorysecretsmanager.ErrThrottling,
+		After:     1,
+		Times:     2,
+	})
+
+	// When
+	var results []error
+	for i := 0; i < 4; i++ {
+		results = append(results, getCurrent(ctx, manager, secretID))
+	}
+
+	// Then
+	assert.NoError(t, results[0])
+	assertErrorCode(t, results[1], "ThrottlingException")
+	assertErrorCode(t, results[2], "ThrottlingException")
+	assert.NoError(t, results[3])
+	assert.NoError(t, getCurrent(ctx, manager, "other/secret"))
+	assert.Equal(t, 4, manager.CallCount(inmemorysecretsmanager.OpGetSecretValue, secretID))
+	assert.Equal(t, 1, manager.CallCount(inmemorysecretsmanager.OpGetSecretValue, "other/secret"))
+}
+
+func TestFault_Probabilistic(t *testing.T) {
+	failures := func(seed int64) []bool {
+		manager := inmemorysecretsmanager.New()
+		put(t, manager, "version-0", "first")
+		manager.SetSeed(seed)
+		manager.InjectFault(inmemorysecretsmanager.Fault{
+			Err:         inmemorysecretsmanager.ErrInternalService,
+			Probability: 0.5,
+		})
+
+		var result []bool
+		for i := 0; i < 100; i++ {
+			result = append(result, getCurrent(context.Background(), manager, secretID) != nil)
+		}
+
+		return result
+	}
+
+	// When
+	first, second := failures(42), failures(42)
+
+	// Then
+	assert.Equal(t, first, second)
+
+	failed := 0
+
+	for _, f := range first {
+		if f {
+			failed++
+		}
+	}
+
+	assert.InDelta(t, 50, failed, 20)
+}
+
+func TestFault_Timeout(t *testing.T) {
+	// Given
+	manager := inmemorysecretsmanager.New()
+	put(t, manager, "version-0", "first")
+	manager.InjectFault(inmemorysecretsmanager.Fault{Operation: inmemorysecretsmanager.OpGetSecretValue, Timeout: true})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	// When
+	err := getCurrent(ctx, manager, secretID)
+
+	// Then
+	assertErrorCode(t, err, request.CanceledErrorCode)
+	assert.ErrorIs(t, err.(awserr.Error).OrigErr(), context.DeadlineExceeded) //nolint:errorlint
+	assert.Equal(t, err, manager.Calls()[1].Err)
+}
+
+func TestFault_Latency(t *testing.T) {
+	// Given
+	manager := inmemorysecretsmanager.New()
+	put(t, manager, "version-0", "first")
+	manager.SetLatency(inmemorysecretsmanager.OpGetSecretValue, 20*time.Millisecond)
+
+	// When
+	start := time.Now()
+	err := getCurrent(context.Background(), manager, secretID)
+	elapsed := time.Since(start)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	canceledErr := getCurrent(ctx, manager, secretID)
+
+	// Then
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, elapsed, 20*time.Millisecond)
+	assertErrorCode(t, canceledErr, request.CanceledErrorCode)
+	assert.Equal(t, canceledErr, manager.Calls()[2].Err)
+}
+
+func TestCalls(t *testing.T) {
+	// Given
+	manager := inmemorysecretsmanager.New()
+	put(t, manager, "version-0", "first")
+	require.NoError(t, getCurrent(context.Background(), manager, secretID))
+
+	// When
+	calls := manager.Calls()
+	manager.ResetCalls()
+
+	// Then
+	assert.Equal(t, []inmemorysecretsmanager.Call{
+		{Operation: inmemorysecretsmanager.OpPutSecretValue, SecretID: secretID},
+		{Operation: inmemorysecretsmanager.OpGetSecretValue, SecretID: secretID},
+	}, calls)
+	assert.Empty(t, manager.Calls())
+	assert.Zero(t, manager.CallCount(inmemorysecretsmanager.OpPutSecretValue, ""))
+}
@@ -0,0 +1,144 @@
+package inmemorysecretsmanager
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/google/uuid"
+
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator"
+	step2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/step"
+	versionstage2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/versionstage"
+)
+
+// RotationFunction stands in for a rotation lambda, JWTRotator.Rotate can be
+// registered directly.
+type RotationFunction func(ctx context.Context, event jwtrotator.SecretManagerEvent) error
+
+type rotationConfig struct {
+	lambdaARN       string
+	rules           *secretsmanager.RotationRulesType
+	lastRotatedDate *time.Time
+}
+
+// RegisterRotationFunction makes fn the rotation lambda with the given ARN.
+func (s *InMemorySecretsManager) RegisterRotationFunction(lambdaARN string, fn RotationFunction) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.functions == nil {
+		s.functions = make(map[string]RotationFunction)
+	}
+
+	s.functions[lambdaARN] = fn
+}
+
+// RotateSecretWithContext enables rotation of a secret and rotates it by
+// invoking the rotation function with the createSecret, setSecret, testSecret
+// and finishSecret steps. The function is the one registered for
+// RotationLambdaARN, or the one the secret was last rotated with.
+//
+// Unlike AWS, which rotates asynchronously, the steps run before returning and
+// the error of a failed step is returned. The labels are left as the failed
+// step left them, so a pending version makes later rotations fail until it is
+// promoted or removed.
+func (s *InMemorySecretsManager) RotateSecretWithContext(ctx aws.Context, input *secretsmanager.RotateSecretInput, _ ...request.Option) (*secretsmanager.RotateSecretOutput, error) {
+	if err := s.before(ctx, OpRotateSecret, input.SecretId); err != nil {
+		return nil, err
+	}
+
+	secretID := aws.StringValue(input.SecretId)
+
+	s.m.Lock()
+
+	config, fn, err := s.prepareRotation(input)
+	if err != nil {
+		s.m.Unlock()
+		return nil, err
+	}
+
+	s.m.Unlock()
+
+	clientRequestToken := aws.StringValue(input.ClientRequestToken)
+	if clientRequestToken == "" {
+		clientRequestToken = uuid.New().String()
+	}
+
+	for _, step := range []step2.Step{step2.CreateSecret, step2.SetSecret, step2.TestSecret, step2.FinishSecret} {
+		if err = fn(ctx, jwtrotator.SecretManagerEvent{
+			Step:               step,
+			SecretID:           secretID,
+			ClientRequestToken: clientRequestToken,
+		}); err != nil {
+			return nil, fmt.Errorf("rotation of secret %s failed in step %s: %w", secretID, step, err)
+		}
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	current := versionstage2.AwsCurrent.StringPtr()
+	if v := s.content[secretID].Get(&clientRequestToken, current); v == nil {
+		return nil, &secretsmanager.InvalidRequestException{
+			Message_: aws.String(fmt.Sprintf("rotation of secret %s finished without moving %s to version %s", secretID, *current, clientRequestToken)),
+		}
+	}
+
+	now := time.Now()
+	config.lastRotatedDate = &now
+
+	return &secretsmanager.RotateSecretOutput{
+		Name:      input.SecretId,
+		VersionId: &clientRequestToken,
+	}, nil
+}
+
+// prepareRotation enables rotation of the secret and returns its rotation
+// function, it must be called with the lock held.
+func (s *InMemorySecretsManager) prepareRotation(input *secretsmanager.RotateSecretInput) (*rotationConfig, RotationFunction, error) {
+	secretID := aws.StringValue(input.SecretId)
+
+	if err := s.checkExists(input.SecretId); err != nil {
+		return nil, nil, err
+	}
+
+	pending := versionstage2.AWSPending.StringPtr()
+	if v := s.content[secretID].Get(nil, pending); v != nil && !v.Stages.IncludesStage(versionstage2.AwsCurrent.StringPtr()) {
+		return nil, nil, &secretsmanager.InvalidRequestException{
+			Message_: aws.String(fmt.Sprintf("a previous rotation isn't complete, version %s of secret %s is still %s", v.VersionID, secretID, *pending)),
+		}
+	}
+
+	if s.rotation == nil {
+		s.rotation = make(map[string]*rotationConfig)
+	}
+
+	config, ok := s.rotation[secretID]
+	if !ok {
+		config = &rotationConfig{}
+	}
+
+	lambdaARN := config.lambdaARN
+	if input.RotationLambdaARN != nil {
+		lambdaARN = *input.RotationLambdaARN
+	}
+
+	fn, ok := s.functions[lambdaARN]
+	if !ok {
+		return nil, nil, invalidParameter("no rotation function registered for RotationLambdaARN '%s'", lambdaARN)
+	}
+
+	config.lambdaARN = lambdaARN
+
+	if input.RotationRules != nil {
+		config.rules = input.RotationRules
+	}
+
+	s.rotation[secretID] = config
+
+	return config, fn, nil
+}
@@ -1,86 +1,306 @@
 package inmemorysecretsmanager
 
 import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/secretsmanager"
 
 	"github.com/SKF/jwt-rotator/pkg/jwtrotator"
+	versionstage2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/versionstage"
 )
 
+// InMemorySecretsManager emulates the parts of AWS Secrets Manager used by the
+// rotator, it is safe for concurrent use. Unlike AWS, a secret is created by
+// the first value or tag put to it.
 type InMemorySecretsManager struct {
+	m       sync.Mutex
 	content map[string]versions
+	tags    map[string][]*secretsmanager.Tag
+
+	rotation  map[string]*rotationConfig
+	functions map[string]RotationFunction
+
+	faults  []*Fault
+	latency map[Operation]time.Duration
+	rand    *rand.Rand
+	calls   []*Call
 }
 
 func New() *InMemorySecretsManager {
 	return &InMemorySecretsManager{
 		content: make(map[string]versions),
+		tags:    make(map[string][]*secretsmanager.Tag),
 	}
 }
 
-func (s InMemorySecretsManager) DescribeSecretWithContext(_ aws.Context, input *secretsmanager.DescribeSecretInput, _ ...request.Option) (*secretsmanager.DescribeSecretOutput, error) {
-	contentVersions := s.content[*input.SecretId]
+// CreateSecretWithContext creates a secret without versions, with the given
+// tags. Creating a secret which exists fails with ResourceExistsException.
+// Unlike AWS it does not store an initial value.
+func (s *InMemorySecretsManager) CreateSecretWithContext(ctx aws.Context, input *secretsmanager.CreateSecretInput, _ ...request.Option) (*secretsmanager.CreateSecretOutput, error) {
+	if err := s.before(ctx, OpCreateSecret, input.Name); err != nil {
+		return nil, err
+	}
+
+	if input.SecretString != nil || input.SecretBinary != nil {
+		return nil, invalidParameter("the emulator does not store an initial value, put it with PutSecretValue")
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.checkExists(input.Name) == nil {
+		return nil, &secretsmanager.ResourceExistsException{
+			Message_: aws.String(fmt.Sprintf("secret %s already exists", *input.Name)),
+		}
+	}
+
+	s.content[*input.Name] = versions{}
+	s.tags[*input.Name] = append([]*secretsmanager.Tag(nil), input.Tags...)
+
+	return &secretsmanager.CreateSecretOutput{Name: input.Name}, nil
+}
+
+func (s *InMemorySecretsManager) DescribeSecretWithContext(ctx aws.Context, input *secretsmanager.DescribeSecretInput, _ ...request.Option) (*secretsmanager.DescribeSecretOutput, error) {
+	if err := s.before(ctx, OpDescribeSecret, input.SecretId); err != nil {
+		return nil, err
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if err := s.checkExists(input.SecretId); err != nil {
+		return nil, err
+	}
 
 	result := make(map[string][]*string)
 
-	for _, v := range contentVersions {
-		result[v.VersionID] = v.Stages.ToStrings()
+	for _, v := range s.content[*input.SecretId] {
+		if len(v.Stages) > 0 {
+			result[v.VersionID] = v.Stages.ToStrings()
+		}
 	}
 
-	return &secretsmanager.DescribeSecretOutput{
+	output := &secretsmanager.DescribeSecretOutput{
+		Name:               input.SecretId,
+		Tags:               s.tags[*input.SecretId],
 		VersionIdsToStages: result,
-	}, nil
+	}
+
+	if config, ok := s.rotation[*input.SecretId]; ok {
+		output.RotationEnabled = aws.Bool(true)
+		output.RotationLambdaARN = aws.String(config.lambdaARN)
+		output.RotationRules = config.rules
+		output.LastRotatedDate = config.lastRotatedDate
+	}
+
+	return output, nil
 }
 
-func (s *InMemorySecretsManager) UpdateSecretVersionStageWithContext(_ aws.Context, input *secretsmanager.UpdateSecretVersionStageInput, _ ...request.Option) (*secretsmanager.UpdateSecretVersionStageOutput, error) {
-	contentVersions := s.content[*input.SecretId]
+func (s *InMemorySecretsManager) TagResourceWithContext(ctx aws.Context, input *secretsmanager.TagResourceInput, _ ...request.Option) (*secretsmanager.TagResourceOutput, error) {
+	if err := s.before(ctx, OpTagResource, input.SecretId); err != nil {
+		return nil, err
+	}
 
-	for i := range contentVersions {
-		if contentVersions[i].VersionID == *input.RemoveFromVersionId {
-			contentVersions[i].Stages.RemoveStage(input.VersionStage)
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	existingTags := s.tags[*input.SecretId]
+
+	for _, tag := range input.Tags {
+		replaced := false
+
+		for i := range existingTags {
+			if *existingTags[i].Key == *tag.Key {
+				existingTags[i] = tag
+				replaced = true
+			}
 		}
 
-		if contentVersions[i].VersionID == *input.MoveToVersionId {
-			contentVersions[i].Stages.AddStage(input.VersionStage)
+		if !replaced {
+			existingTags = append(existingTags, tag)
 		}
 	}
 
-	return nil, nil
+	s.tags[*input.SecretId] = existingTags
+
+	return &secretsmanager.TagResourceOutput{}, nil
 }
 
-func (s *InMemorySecretsManager) PutSecretValueWithContext(_ aws.Context, input *secretsmanager.PutSecretValueInput, _ ...request.Option) (*secretsmanager.PutSecretValueOutput, error) {
-	newVersion := version{
-		VersionID:    *input.ClientRequestToken,
-		Stages:       StagesFromStrings(input.VersionStages),
-		SecretBinary: input.SecretBinary,
+// UpdateSecretVersionStageWithContext moves a staging label like AWS does: a
+// label attached to a version may only be moved by naming that version in
+// RemoveFromVersionId, and the version losing AWSCURRENT gets AWSPREVIOUS.
+func (s *InMemorySecretsManager) UpdateSecretVersionStageWithContext(ctx aws.Context, input *secretsmanager.UpdateSecretVersionStageInput, _ ...request.Option) (*secretsmanager.UpdateSecretVersionStageOutput, error) {
+	if err := s.before(ctx, OpUpdateSecretVersionStage, input.SecretId); err != nil {
+		return nil, err
 	}
 
-	existingVersions, ok := s.content[*input.SecretId]
-	if !ok {
-		s.content[*input.SecretId] = versions{newVersion}
-		return nil, nil
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if err := s.checkExists(input.SecretId); err != nil {
+		return nil, err
+	}
+
+	contentVersions := s.content[*input.SecretId]
+	stage := aws.StringValue(input.VersionStage)
+	moveTo := aws.StringValue(input.MoveToVersionId)
+	removeFrom := aws.StringValue(input.RemoveFromVersionId)
+
+	if stage == "" {
+		return nil, invalidParameter("you must specify VersionStage")
 	}
 
-	s.content[*input.SecretId] = append(existingVersions, newVersion)
+	if err := versionstage2.VersionStage(stage).Validate(); err != nil {
+		return nil, invalidParameter("%s", err)
+	}
+
+	holder := contentVersions.Get(nil, &stage)
 
-	return nil, nil
+	switch {
+	case holder != nil && holder.VersionID != removeFrom && holder.VersionID != moveTo:
+		return nil, invalidParameter("staging label %s is currently attached to version %s, so you must explicitly reference that version in RemoveFromVersionId", stage, holder.VersionID)
+	case removeFrom != "" && (holder == nil || holder.VersionID != removeFrom):
+		return nil, invalidParameter("staging label %s is not attached to version %s", stage, removeFrom)
+	case moveTo != "" && contentVersions.Get(&moveTo, nil) == nil:
+		return nil, resourceNotFound("version %s of secret %s not found", moveTo, *input.SecretId)
+	}
+
+	if holder == nil || holder.VersionID != moveTo {
+		contentVersions.moveStage(versionstage2.VersionStage(stage), moveTo)
+	}
+
+	return &secretsmanager.UpdateSecretVersionStageOutput{
+		Name: input.SecretId,
+	}, nil
 }
 
-func (s InMemorySecretsManager) GetSecretValueWithContext(_ aws.Context, input *secretsmanager.GetSecretValueInput, _ ...request.Option) (*secretsmanager.GetSecretValueOutput, error) {
+// PutSecretValueWithContext stores a new version and moves its staging labels,
+// AWSCURRENT if none are given, from the versions holding them. Putting the
+// same value with an existing ClientRequestToken is a no-op, putting another
+// value fails with ResourceExistsException.
+func (s *InMemorySecretsManager) PutSecretValueWithContext(ctx aws.Context, input *secretsmanager.PutSecretValueInput, _ ...request.Option) (*secretsmanager.PutSecretValueOutput, error) {
+	if err := s.before(ctx, OpPutSecretValue, input.SecretId); err != nil {
+		return nil, err
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	versionID := aws.StringValue(input.ClientRequestToken)
+	if versionID == "" {
+		return nil, invalidParameter("you must specify ClientRequestToken")
+	}
+
+	existingVersions := s.content[*input.SecretId]
+
+	if existing := existingVersions.Get(&versionID, nil); existing != nil {
+		if !bytes.Equal(existing.SecretBinary, input.SecretBinary) || aws.StringValue(existing.SecretString) != aws.StringValue(input.SecretString) {
+			return nil, &secretsmanager.ResourceExistsException{
+				Message_: aws.String(fmt.Sprintf("a version with ClientRequestToken %s already exists with a different value", versionID)),
+			}
+		}
+
+		return &secretsmanager.PutSecretValueOutput{
+			Name:          input.SecretId,
+			VersionId:     &existing.VersionID,
+			VersionStages: existing.Stages.ToStrings(),
+		}, nil
+	}
+
+	stages := StagesFromStrings(input.VersionStages)
+	if len(stages) == 0 {
+		stages = Stages{versionstage2.AwsCurrent}
+	}
+
+	for _, stage := range stages {
+		if err := stage.Validate(); err != nil {
+			return nil, invalidParameter("%s", err)
+		}
+	}
+
+	existingVersions = append(existingVersions, version{
+		VersionID:    versionID,
+		SecretBinary: append([]byte(nil), input.SecretBinary...),
+		SecretString: input.SecretString,
+		CreatedDate:  time.Now(),
+	})
+
+	for _, stage := range stages {
+		existingVersions.moveStage(stage, versionID)
+	}
+
+	s.content[*input.SecretId] = existingVersions
+
+	return &secretsmanager.PutSecretValueOutput{
+		Name:          input.SecretId,
+		VersionId:     &versionID,
+		VersionStages: stages.ToStrings(),
+	}, nil
+}
+
+// GetSecretValueWithContext returns the version matching VersionId and
+// VersionStage, or the AWSCURRENT version if neither is given.
+func (s *InMemorySecretsManager) GetSecretValueWithContext(ctx aws.Context, input *secretsmanager.GetSecretValueInput, _ ...request.Option) (*secretsmanager.GetSecretValueOutput, error) {
+	if err := s.before(ctx, OpGetSecretValue, input.SecretId); err != nil {
+		return nil, err
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
 	versionSlice, ok := s.content[*input.SecretId]
 	if !ok {
-		return nil, &secretsmanager.ResourceNotFoundException{}
+		return nil, resourceNotFound("secret %s not found", *input.SecretId)
 	}
 
-	if matchedVersion := versionSlice.Get(input.VersionId, input.VersionStage); matchedVersion != nil {
+	versionStage := input.VersionStage
+	if input.VersionId == nil && versionStage == nil {
+		versionStage = versionstage2.AwsCurrent.StringPtr()
+	}
+
+	if matchedVersion := versionSlice.Get(input.VersionId, versionStage); matchedVersion != nil {
+		createdDate := matchedVersion.CreatedDate
+
 		return &secretsmanager.GetSecretValueOutput{
-			SecretBinary:  matchedVersion.SecretBinary,
-			VersionId:     &matchedVersion.VersionID,
+			Name:          input.SecretId,
+			CreatedDate:   &createdDate,
+			SecretBinary:  append([]byte(nil), matchedVersion.SecretBinary...),
+			SecretString:  matchedVersion.SecretString,
+			VersionId:     aws.String(matchedVersion.VersionID),
 			VersionStages: matchedVersion.Stages.ToStrings(),
 		}, nil
 	}
 
-	return nil, &secretsmanager.ResourceNotFoundException{}
+	return nil, resourceNotFound("no version of secret %s matches VersionId %s and VersionStage %s",
+		*input.SecretId, aws.StringValue(input.VersionId), aws.StringValue(versionStage))
 }
 
-var _ jwtrotator.SecretsManagerClient = &InMemorySecretsManager{}
+func (s *InMemorySecretsManager) checkExists(secretID *string) error {
+	_, hasContent := s.content[*secretID]
+	_, hasTags := s.tags[*secretID]
+
+	if !hasContent && !hasTags {
+		return resourceNotFound("secret %s not found", *secretID)
+	}
+
+	return nil
+}
+
+func resourceNotFound(format string, args ...interface{}) error {
+	return &secretsmanager.ResourceNotFoundException{Message_: aws.String(fmt.Sprintf(format, args...))}
+}
+
+func invalidParameter(format string, args ...interface{}) error {
+	return &secretsmanager.InvalidParameterException{Message_: aws.String(fmt.Sprintf(format, args...))}
+}
+
+var (
+	_ jwtrotator.SecretsManagerClient = &InMemorySecretsManager{}
+	_ jwtrotator.SecretsManagerTagger = &InMemorySecretsManager{}
+)
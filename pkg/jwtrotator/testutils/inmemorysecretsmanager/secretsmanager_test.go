@@ -0,0 +1,281 @@
+package inmemorysecretsmanager_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator"
+	step2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/step"
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator/testutils/inmemorysecretsmanager"
+	versionstage2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/versionstage"
+)
+
+const secretID = "secret/to/rotate"
+
+func put(t *testing.T, manager *inmemorysecretsmanager.InMemorySecretsManager, versionID, value string, stages ...versionstage2.VersionStage) {
+	t.Helper()
+
+	input := &secretsmanager.PutSecretValueInput{
+		SecretId:           aws.String(secretID),
+		ClientRequestToken: aws.String(versionID),
+		SecretBinary:       []byte(value),
+	}
+
+	for _, stage := range stages {
+		input.VersionStages = append(input.VersionStages, stage.StringPtr())
+	}
+
+	_, err := manager.PutSecretValueWithContext(context.Background(), input)
+	require.NoError(t, err)
+}
+
+func describe(t *testing.T, manager *inmemorysecretsmanager.InMemorySecretsManager) map[string][]string {
+	t.Helper()
+
+	output, err := manager.DescribeSecretWithContext(context.Background(), &secretsmanager.DescribeSecretInput{SecretId: aws.String(secretID)})
+	require.NoError(t, err)
+
+	result := make(map[string][]string, len(output.VersionIdsToStages))
+	for versionID, stages := range output.VersionIdsToStages {
+		result[versionID] = aws.StringValueSlice(stages)
+	}
+
+	return result
+}
+
+func assertErrorCode(t *testing.T, err error, code string) {
+	t.Helper()
+
+	var aerr awserr.Error
+
+	require.ErrorAs(t, err, &aerr)
+	assert.Equal(t, code, aerr.Code())
+}
+
+func TestCreateSecret(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	manager := inmemorysecretsmanager.New()
+	input := &secretsmanager.CreateSecretInput{Name: aws.String(secretID)}
+
+	// When
+	_, err := manager.CreateSecretWithContext(ctx, input)
+	_, existsErr := manager.CreateSecretWithContext(ctx, input)
+
+	// Then
+	require.NoError(t, err)
+	assertErrorCode(t, existsErr, secretsmanager.ErrCodeResourceExistsException)
+	assert.Empty(t, describe(t, manager))
+
+	_, err = manager.GetSecretValueWithContext(ctx, &secretsmanager.GetSecretValueInput{SecretId: aws.String(secretID)})
+	assertErrorCode(t, err, secretsmanager.ErrCodeResourceNotFoundException)
+}
+
+func TestPutSecretValue_MovesStages(t *testing.T) {
+	// Given
+	manager := inmemorysecretsmanager.New()
+	put(t, manager, "version-0", "first")
+	put(t, manager, "version-1", "second", versionstage2.AWSPending)
+
+	// When
+	put(t, manager, "version-2", "third", versionstage2.AWSPending)
+	put(t, manager, "version-3", "fourth", versionstage2.AwsCurrent)
+
+	// Then
+	assert.Equal(t, map[string][]string{
+		"version-0": {"AWSPREVIOUS"},
+		"version-2": {"AWSPENDING"},
+		"version-3": {"AWSCURRENT"},
+	}, describe(t, manager))
+}
+
+func TestPutSecretValue_ExistingClientRequestToken(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	manager := inmemorysecretsmanager.New()
+	put(t, manager, "version-0", "first")
+
+	// When
+	put(t, manager, "version-0", "first", versionstage2.AWSPending)
+	_, err := manager.PutSecretValueWithContext(ctx, &secretsmanager.PutSecretValueInput{
+		SecretId:           aws.String(secretID),
+		ClientRequestToken: aws.String("version-0"),
+		SecretBinary:       []byte("other"),
+	})
+
+	// Then
+	assertErrorCode(t, err, secretsmanager.ErrCodeResourceExistsException)
+	assert.Equal(t, map[string][]string{"version-0": {"AWSCURRENT"}}, describe(t, manager))
+}
+
+func TestUpdateSecretVersionStage_AssignsPrevious(t *testing.T) {
+	// Given
+	manager := inmemorysecretsmanager.New()
+	put(t, manager, "version-0", "first")
+	put(t, manager, "version-1", "second", versionstage2.AWSPending)
+
+	// When
+	_, err := manager.UpdateSecretVersionStageWithContext(context.Background(), &secretsmanager.UpdateSecretVersionStageInput{
+		SecretId:            aws.String(secretID),
+		VersionStage:        aws.String("AWSCURRENT"),
+		MoveToVersionId:     aws.String("version-1"),
+		RemoveFromVersionId: aws.String("version-0"),
+	})
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{
+		"version-0": {"AWSPREVIOUS"},
+		"version-1": {"AWSPENDING", "AWSCURRENT"},
+	}, describe(t, manager))
+}
+
+func TestUpdateSecretVersionStage_RemoveFromVersionID(t *testing.T) {
+	for name, removeFrom := range map[string]*string{
+		"missing":      nil,
+		"wrong holder": aws.String("version-1"),
+	} {
+		removeFrom := removeFrom
+
+		t.Run(name, func(t *testing.T) {
+			// Given
+			manager := inmemorysecretsmanager.New()
+			put(t, manager, "version-0", "first")
+			put(t, manager, "version-1", "second", versionstage2.AWSPending)
+
+			// When
+			_, err := manager.UpdateSecretVersionStageWithContext(context.Background(), &secretsmanager.UpdateSecretVersionStageInput{
+				SecretId:            aws.String(secretID),
+				VersionStage:        aws.String("AWSCURRENT"),
+				MoveToVersionId:     aws.String("version-1"),
+				RemoveFromVersionId: removeFrom,
+			})
+
+			// Then
+			assertErrorCode(t, err, secretsmanager.ErrCodeInvalidParameterException)
+			assert.Equal(t, []string{"AWSCURRENT"}, describe(t, manager)["version-0"])
+		})
+	}
+}
+
+func TestUpdateSecretVersionStage_InvalidLabel(t *testing.T) {
+	// Given
+	manager := inmemorysecretsmanager.New()
+	put(t, manager, "version-0", "first")
+
+	// When
+	_, err := manager.UpdateSecretVersionStageWithContext(context.Background(), &secretsmanager.UpdateSecretVersionStageInput{
+		SecretId:        aws.String(secretID),
+		VersionStage:    aws.String(strings.Repeat("X", versionstage2.MaxLength+1)),
+		MoveToVersionId: aws.String("version-0"),
+	})
+
+	// Then
+	assertErrorCode(t, err, secretsmanager.ErrCodeInvalidParameterException)
+}
+
+func TestDescribeSecret_Unknown(t *testing.T) {
+	// Given
+	manager := inmemorysecretsmanager.New()
+
+	// When
+	_, err := manager.DescribeSecretWithContext(context.Background(), &secretsmanager.DescribeSecretInput{SecretId: aws.String(secretID)})
+
+	// Then
+	assertErrorCode(t, err, secretsmanager.ErrCodeResourceNotFoundException)
+}
+
+func TestConcurrentUse(t *testing.T) {
+	// Given
+	manager := inmemorysecretsmanager.New()
+
+	var wg sync.WaitGroup
+
+	// When
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			put(t, manager, fmt.Sprintf("version-%d", i), "value")
+			describe(t, manager)
+		}(i)
+	}
+
+	wg.Wait()
+
+	// Then
+	stages := describe(t, manager)
+	assert.Len(t, stages, 2)
+}
+
+func TestRotateSecret_NoRotationFunction(t *testing.T) {
+	// Given
+	manager := inmemorysecretsmanager.New()
+	put(t, manager, "version-0", "first")
+
+	// When
+	_, err := manager.RotateSecretWithContext(context.Background(), &secretsmanager.RotateSecretInput{
+		SecretId:          aws.String(secretID),
+		RotationLambdaARN: aws.String("arn:aws:lambda:eu-west-1:123456789012:function:unknown"),
+	})
+
+	// Then
+	assertErrorCode(t, err, secretsmanager.ErrCodeInvalidParameterException)
+}
+
+func TestRotateSecret_Steps(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	manager := inmemorysecretsmanager.New()
+	put(t, manager, "version-0", "first")
+
+	var steps []string
+
+	manager.RegisterRotationFunction("rotate", func(ctx context.Context, event jwtrotator.SecretManagerEvent) error {
+		steps = append(steps, string(event.Step))
+
+		if event.Step == step2.CreateSecret {
+			put(t, manager, event.ClientRequestToken, "second", versionstage2.AWSPending)
+		}
+
+		if event.Step == step2.FinishSecret {
+			_, err := manager.UpdateSecretVersionStageWithContext(ctx, &secretsmanager.UpdateSecretVersionStageInput{
+				SecretId:            aws.String(event.SecretID),
+				VersionStage:        aws.String("AWSCURRENT"),
+				MoveToVersionId:     aws.String(event.ClientRequestToken),
+				RemoveFromVersionId: aws.String("version-0"),
+			})
+
+			return err
+		}
+
+		return nil
+	})
+
+	// When
+	output, err := manager.RotateSecretWithContext(ctx, &secretsmanager.RotateSecretInput{
+		SecretId:           aws.String(secretID),
+		ClientRequestToken: aws.String("version-1"),
+		RotationLambdaARN:  aws.String("rotate"),
+	})
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, "version-1", aws.StringValue(output.VersionId))
+	assert.Equal(t, []string{"createSecret", "setSecret", "testSecret", "finishSecret"}, steps)
+	assert.Equal(t, map[string][]string{
+		"version-0": {"AWSPREVIOUS"},
+		"version-1": {"AWSPENDING", "AWSCURRENT"},
+	}, describe(t, manager))
+}
@@ -0,0 +1,182 @@
+package inmemorysecretsmanager
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	secretsmanagerv1 "github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/smithy-go"
+
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator/secretsmanagerv2"
+)
+
+// The methods in this file let the in-memory secrets manager stand in for an
+// AWS SDK for Go v2 client, they share state with the v1 methods.
+
+func (s *InMemorySecretsManager) DescribeSecret(ctx context.Context, input *secretsmanager.DescribeSecretInput, _ ...func(*secretsmanager.Options)) (*secretsmanager.DescribeSecretOutput, error) {
+	output, err := s.DescribeSecretWithContext(ctx, &secretsmanagerv1.DescribeSecretInput{
+		SecretId: input.SecretId,
+	})
+	if err != nil {
+		return nil, toV2Error(err)
+	}
+
+	result := &secretsmanager.DescribeSecretOutput{
+		ARN:                output.ARN,
+		CreatedDate:        output.CreatedDate,
+		LastChangedDate:    output.LastChangedDate,
+		LastRotatedDate:    output.LastRotatedDate,
+		Name:               output.Name,
+		RotationEnabled:    aws.BoolValue(output.RotationEnabled),
+		RotationLambdaARN:  output.RotationLambdaARN,
+		VersionIdsToStages: make(map[string][]string, len(output.VersionIdsToStages)),
+	}
+
+	for versionID, stages := range output.VersionIdsToStages {
+		result.VersionIdsToStages[versionID] = aws.StringValueSlice(stages)
+	}
+
+	if output.RotationRules != nil {
+		result.RotationRules = &types.RotationRulesType{
+			AutomaticallyAfterDays: aws.Int64Value(output.RotationRules.AutomaticallyAfterDays),
+		}
+	}
+
+	for _, tag := range output.Tags {
+		result.Tags = append(result.Tags, types.Tag{Key: tag.Key, Value: tag.Value})
+	}
+
+	return result, nil
+}
+
+func (s *InMemorySecretsManager) UpdateSecretVersionStage(ctx context.Context, input *secretsmanager.UpdateSecretVersionStageInput, _ ...func(*secretsmanager.Options)) (*secretsmanager.UpdateSecretVersionStageOutput, error) {
+	if _, err := s.UpdateSecretVersionStageWithContext(ctx, &secretsmanagerv1.UpdateSecretVersionStageInput{
+		SecretId:            input.SecretId,
+		VersionStage:        input.VersionStage,
+		MoveToVersionId:     input.MoveToVersionId,
+		RemoveFromVersionId: input.RemoveFromVersionId,
+	}); err != nil {
+		return nil, toV2Error(err)
+	}
+
+	return &secretsmanager.UpdateSecretVersionStageOutput{
+		Name: input.SecretId,
+	}, nil
+}
+
+func (s *InMemorySecretsManager) PutSecretValue(ctx context.Context, input *secretsmanager.PutSecretValueInput, _ ...func(*secretsmanager.Options)) (*secretsmanager.PutSecretValueOutput, error) {
+	output, err := s.PutSecretValueWithContext(ctx, &secretsmanagerv1.PutSecretValueInput{
+		SecretId:           input.SecretId,
+		ClientRequestToken: input.ClientRequestToken,
+		SecretBinary:       input.SecretBinary,
+		SecretString:       input.SecretString,
+		VersionStages:      aws.StringSlice(input.VersionStages),
+	})
+	if err != nil {
+		return nil, toV2Error(err)
+	}
+
+	return &secretsmanager.PutSecretValueOutput{
+		Name:          output.Name,
+		VersionId:     output.VersionId,
+		VersionStages: aws.StringValueSlice(output.VersionStages),
+	}, nil
+}
+
+func (s *InMemorySecretsManager) GetSecretValue(ctx context.Context, input *secretsmanager.GetSecretValueInput, _ ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	output, err := s.GetSecretValueWithContext(ctx, &secretsmanagerv1.GetSecretValueInput{
+		SecretId:     input.SecretId,
+		VersionId:    input.VersionId,
+		VersionStage: input.VersionStage,
+	})
+	if err != nil {
+		return nil, toV2Error(err)
+	}
+
+	return &secretsmanager.GetSecretValueOutput{
+		ARN:           output.ARN,
+		CreatedDate:   output.CreatedDate,
+		Name:          output.Name,
+		SecretBinary:  output.SecretBinary,
+		SecretString:  output.SecretString,
+		VersionId:     output.VersionId,
+		VersionStages: aws.StringValueSlice(output.VersionStages),
+	}, nil
+}
+
+func (s *InMemorySecretsManager) TagResource(ctx context.Context, input *secretsmanager.TagResourceInput, _ ...func(*secretsmanager.Options)) (*secretsmanager.TagResourceOutput, error) {
+	tags := make([]*secretsmanagerv1.Tag, 0, len(input.Tags))
+	for _, tag := range input.Tags {
+		tags = append(tags, &secretsmanagerv1.Tag{Key: tag.Key, Value: tag.Value})
+	}
+
+	if _, err := s.TagResourceWithContext(ctx, &secretsmanagerv1.TagResourceInput{
+		SecretId: input.SecretId,
+		Tags:     tags,
+	}); err != nil {
+		return nil, toV2Error(err)
+	}
+
+	return &secretsmanager.TagResourceOutput{}, nil
+}
+
+func (s *InMemorySecretsManager) RotateSecret(ctx context.Context, input *secretsmanager.RotateSecretInput, _ ...func(*secretsmanager.Options)) (*secretsmanager.RotateSecretOutput, error) {
+	v1Input := &secretsmanagerv1.RotateSecretInput{
+		SecretId:           input.SecretId,
+		ClientRequestToken: input.ClientRequestToken,
+		RotationLambdaARN:  input.RotationLambdaARN,
+	}
+
+	if input.RotationRules != nil {
+		v1Input.RotationRules = &secretsmanagerv1.RotationRulesType{
+			AutomaticallyAfterDays: aws.Int64(input.RotationRules.AutomaticallyAfterDays),
+		}
+	}
+
+	output, err := s.RotateSecretWithContext(ctx, v1Input)
+	if err != nil {
+		return nil, toV2Error(err)
+	}
+
+	return &secretsmanager.RotateSecretOutput{
+		ARN:       output.ARN,
+		Name:      output.Name,
+		VersionId: output.VersionId,
+	}, nil
+}
+
+// toV2Error converts the v1 errors of the in-memory secrets manager to the
+// error types returned by the v2 client.
+func toV2Error(err error) error {
+	// Only errors of the emulator itself are converted, failures of a
+	// rotation function are returned as they are.
+	aerr, ok := err.(awserr.Error) //nolint:errorlint
+	if !ok {
+		return err
+	}
+
+	message := aws.String(aerr.Message())
+
+	switch aerr.Code() {
+	case request.CanceledErrorCode:
+		return aerr.OrigErr()
+	case secretsmanagerv1.ErrCodeInternalServiceError:
+		return &types.InternalServiceError{Message: message}
+	case secretsmanagerv1.ErrCodeResourceNotFoundException:
+		return &types.ResourceNotFoundException{Message: message}
+	case secretsmanagerv1.ErrCodeResourceExistsException:
+		return &types.ResourceExistsException{Message: message}
+	case secretsmanagerv1.ErrCodeInvalidParameterException:
+		return &types.InvalidParameterException{Message: message}
+	case secretsmanagerv1.ErrCodeInvalidRequestException:
+		return &types.InvalidRequestException{Message: message}
+	}
+
+	return &smithy.GenericAPIError{Code: aerr.Code(), Message: aerr.Message()}
+}
+
+var _ secretsmanagerv2.API = &InMemorySecretsManager{}
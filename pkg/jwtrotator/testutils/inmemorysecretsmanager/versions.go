@@ -1,9 +1,17 @@
 package inmemorysecretsmanager
 
+import (
+	"time"
+
+	versionstage2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/versionstage"
+)
+
 type version struct {
 	VersionID    string
 	Stages       Stages
 	SecretBinary []byte
+	SecretString *string
+	CreatedDate  time.Time
 }
 
 func (v version) Get(versionID *string, versionStage *string) *version {
@@ -36,4 +44,22 @@ func (v versions) Get(versionID *string, versionStage *string) *version {
 	return nil
 }
 
+// moveStage removes stage from every version and attaches it to toVersionID,
+// when it is not empty. The version losing AWSCURRENT gets AWSPREVIOUS.
+func (v versions) moveStage(stage versionstage2.VersionStage, toVersionID string) {
+	stageString := string(stage)
+
+	if holder := v.Get(nil, &stageString); holder != nil && stage == versionstage2.AwsCurrent && toVersionID != "" && holder.VersionID != toVersionID {
+		v.moveStage(versionstage2.AWSPrevious, holder.VersionID)
+	}
+
+	for i := range v {
+		v[i].Stages.RemoveStage(&stageString)
+
+		if v[i].VersionID == toVersionID {
+			v[i].Stages.AddStage(&stageString)
+		}
+	}
+}
+
 func (v version) GetByInput() {}
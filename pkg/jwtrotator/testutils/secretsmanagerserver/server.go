@@ -0,0 +1,232 @@
+// Package secretsmanagerserver serves an in-memory secrets manager over the
+// AWS JSON 1.1 protocol of Secrets Manager, so real v1 and v2 SDK clients can
+// be tested against it with their serialization, endpoint and error decoding.
+package secretsmanagerserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"time"
+
+	awsv2 "github.com/aws/aws-sdk-go-v2/aws"
+	secretsmanagerv2 "github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator/testutils/inmemorysecretsmanager"
+)
+
+const (
+	targetPrefix = "secretsmanager."
+	region       = "eu-west-1"
+)
+
+type operation func(ctx context.Context, r *http.Request) (interface{}, error)
+
+// Server is an httptest.Server in front of an in-memory secrets manager.
+type Server struct {
+	*httptest.Server
+
+	Manager *inmemorysecretsmanager.InMemorySecretsManager
+
+	operations map[string]operation
+}
+
+// New starts a server backed by manager, close it when done.
+func New(manager *inmemorysecretsmanager.InMemorySecretsManager) *Server {
+	s := &Server{Manager: manager}
+
+	s.operations = map[string]operation{
+		"DescribeSecret": func(ctx context.Context, r *http.Request) (interface{}, error) {
+			input := &secretsmanager.DescribeSecretInput{}
+			if err := decode(r, input); err != nil {
+				return nil, err
+			}
+
+			output, err := manager.DescribeSecretWithContext(ctx, input)
+			if err != nil {
+				return nil, err
+			}
+
+			return describeSecretOutput{DescribeSecretOutput: output, LastRotatedDate: toTimestamp(output.LastRotatedDate)}, nil
+		},
+		"GetSecretValue": func(ctx context.Context, r *http.Request) (interface{}, error) {
+			input := &secretsmanager.GetSecretValueInput{}
+			if err := decode(r, input); err != nil {
+				return nil, err
+			}
+
+			output, err := manager.GetSecretValueWithContext(ctx, input)
+			if err != nil {
+				return nil, err
+			}
+
+			return getSecretValueOutput{GetSecretValueOutput: output, CreatedDate: toTimestamp(output.CreatedDate)}, nil
+		},
+		"PutSecretValue": func(ctx context.Context, r *http.Request) (interface{}, error) {
+			input := &secretsmanager.PutSecretValueInput{}
+			if err := decode(r, input); err != nil {
+				return nil, err
+			}
+
+			return manager.PutSecretValueWithContext(ctx, input)
+		},
+		"UpdateSecretVersionStage": func(ctx context.Context, r *http.Request) (interface{}, error) {
+			input := &secretsmanager.UpdateSecretVersionStageInput{}
+			if err := decode(r, input); err != nil {
+				return nil, err
+			}
+
+			return manager.UpdateSecretVersionStageWithContext(ctx, input)
+		},
+		"TagResource": func(ctx context.Context, r *http.Request) (interface{}, error) {
+			input := &secretsmanager.TagResourceInput{}
+			if err := decode(r, input); err != nil {
+				return nil, err
+			}
+
+			return manager.TagResourceWithContext(ctx, input)
+		},
+		"RotateSecret": func(ctx context.Context, r *http.Request) (interface{}, error) {
+			input := &secretsmanager.RotateSecretInput{}
+			if err := decode(r, input); err != nil {
+				return nil, err
+			}
+
+			return manager.RotateSecretWithContext(ctx, input)
+		},
+	}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+
+	return s
+}
+
+// V1Client returns an AWS SDK for Go v1 client sending its requests to the
+// server.
+func (s *Server) V1Client() *secretsmanager.SecretsManager {
+	sess := session.Must(session.NewSession(&aws.Config{
+		Endpoint:    aws.String(s.URL),
+		Region:      aws.String(region),
+		Credentials: credentials.NewStaticCredentials("AKIDEXAMPLE", "secret", ""),
+		MaxRetries:  aws.Int(0),
+	}))
+
+	return secretsmanager.New(sess)
+}
+
+// V2Client returns an AWS SDK for Go v2 client sending its requests to the
+// server.
+func (s *Server) V2Client() *secretsmanagerv2.Client {
+	return secretsmanagerv2.New(secretsmanagerv2.Options{
+		Region:           region,
+		EndpointResolver: secretsmanagerv2.EndpointResolverFromURL(s.URL),
+		Credentials: awsv2.CredentialsProviderFunc(func(context.Context) (awsv2.Credentials, error) {
+			return awsv2.Credentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "secret"}, nil
+		}),
+		Retryer: awsv2.NopRetryer{},
+	})
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	target := r.Header.Get("X-Amz-Target")
+
+	op, ok := s.operations[strings.TrimPrefix(target, targetPrefix)]
+	if r.Method != http.MethodPost || !strings.HasPrefix(target, targetPrefix) || !ok {
+		writeError(w, awserr.New("UnknownOperationException", fmt.Sprintf("unknown operation '%s'", target), nil))
+		return
+	}
+
+	output, err := op(r.Context(), r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	body, err := json.Marshal(output)
+	if err != nil {
+		writeError(w, awserr.New(secretsmanager.ErrCodeInternalServiceError, err.Error(), nil))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	_, _ = w.Write(body)
+}
+
+func decode(r *http.Request, input interface{}) error {
+	if err := json.NewDecoder(r.Body).Decode(input); err != nil {
+		return awserr.New("SerializationException", err.Error(), nil)
+	}
+
+	return nil
+}
+
+// writeError writes err the way Secrets Manager does, errors which are not
+// AWS errors, like a failing rotation function, are reported as invalid
+// requests.
+func writeError(w http.ResponseWriter, err error) {
+	code, message := secretsmanager.ErrCodeInvalidRequestException, err.Error()
+
+	if aerr, ok := err.(awserr.Error); ok { //nolint:errorlint // wrapped errors are not from the emulator
+		code, message = aerr.Code(), aerr.Message()
+	}
+
+	status := http.StatusBadRequest
+	if code == secretsmanager.ErrCodeInternalServiceError || code == request.CanceledErrorCode {
+		status = http.StatusInternalServerError
+	}
+
+	body, _ := json.Marshal(struct {
+		Type    string `json:"__type"`
+		Message string `json:"message"`
+	}{Type: code, Message: message})
+
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	w.Header().Set("X-Amzn-ErrorType", code)
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
+
+// The SDK structs have no JSON tags, their field names are the names used on
+// the wire. Only their timestamps need another encoding, the outputs below
+// shadow them with a timestamp.
+type describeSecretOutput struct {
+	*secretsmanager.DescribeSecretOutput
+	LastRotatedDate *timestamp `json:",omitempty"`
+}
+
+type getSecretValueOutput struct {
+	*secretsmanager.GetSecretValueOutput
+	CreatedDate *timestamp `json:",omitempty"`
+}
+
+// timestamp is encoded in seconds since the epoch, as the JSON protocol of
+// Secrets Manager does.
+type timestamp time.Time
+
+func toTimestamp(t *time.Time) *timestamp {
+	if t == nil {
+		return nil
+	}
+
+	ts := timestamp(*t)
+
+	return &ts
+}
+
+// MarshalJSON truncates the timestamp to milliseconds like Secrets Manager,
+// rounding could move it into the future.
+func (t timestamp) MarshalJSON() ([]byte, error) {
+	milliseconds := time.Time(t).UnixNano() / int64(time.Millisecond)
+
+	return []byte(strconv.FormatFloat(float64(milliseconds)/1e3, 'f', -1, 64)), nil
+}
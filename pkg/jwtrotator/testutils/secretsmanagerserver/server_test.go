@@ -0,0 +1,144 @@
+package secretsmanagerserver_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/SKF/go-rest-utility/client/auth"
+	secretsmanagerv2 "github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator"
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator/testutils/inmemorysecretsmanager"
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator/testutils/secretsmanagerserver"
+	versionstage2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/versionstage"
+)
+
+const (
+	secretID          = "secret/to/rotate"
+	initialVersion    = "00000000-0000-4000-8000-00000000000a"
+	rotationLambdaARN = "arn:aws:lambda:eu-west-1:123456789012:function:jwt-rotator"
+)
+
+type tokenProvider struct{}
+
+func (tokenProvider) GetRawToken(context.Context) (auth.RawToken, error) {
+	claims, err := json.Marshal(map[string]interface{}{"exp": time.Now().Add(time.Hour).Unix()})
+	if err != nil {
+		return "", err
+	}
+
+	return auth.RawToken(fmt.Sprintf("e30.%s.signature", base64.RawURLEncoding.EncodeToString(claims))), nil
+}
+
+func TestServer_V1Errors(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	manager := inmemorysecretsmanager.New()
+	server := secretsmanagerserver.New(manager)
+	defer server.Close()
+
+	store := jwtrotator.SecretsManagerStore{Client: server.V1Client()}
+
+	// When
+	_, notFoundErr := store.GetSecretValue(ctx, secretID, "", versionstage2.AwsCurrent)
+
+	require.NoError(t, store.PutSecretValue(ctx, secretID, initialVersion, []byte("first"), []versionstage2.VersionStage{versionstage2.AwsCurrent}))
+	existsErr := store.PutSecretValue(ctx, secretID, initialVersion, []byte("other"), []versionstage2.VersionStage{versionstage2.AwsCurrent})
+
+	manager.InjectFault(inmemorysecretsmanager.Fault{Err: inmemorysecretsmanager.ErrThrottling})
+	_, throttledErr := store.DescribeSecret(ctx, secretID)
+
+	// Then
+	assert.ErrorIs(t, notFoundErr, jwtrotator.ErrResourceNotFound)
+	assert.ErrorIs(t, existsErr, jwtrotator.ErrResourceExists)
+
+	var aerr awserr.Error
+
+	require.True(t, errors.As(throttledErr, &aerr))
+	assert.Equal(t, "ThrottlingException", aerr.Code())
+}
+
+func TestServer_V2Errors(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	manager := inmemorysecretsmanager.New()
+	server := secretsmanagerserver.New(manager)
+	defer server.Close()
+
+	client := server.V2Client()
+
+	// When
+	_, err := client.GetSecretValue(ctx, &secretsmanagerv2.GetSecretValueInput{SecretId: aws.String(secretID)})
+
+	// Then
+	var apiErr smithy.APIError
+
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, "ResourceNotFoundException", apiErr.ErrorCode())
+}
+
+func TestServer_RotateSecret(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	manager := inmemorysecretsmanager.New()
+	server := secretsmanagerserver.New(manager)
+	defer server.Close()
+
+	client := server.V1Client()
+	store := jwtrotator.SecretsManagerStore{Client: client}
+	require.NoError(t, store.PutSecretValue(ctx, secretID, initialVersion, []byte(`{"token":"first-token"}`), []versionstage2.VersionStage{versionstage2.AwsCurrent}))
+
+	jwtRotator := jwtrotator.JWTRotator{
+		SecretsManager: client,
+		TokenProvider:  tokenProvider{},
+	}
+	manager.RegisterRotationFunction(rotationLambdaARN, jwtRotator.Rotate)
+
+	// When
+	output, err := client.RotateSecretWithContext(ctx, &secretsmanager.RotateSecretInput{
+		SecretId:          aws.String(secretID),
+		RotationLambdaARN: aws.String(rotationLambdaARN),
+	})
+
+	// Then
+	require.NoError(t, err)
+
+	description, err := client.DescribeSecretWithContext(ctx, &secretsmanager.DescribeSecretInput{SecretId: aws.String(secretID)})
+	require.NoError(t, err)
+	assert.True(t, aws.BoolValue(description.RotationEnabled))
+	assert.WithinDuration(t, time.Now(), aws.TimeValue(description.LastRotatedDate), time.Minute)
+	assert.Contains(t, aws.StringValueSlice(description.VersionIdsToStages[*output.VersionId]), "AWSCURRENT")
+	assert.Equal(t, []string{"AWSPREVIOUS"}, aws.StringValueSlice(description.VersionIdsToStages[initialVersion]))
+}
+
+func TestServer_CreatedDate(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	server := secretsmanagerserver.New(inmemorysecretsmanager.New())
+	defer server.Close()
+
+	store := jwtrotator.SecretsManagerStore{Client: server.V1Client()}
+	require.NoError(t, store.PutSecretValue(ctx, secretID, initialVersion, []byte("first"), []versionstage2.VersionStage{versionstage2.AwsCurrent}))
+
+	// When
+	v1Output, v1Err := server.V1Client().GetSecretValueWithContext(ctx, &secretsmanager.GetSecretValueInput{SecretId: aws.String(secretID)})
+	v2Output, v2Err := server.V2Client().GetSecretValue(ctx, &secretsmanagerv2.GetSecretValueInput{SecretId: aws.String(secretID)})
+
+	// Then
+	require.NoError(t, v1Err)
+	require.NoError(t, v2Err)
+	assert.WithinDuration(t, time.Now(), aws.TimeValue(v1Output.CreatedDate), time.Minute)
+	assert.Equal(t, aws.TimeValue(v1Output.CreatedDate), aws.TimeValue(v2Output.CreatedDate))
+	assert.Equal(t, []byte("first"), v2Output.SecretBinary)
+}
@@ -0,0 +1,58 @@
+package jwtrotator
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/SKF/go-rest-utility/client/auth"
+)
+
+// DecodedToken is the readable part of a JWT, the signature is deliberately
+// left out as it is not needed to reason about the token.
+type DecodedToken struct {
+	Header    map[string]interface{} `json:"header"`
+	Claims    map[string]interface{} `json:"claims"`
+	ExpiresAt *time.Time             `json:"expiresAt,omitempty"`
+}
+
+// DecodeToken decodes the header and claims of a JWT. The signature is not
+// verified, so the result must not be used for any security decisions.
+func DecodeToken(rawToken auth.RawToken) (DecodedToken, error) {
+	parts := strings.Split(string(rawToken), ".")
+	if len(parts) != 3 { //nolint:gomnd // A JWT should contain 3 parts divided by .
+		return DecodedToken{}, fmt.Errorf("%w: found %d parts, should be 3", auth.ErrInvalidToken, len(parts))
+	}
+
+	var decoded DecodedToken
+
+	if err := decodeTokenSegment(parts[0], &decoded.Header); err != nil {
+		return DecodedToken{}, fmt.Errorf("failed to decode header: %w", err)
+	}
+
+	if err := decodeTokenSegment(parts[1], &decoded.Claims); err != nil {
+		return DecodedToken{}, fmt.Errorf("failed to decode claims: %w", err)
+	}
+
+	if exp, ok := decoded.Claims["exp"].(float64); ok {
+		expiresAt := time.Unix(int64(exp), 0).UTC()
+		decoded.ExpiresAt = &expiresAt
+	}
+
+	return decoded, nil
+}
+
+func decodeTokenSegment(segment string, target *map[string]interface{}) error {
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(segment, "="))
+	if err != nil {
+		return fmt.Errorf("%w: not base64 decodable: %s", auth.ErrInvalidToken, err)
+	}
+
+	if err = json.Unmarshal(payload, target); err != nil {
+		return fmt.Errorf("%w: not a JSON object: %s", auth.ErrInvalidToken, err)
+	}
+
+	return nil
+}
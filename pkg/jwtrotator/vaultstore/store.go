@@ -0,0 +1,428 @@
+// Package vaultstore keeps rotated secrets in a HashiCorp Vault KV version 2
+// secrets engine.
+//
+// Every version of a rotated secret is stored as a KV version holding the
+// version ID and the value. The staging labels, and which KV version each
+// labelled version is stored in, are kept in the custom metadata of the secret.
+// Custom metadata outside of the jwt-rotator/ prefix is exposed as tags.
+//
+// The custom metadata of a secret can not be updated atomically, so each
+// secret should only be rotated by a single scheduler at a time.
+package vaultstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator"
+	versionstage2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/versionstage"
+)
+
+const (
+	defaultMount = "secret"
+
+	metadataPrefix        = "jwt-rotator/"
+	stageMetadataPrefix   = metadataPrefix + "stage/"
+	versionMetadataPrefix = metadataPrefix + "version/"
+)
+
+var ErrVault = errors.New("vault request failed")
+
+// Store is a jwtrotator.SecretStore backed by Vault, the secret IDs are paths
+// within the KV mount.
+type Store struct {
+	// Address of the Vault server, e.g. https://vault.example.com:8200.
+	Address string
+	Token   string
+
+	// Mount is the path the KV version 2 engine is mounted at, it defaults to
+	// "secret".
+	Mount string
+
+	Client *http.Client
+}
+
+type secretData struct {
+	VersionID string `json:"version_id"`
+	Value     string `json:"value"`
+}
+
+type kvVersion struct {
+	Data     secretData `json:"data"`
+	Metadata struct {
+		CreatedTime time.Time `json:"created_time"`
+		Version     int       `json:"version"`
+	} `json:"metadata"`
+}
+
+type kvMetadata struct {
+	CurrentVersion int               `json:"current_version"`
+	CustomMetadata map[string]string `json:"custom_metadata"`
+	Versions       map[string]struct {
+		DeletionTime string `json:"deletion_time"`
+		Destroyed    bool   `json:"destroyed"`
+	} `json:"versions"`
+}
+
+func (m kvMetadata) stageHolder(stage versionstage2.VersionStage) string {
+	return m.CustomMetadata[stageMetadataPrefix+string(stage)]
+}
+
+func (m kvMetadata) stagesOf(versionID string) []versionstage2.VersionStage {
+	var stages []versionstage2.VersionStage
+
+	for key, holder := range m.CustomMetadata {
+		if strings.HasPrefix(key, stageMetadataPrefix) && holder == versionID {
+			stages = append(stages, versionstage2.VersionStage(strings.TrimPrefix(key, stageMetadataPrefix)))
+		}
+	}
+
+	sort.Slice(stages, func(i, j int) bool { return stages[i] < stages[j] })
+
+	return stages
+}
+
+func (m *kvMetadata) setStage(stage versionstage2.VersionStage, versionID string) {
+	if previous := m.stageHolder(stage); stage == versionstage2.AwsCurrent && previous != "" && previous != versionID {
+		m.CustomMetadata[stageMetadataPrefix+string(versionstage2.AWSPrevious)] = previous
+	}
+
+	if versionID == "" {
+		delete(m.CustomMetadata, stageMetadataPrefix+string(stage))
+	} else {
+		m.CustomMetadata[stageMetadataPrefix+string(stage)] = versionID
+	}
+}
+
+// pruneVersions forgets where unlabelled versions are stored, to stay within
+// the custom metadata limits of Vault. They can still be found by scanning.
+func (m *kvMetadata) pruneVersions() {
+	for key := range m.CustomMetadata {
+		if versionID := strings.TrimPrefix(key, versionMetadataPrefix); versionID != key && len(m.stagesOf(versionID)) == 0 {
+			delete(m.CustomMetadata, key)
+		}
+	}
+}
+
+func (s Store) GetSecretValue(ctx context.Context, secretID, versionID string, stage versionstage2.VersionStage) (jwtrotator.SecretValue, error) {
+	metadata, err := s.readMetadata(ctx, secretID)
+	if err != nil {
+		return jwtrotator.SecretValue{}, err
+	}
+
+	if versionID == "" && stage == "" {
+		stage = versionstage2.AwsCurrent
+	}
+
+	if stage != "" {
+		holder := metadata.stageHolder(stage)
+		if holder == "" || (versionID != "" && holder != versionID) {
+			return jwtrotator.SecretValue{}, fmt.Errorf("%w: no version of '%s' matches version '%s' and stage '%s'", jwtrotator.ErrResourceNotFound, secretID, versionID, stage)
+		}
+
+		versionID = holder
+	}
+
+	version, err := s.findVersion(ctx, secretID, metadata, versionID)
+	if err != nil {
+		return jwtrotator.SecretValue{}, err
+	}
+
+	value, err := base64.StdEncoding.DecodeString(version.Data.Value)
+	if err != nil {
+		return jwtrotator.SecretValue{}, fmt.Errorf("failed to decode value of version '%s': %w", versionID, err)
+	}
+
+	return jwtrotator.SecretValue{
+		VersionID:   versionID,
+		Stages:      metadata.stagesOf(versionID),
+		Value:       value,
+		CreatedDate: version.Metadata.CreatedTime,
+	}, nil
+}
+
+func (s Store) PutSecretValue(ctx context.Context, secretID, versionID string, value []byte, stages []versionstage2.VersionStage) error {
+	metadata, err := s.readMetadata(ctx, secretID)
+	if errors.Is(err, jwtrotator.ErrResourceNotFound) {
+		metadata = kvMetadata{}
+	} else if err != nil {
+		return err
+	}
+
+	if metadata.CustomMetadata == nil {
+		metadata.CustomMetadata = make(map[string]string)
+	}
+
+	existing, err := s.findVersion(ctx, secretID, metadata, versionID)
+	if err == nil {
+		if existing.Data.Value != base64.StdEncoding.EncodeToString(value) {
+			return fmt.Errorf("%w: version '%s' of '%s' already exists with a different value", jwtrotator.ErrResourceExists, versionID, secretID)
+		}
+
+		if _, indexed := metadata.CustomMetadata[versionMetadataPrefix+versionID]; indexed {
+			return nil
+		}
+
+		// The data was written but the metadata write failed, finish it.
+		return s.writeVersionMetadata(ctx, secretID, metadata, versionID, existing.Metadata.Version, stages)
+	} else if !errors.Is(err, jwtrotator.ErrResourceNotFound) {
+		return err
+	}
+
+	var written struct {
+		Data struct {
+			Version int `json:"version"`
+		} `json:"data"`
+	}
+
+	if err = s.do(ctx, http.MethodPost, s.dataPath(secretID), nil, map[string]interface{}{
+		"options": map[string]interface{}{"cas": metadata.CurrentVersion},
+		"data":    secretData{VersionID: versionID, Value: base64.StdEncoding.EncodeToString(value)},
+	}, &written); err != nil {
+		return fmt.Errorf("failed to write version '%s': %w", versionID, err)
+	}
+
+	return s.writeVersionMetadata(ctx, secretID, metadata, versionID, written.Data.Version, stages)
+}
+
+// writeVersionMetadata indexes versionID as the KV version kvVersionNumber
+// and attaches stages to it, AWSCURRENT when there are none.
+func (s Store) writeVersionMetadata(ctx context.Context, secretID string, metadata kvMetadata, versionID string, kvVersionNumber int, stages []versionstage2.VersionStage) error {
+	if len(stages) == 0 {
+		stages = []versionstage2.VersionStage{versionstage2.AwsCurrent}
+	}
+
+	metadata.CustomMetadata[versionMetadataPrefix+versionID] = strconv.Itoa(kvVersionNumber)
+
+	for _, stage := range stages {
+		metadata.setStage(stage, versionID)
+	}
+
+	return s.writeMetadata(ctx, secretID, metadata)
+}
+
+func (s Store) MoveStage(ctx context.Context, secretID string, stage versionstage2.VersionStage, toVersionID, fromVersionID string) error {
+	metadata, err := s.readMetadata(ctx, secretID)
+	if err != nil {
+		return err
+	}
+
+	if holder := metadata.stageHolder(stage); holder != "" && holder != toVersionID && holder != fromVersionID {
+		return fmt.Errorf("stage %s of '%s' is attached to version '%s', not '%s'", stage, secretID, holder, fromVersionID)
+	}
+
+	if toVersionID != "" {
+		if _, err = s.findVersion(ctx, secretID, metadata, toVersionID); err != nil {
+			return err
+		}
+	}
+
+	metadata.setStage(stage, toVersionID)
+
+	return s.writeMetadata(ctx, secretID, metadata)
+}
+
+func (s Store) DescribeSecret(ctx context.Context, secretID string) (jwtrotator.SecretDescription, error) {
+	metadata, err := s.readMetadata(ctx, secretID)
+	if err != nil {
+		return jwtrotator.SecretDescription{}, err
+	}
+
+	description := jwtrotator.SecretDescription{
+		Versions: make(map[string][]versionstage2.VersionStage),
+		Tags:     make(map[string]string),
+	}
+
+	for key, value := range metadata.CustomMetadata {
+		switch {
+		case strings.HasPrefix(key, stageMetadataPrefix):
+			stage := versionstage2.VersionStage(strings.TrimPrefix(key, stageMetadataPrefix))
+			description.Versions[value] = append(description.Versions[value], stage)
+		case !strings.HasPrefix(key, metadataPrefix):
+			description.Tags[key] = value
+		}
+	}
+
+	return description, nil
+}
+
+// TagSecret stores tags as custom metadata of the secret.
+func (s Store) TagSecret(ctx context.Context, secretID string, tags map[string]string) error {
+	metadata, err := s.readMetadata(ctx, secretID)
+	if err != nil {
+		return err
+	}
+
+	for key, value := range tags {
+		if strings.HasPrefix(key, metadataPrefix) {
+			return fmt.Errorf("tag '%s' uses the reserved prefix '%s'", key, metadataPrefix)
+		}
+
+		metadata.CustomMetadata[key] = value
+	}
+
+	return s.writeMetadata(ctx, secretID, metadata)
+}
+
+// findVersion reads the KV version storing versionID, scanning every KV
+// version if the secret metadata does not say where it is.
+func (s Store) findVersion(ctx context.Context, secretID string, metadata kvMetadata, versionID string) (kvVersion, error) {
+	if kvVersionNumber, ok := metadata.CustomMetadata[versionMetadataPrefix+versionID]; ok {
+		return s.readVersion(ctx, secretID, kvVersionNumber)
+	}
+
+	kvVersionNumbers := make([]int, 0, len(metadata.Versions))
+
+	for number, v := range metadata.Versions {
+		if n, err := strconv.Atoi(number); err == nil && !v.Destroyed && v.DeletionTime == "" {
+			kvVersionNumbers = append(kvVersionNumbers, n)
+		}
+	}
+
+	sort.Sort(sort.Reverse(sort.IntSlice(kvVersionNumbers)))
+
+	for _, n := range kvVersionNumbers {
+		version, err := s.readVersion(ctx, secretID, strconv.Itoa(n))
+		if errors.Is(err, jwtrotator.ErrResourceNotFound) {
+			continue
+		} else if err != nil {
+			return kvVersion{}, err
+		}
+
+		if version.Data.VersionID == versionID {
+			return version, nil
+		}
+	}
+
+	return kvVersion{}, fmt.Errorf("%w: version '%s' of '%s'", jwtrotator.ErrResourceNotFound, versionID, secretID)
+}
+
+func (s Store) readVersion(ctx context.Context, secretID, kvVersionNumber string) (kvVersion, error) {
+	var response struct {
+		Data kvVersion `json:"data"`
+	}
+
+	if err := s.do(ctx, http.MethodGet, s.dataPath(secretID), url.Values{"version": {kvVersionNumber}}, nil, &response); err != nil {
+		return kvVersion{}, fmt.Errorf("failed to read version %s of '%s': %w", kvVersionNumber, secretID, err)
+	}
+
+	return response.Data, nil
+}
+
+func (s Store) readMetadata(ctx context.Context, secretID string) (kvMetadata, error) {
+	var response struct {
+		Data kvMetadata `json:"data"`
+	}
+
+	if err := s.do(ctx, http.MethodGet, s.metadataPath(secretID), nil, nil, &response); err != nil {
+		return kvMetadata{}, fmt.Errorf("failed to read metadata of '%s': %w", secretID, err)
+	}
+
+	if response.Data.CustomMetadata == nil {
+		response.Data.CustomMetadata = make(map[string]string)
+	}
+
+	return response.Data, nil
+}
+
+func (s Store) writeMetadata(ctx context.Context, secretID string, metadata kvMetadata) error {
+	metadata.pruneVersions()
+
+	if err := s.do(ctx, http.MethodPost, s.metadataPath(secretID), nil, map[string]interface{}{
+		"custom_metadata": metadata.CustomMetadata,
+	}, nil); err != nil {
+		return fmt.Errorf("failed to write metadata of '%s': %w", secretID, err)
+	}
+
+	return nil
+}
+
+func (s Store) dataPath(secretID string) string {
+	return "/v1/" + s.mount() + "/data/" + strings.TrimPrefix(secretID, "/")
+}
+
+func (s Store) metadataPath(secretID string) string {
+	return "/v1/" + s.mount() + "/metadata/" + strings.TrimPrefix(secretID, "/")
+}
+
+func (s Store) mount() string {
+	if s.Mount == "" {
+		return defaultMount
+	}
+
+	return strings.Trim(s.Mount, "/")
+}
+
+func (s Store) do(ctx context.Context, method, path string, query url.Values, body, result interface{}) error {
+	var reqBody io.Reader
+
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+
+		reqBody = bytes.NewReader(encoded)
+	}
+
+	endpoint := strings.TrimRight(s.Address, "/") + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reqBody)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("X-Vault-Token", s.Token)
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to perform request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return jwtrotator.ErrResourceNotFound
+	case resp.StatusCode >= http.StatusBadRequest:
+		var vaultErr struct {
+			Errors []string `json:"errors"`
+		}
+
+		_ = json.NewDecoder(resp.Body).Decode(&vaultErr)
+
+		return fmt.Errorf("%w: %s %s responded with status %d: %s", ErrVault, method, path, resp.StatusCode, strings.Join(vaultErr.Errors, "; "))
+	case result == nil || resp.StatusCode == http.StatusNoContent:
+		return nil
+	}
+
+	if err = json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return nil
+}
+
+var _ jwtrotator.SecretStore = Store{}
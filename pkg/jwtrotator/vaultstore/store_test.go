@@ -0,0 +1,122 @@
+package vaultstore_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator"
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator/testutils/fakevault"
+	"github.com/SKF/jwt-rotator/pkg/jwtrotator/vaultstore"
+	versionstage2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/versionstage"
+)
+
+const secretID = "services/my-service/jwt"
+
+func TestStore_MoveCurrent(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	server := fakevault.New()
+	defer server.Close()
+
+	store := vaultstore.Store{Address: server.URL, Token: fakevault.Token}
+
+	require.NoError(t, store.PutSecretValue(ctx, secretID, "version-0", []byte("first"), []versionstage2.VersionStage{versionstage2.AwsCurrent}))
+	require.NoError(t, store.PutSecretValue(ctx, secretID, "version-1", []byte("second"), []versionstage2.VersionStage{versionstage2.AWSPending}))
+
+	// When
+	err := store.MoveStage(ctx, secretID, versionstage2.AwsCurrent, "version-1", "version-0")
+
+	// Then
+	require.NoError(t, err)
+
+	description, err := store.DescribeSecret(ctx, secretID)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []versionstage2.VersionStage{versionstage2.AwsCurrent, versionstage2.AWSPending}, description.Versions["version-1"])
+	assert.Equal(t, []versionstage2.VersionStage{versionstage2.AWSPrevious}, description.Versions["version-0"])
+
+	current, err := store.GetSecretValue(ctx, secretID, "", versionstage2.AwsCurrent)
+	require.NoError(t, err)
+	assert.Equal(t, "second", string(current.Value))
+	assert.Equal(t, "version-1", current.VersionID)
+}
+
+func TestStore_UnlabelledVersion(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	server := fakevault.New()
+	defer server.Close()
+
+	store := vaultstore.Store{Address: server.URL, Token: fakevault.Token}
+
+	for _, versionID := range []string{"version-0", "version-1", "version-2"} {
+		require.NoError(t, store.PutSecretValue(ctx, secretID, versionID, []byte(versionID), nil))
+	}
+
+	// When
+	unlabelled, err := store.GetSecretValue(ctx, secretID, "version-0", "")
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, "version-0", string(unlabelled.Value))
+	assert.Empty(t, unlabelled.Stages)
+
+	err = store.PutSecretValue(ctx, secretID, "version-0", []byte("other"), nil)
+	assert.ErrorIs(t, err, jwtrotator.ErrResourceExists)
+}
+
+func TestStore_RetryAfterFailedMetadataWrite(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	server := fakevault.New()
+	defer server.Close()
+
+	store := vaultstore.Store{Address: server.URL, Token: fakevault.Token}
+	require.NoError(t, store.PutSecretValue(ctx, secretID, "version-0", []byte("first"), nil))
+
+	server.FailedMetadataWrites = 1
+	require.Error(t, store.PutSecretValue(ctx, secretID, "version-1", []byte("second"), []versionstage2.VersionStage{versionstage2.AWSPending}))
+
+	// When
+	err := store.PutSecretValue(ctx, secretID, "version-1", []byte("second"), []versionstage2.VersionStage{versionstage2.AWSPending})
+
+	// Then
+	require.NoError(t, err)
+
+	pending, err := store.GetSecretValue(ctx, secretID, "", versionstage2.AWSPending)
+	require.NoError(t, err)
+	assert.Equal(t, "version-1", pending.VersionID)
+	assert.Equal(t, "second", string(pending.Value))
+
+}
+
+func TestStore_NotFound(t *testing.T) {
+	// Given
+	server := fakevault.New()
+	defer server.Close()
+
+	store := vaultstore.Store{Address: server.URL, Token: fakevault.Token}
+
+	// When
+	_, err := store.DescribeSecret(context.Background(), secretID)
+
+	// Then
+	assert.ErrorIs(t, err, jwtrotator.ErrResourceNotFound)
+}
+
+func TestStore_PermissionDenied(t *testing.T) {
+	// Given
+	server := fakevault.New()
+	defer server.Close()
+
+	store := vaultstore.Store{Address: server.URL, Token: "wrong-token"}
+
+	// When
+	_, err := store.DescribeSecret(context.Background(), secretID)
+
+	// Then
+	require.ErrorIs(t, err, vaultstore.ErrVault)
+	assert.Contains(t, err.Error(), "permission denied")
+}
@@ -1,5 +1,10 @@
 package versionstage
 
+import (
+	"fmt"
+	"strings"
+)
+
 // VersionStage is a Secret Manager Version ID.
 type VersionStage string
 
@@ -7,9 +12,87 @@ const (
 	AwsCurrent  VersionStage = "AWSCURRENT"
 	AWSPending  VersionStage = "AWSPENDING"
 	AWSPrevious VersionStage = "AWSPREVIOUS"
+
+	// JWTTested labels the PENDING version which passed the testSecret step,
+	// only a tested version is promoted by the finishSecret step.
+	JWTTested VersionStage = "JWTTESTED"
+
+	// JWTCanary labels a tested token which is rolled out to a subset of the
+	// consumers before it is promoted to AWSCURRENT.
+	JWTCanary VersionStage = "JWTCANARY"
+
+	// JWTRevoked labels the version whose token was last revoked at the
+	// identity provider, it is never restored as AWSCURRENT.
+	JWTRevoked VersionStage = "JWTREVOKED"
+
+	// JWTCompromised prefixes the labels of the versions whose token was
+	// replaced by an emergency rotation after it leaked, see Compromised.
+	JWTCompromised VersionStage = "JWTCOMPROMISED"
 )
 
+// Compromised returns the label marking versionID as compromised, such a
+// version is never restored as AWSCURRENT. A label is attached to a single
+// version, so every compromised version gets a label of its own.
+func Compromised(versionID string) VersionStage {
+	return JWTCompromised + "-" + VersionStage(versionID)
+}
+
+// MaxLength is the longest staging label Secrets Manager accepts.
+const MaxLength = 256
+
+// awsPrefix starts the labels Secrets Manager manages itself.
+const awsPrefix = "AWS"
+
 func (vs VersionStage) StringPtr() *string {
 	stringValue := string(vs)
 	return &stringValue
 }
+
+// Validate checks that the label is one Secrets Manager accepts.
+func (vs VersionStage) Validate() error {
+	if vs == "" || len(vs) > MaxLength {
+		return fmt.Errorf("staging label '%s' must be between 1 and %d characters", vs, MaxLength)
+	}
+
+	return nil
+}
+
+// IsAWSManaged reports whether Secrets Manager itself manages the label, like
+// AWSCURRENT, AWSPENDING and AWSPREVIOUS.
+func (vs VersionStage) IsAWSManaged() bool {
+	return strings.HasPrefix(string(vs), awsPrefix)
+}
+
+// IsReserved reports whether the rotator attaches the label itself to track
+// the state of a version, like JWTTESTED, JWTREVOKED and the JWTCOMPROMISED
+// labels. Moving such a label would change which versions are promoted or
+// restored.
+func (vs VersionStage) IsReserved() bool {
+	switch vs {
+	case JWTTested, JWTRevoked, JWTCompromised:
+		return true
+	}
+
+	return strings.HasPrefix(string(vs), string(JWTCompromised)+"-")
+}
+
+// Custom returns the custom staging label named label, it must be a valid
+// label which is neither managed by Secrets Manager nor reserved by the
+// rotator.
+func Custom(label string) (VersionStage, error) {
+	vs := VersionStage(label)
+
+	if err := vs.Validate(); err != nil {
+		return "", err
+	}
+
+	if vs.IsAWSManaged() {
+		return "", fmt.Errorf("staging label '%s' is reserved, custom labels must not start with %s", label, awsPrefix)
+	}
+
+	if vs.IsReserved() {
+		return "", fmt.Errorf("staging label '%s' is reserved by the rotator", label)
+	}
+
+	return vs, nil
+}
@@ -0,0 +1,59 @@
+package versionstage_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	versionstage2 "github.com/SKF/jwt-rotator/pkg/jwtrotator/versionstage"
+)
+
+func TestCustom(t *testing.T) {
+	for name, test := range map[string]struct {
+		label      string
+		awsManaged bool
+		reserved   bool
+		valid      bool
+		custom     bool
+	}{
+		"empty":            {label: ""},
+		"too long":         {label: strings.Repeat("A", versionstage2.MaxLength+1)},
+		"AWS-prefixed":     {label: "AWSCANARY", awsManaged: true, valid: true},
+		"AWS managed":      {label: string(versionstage2.AwsCurrent), awsManaged: true, valid: true},
+		"longest allowed":  {label: strings.Repeat("B", versionstage2.MaxLength), valid: true, custom: true},
+		"valid":            {label: "BLUE", valid: true, custom: true},
+		"built-in custom":  {label: string(versionstage2.JWTCanary), valid: true, custom: true},
+		"tested":           {label: string(versionstage2.JWTTested), reserved: true, valid: true},
+		"revoked":          {label: string(versionstage2.JWTRevoked), reserved: true, valid: true},
+		"compromised":      {label: string(versionstage2.Compromised(strings.Repeat("0", 64))), reserved: true, valid: true},
+		"compromised bare": {label: string(versionstage2.JWTCompromised), reserved: true, valid: true},
+		"JWT-prefixed":     {label: "JWTBLUE", valid: true, custom: true},
+	} {
+		test := test
+
+		t.Run(name, func(t *testing.T) {
+			// Given
+			vs := versionstage2.VersionStage(test.label)
+
+			// When
+			validateErr := vs.Validate()
+			awsManaged := vs.IsAWSManaged()
+			reserved := vs.IsReserved()
+			custom, customErr := versionstage2.Custom(test.label)
+
+			// Then
+			assert.Equal(t, test.valid, validateErr == nil, validateErr)
+			assert.Equal(t, test.awsManaged, awsManaged)
+			assert.Equal(t, test.reserved, reserved)
+
+			if test.custom {
+				assert.NoError(t, customErr)
+				assert.Equal(t, vs, custom)
+			} else {
+				assert.Error(t, customErr)
+				assert.Empty(t, custom)
+			}
+		})
+	}
+}